@@ -21,6 +21,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 	"sigs.k8s.io/metrics-server/pkg/utils"
@@ -32,11 +33,41 @@ type KubeletClientOptions struct {
 	InsecureKubeletTLS                  bool
 	KubeletPreferredAddressTypes        []string
 	KubeletCAFile                       string
+	KubeletNodeCADir                    string
 	KubeletClientKeyFile                string
 	KubeletClientCertFile               string
 	DeprecatedCompletelyInsecureKubelet bool
 	KubeletRequestTimeout               time.Duration
+	KubeletClientTimeout                time.Duration
+	KubeletDialTimeout                  time.Duration
+	KubeletTLSHandshakeTimeout          time.Duration
+	KubeletResponseHeaderTimeout        time.Duration
 	NodeSelector                        string
+	RequireNodeMemory                   bool
+	AllowZeroMemory                     bool
+	MaxContainersPerPod                 int
+	KubeletNodeLabel                    string
+	KubeletTLSServerNameFromHostname    bool
+	PodLevelCPU                         bool
+	PodLevelMemory                      bool
+	KubeletForceHTTP1                   bool
+	OnDuplicateSeries                   string
+	KubeletTimestampUnit                string
+	KubeletHealthSeries                 string
+	KubeletNodeCPUGaugeMetric           string
+	ScrapeLogVerbosity                  int
+	KubeletDecodeParallelism            int
+	KubeletPartialReadRetries           int
+	ApproximateNodeMemory               bool
+	ApproximateNodeMemoryOverhead       int64
+	IncludedNamespaces                  []string
+	KubeletKubeconfig                   string
+	KubeletKubeconfigContext            string
+	ScrapeTimeSkewMetric                bool
+	KubeletMetricNames                  map[string]string
+	KubeletAddressDNSFallback           bool
+	KubeletAddressDNSServer             string
+	KubeletAddressDNSTimeout            time.Duration
 }
 
 func (o *KubeletClientOptions) Validate() []error {
@@ -63,9 +94,55 @@ func (o *KubeletClientOptions) Validate() []error {
 	if (o.KubeletCAFile != "") && o.DeprecatedCompletelyInsecureKubelet {
 		errors = append(errors, fmt.Errorf("cannot use both --kubelet-certificate-authority and --deprecated-kubelet-completely-insecure"))
 	}
+	if (o.KubeletNodeCADir != "") && o.InsecureKubeletTLS {
+		errors = append(errors, fmt.Errorf("cannot use both --kubelet-node-ca-dir and --kubelet-insecure-tls"))
+	}
+	if (o.KubeletNodeCADir != "") && o.DeprecatedCompletelyInsecureKubelet {
+		errors = append(errors, fmt.Errorf("cannot use both --kubelet-node-ca-dir and --deprecated-kubelet-completely-insecure"))
+	}
 	if o.KubeletRequestTimeout <= 0 {
 		errors = append(errors, fmt.Errorf("kubelet-request-timeout should be positive"))
 	}
+	if o.KubeletClientTimeout < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-client-timeout should not be negative"))
+	}
+	if o.KubeletDialTimeout < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-dial-timeout should not be negative"))
+	}
+	if o.KubeletTLSHandshakeTimeout < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-tls-handshake-timeout should not be negative"))
+	}
+	if o.KubeletResponseHeaderTimeout < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-response-header-timeout should not be negative"))
+	}
+	if o.ScrapeLogVerbosity < 0 {
+		errors = append(errors, fmt.Errorf("scrape-log-verbosity should not be negative"))
+	}
+	if o.KubeletDecodeParallelism < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-decode-parallelism should not be negative"))
+	}
+	if o.KubeletPartialReadRetries < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-partial-read-retries should not be negative"))
+	}
+	if o.ApproximateNodeMemoryOverhead < 0 {
+		errors = append(errors, fmt.Errorf("approximate-node-memory-overhead-bytes should not be negative"))
+	}
+	if len(o.KubeletKubeconfig) > 0 && o.DeprecatedCompletelyInsecureKubelet {
+		errors = append(errors, fmt.Errorf("cannot use both --kubelet-kubeconfig and --deprecated-kubelet-completely-insecure"))
+	}
+	if o.MaxContainersPerPod < 0 {
+		errors = append(errors, fmt.Errorf("max-containers-per-pod should not be negative"))
+	}
+	switch o.OnDuplicateSeries {
+	case "", client.DuplicateSeriesLast, client.DuplicateSeriesSum, client.DuplicateSeriesError:
+	default:
+		errors = append(errors, fmt.Errorf("on-duplicate-series should be one of %q, %q or %q, but %q provided", client.DuplicateSeriesLast, client.DuplicateSeriesSum, client.DuplicateSeriesError, o.OnDuplicateSeries))
+	}
+	switch o.KubeletTimestampUnit {
+	case "", client.TimestampUnitMilliseconds, client.TimestampUnitSeconds:
+	default:
+		errors = append(errors, fmt.Errorf("kubelet-timestamp-unit should be one of %q or %q, but %q provided", client.TimestampUnitMilliseconds, client.TimestampUnitSeconds, o.KubeletTimestampUnit))
+	}
 	return errors
 }
 
@@ -74,10 +151,40 @@ func (o *KubeletClientOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&o.KubeletUseNodeStatusPort, "kubelet-use-node-status-port", o.KubeletUseNodeStatusPort, "Use the port in the node status. Takes precedence over --kubelet-port flag.")
 	fs.IntVar(&o.KubeletPort, "kubelet-port", o.KubeletPort, "The port to use to connect to Kubelets.")
 	fs.StringSliceVar(&o.KubeletPreferredAddressTypes, "kubelet-preferred-address-types", o.KubeletPreferredAddressTypes, "The priority of node address types to use when determining which address to use to connect to a particular node")
+	fs.StringVar(&o.KubeletKubeconfig, "kubelet-kubeconfig", o.KubeletKubeconfig, "The path to the kubeconfig with credentials used to connect to the Kubelets, instead of the ones used for the Kubernetes API server. Useful when running outside of the cluster.")
+	fs.StringVar(&o.KubeletKubeconfigContext, "kubelet-kubeconfig-context", o.KubeletKubeconfigContext, "The kubeconfig context with credentials used to connect to the Kubelets. Uses --kubelet-kubeconfig if set, --kubeconfig otherwise. Empty uses the current context of --kubelet-kubeconfig.")
 	fs.StringVar(&o.KubeletCAFile, "kubelet-certificate-authority", "", "Path to the CA to use to validate the Kubelet's serving certificates.")
+	fs.StringVar(&o.KubeletNodeCADir, "kubelet-node-ca-dir", o.KubeletNodeCADir, "Path to the directory with CA bundles of nodes, named <node name>.crt, used to validate serving certificates of Kubelets on them instead of --kubelet-certificate-authority. Bundles are re-read when modified. Nodes without a bundle use the cluster CA.")
 	fs.StringVar(&o.KubeletClientKeyFile, "kubelet-client-key", "", "Path to a client key file for TLS.")
 	fs.StringVar(&o.KubeletClientCertFile, "kubelet-client-certificate", "", "Path to a client cert file for TLS.")
 	fs.DurationVar(&o.KubeletRequestTimeout, "kubelet-request-timeout", o.KubeletRequestTimeout, "The length of time to wait before giving up on a single request to Kubelet. Non-zero values should contain a corresponding time unit (e.g. 1s, 2m, 3h).")
+	fs.DurationVar(&o.KubeletClientTimeout, "kubelet-client-timeout", o.KubeletClientTimeout, "The timeout of the HTTP client used to connect to Kubelets, including connecting and waiting for response headers. Guards against hanging connections independently of --kubelet-request-timeout. Zero means no timeout.")
+	fs.DurationVar(&o.KubeletDialTimeout, "kubelet-dial-timeout", o.KubeletDialTimeout, "The timeout of establishing TCP connections to Kubelets. Zero uses the default of 30s.")
+	fs.DurationVar(&o.KubeletTLSHandshakeTimeout, "kubelet-tls-handshake-timeout", o.KubeletTLSHandshakeTimeout, "The timeout of TLS handshakes with Kubelets. Zero uses the default of 10s.")
+	fs.DurationVar(&o.KubeletResponseHeaderTimeout, "kubelet-response-header-timeout", o.KubeletResponseHeaderTimeout, "The timeout of waiting for Kubelet response headers after sending request. Zero means no timeout.")
+	fs.BoolVar(&o.RequireNodeMemory, "require-node-memory", o.RequireNodeMemory, "Drop node metrics if Kubelet doesn't report node memory usage. If false, such nodes are served with CPU usage only and memory usage reported as zero.")
+	fs.BoolVar(&o.ApproximateNodeMemory, "approximate-node-memory", o.ApproximateNodeMemory, "Approximate node memory usage not reported by Kubelet as the sum of memory usage of its pods plus --approximate-node-memory-overhead-bytes, instead of dropping the node. Such node metrics are annotated with metrics-server.io/approximate-memory.")
+	fs.Int64Var(&o.ApproximateNodeMemoryOverhead, "approximate-node-memory-overhead-bytes", o.ApproximateNodeMemoryOverhead, "Bytes added to the sum of pod memory usage when approximating node memory usage, accounting for system daemons and kernel memory.")
+	fs.BoolVar(&o.AllowZeroMemory, "allow-zero-memory", o.AllowZeroMemory, "Keep containers reporting zero memory working set, e.g. idle containers, instead of dropping metrics of their pods as incomplete.")
+	fs.IntVar(&o.MaxContainersPerPod, "max-containers-per-pod", o.MaxContainersPerPod, "Maximum number of containers stored per pod. Containers above the limit are dropped. Zero means unlimited.")
+	fs.StringVar(&o.KubeletNodeLabel, "kubelet-node-label", o.KubeletNodeLabel, "Name of the label identifying node of scraped series, allowing to decode metrics of multiple nodes from a single response, e.g. served by an aggregating proxy. Empty expects metrics of a single node.")
+	fs.BoolVar(&o.KubeletTLSServerNameFromHostname, "kubelet-tls-server-name-from-hostname", o.KubeletTLSServerNameFromHostname, "Verify Kubelet serving certificates against node hostname, while connecting to the address chosen by --kubelet-preferred-address-types. Useful when certificates are not valid for node IPs.")
+	fs.BoolVar(&o.PodLevelCPU, "pod-level-cpu", o.PodLevelCPU, "Decode pod-level CPU usage reported by Kubelet, which includes pod overhead not attributed to containers. The difference to usage of containers is served as usage of the POD container in the Metrics API.")
+	fs.BoolVar(&o.PodLevelMemory, "pod-level-memory", o.PodLevelMemory, "Decode pod-level memory working set reported by Kubelet, which includes pod overhead not attributed to containers. The difference to usage of containers is served as usage of the POD container in the Metrics API.")
+	fs.BoolVar(&o.KubeletForceHTTP1, "kubelet-force-http1", o.KubeletForceHTTP1, "Use HTTP/1.1 to connect to Kubelets, disabling HTTP/2. Works around Kubelets misbehaving with HTTP/2.")
+	fs.StringVar(&o.OnDuplicateSeries, "on-duplicate-series", o.OnDuplicateSeries, "How to handle container CPU and memory series repeated within a single Kubelet response: 'last' keeps the last value, 'sum' adds up values, 'error' fails the scrape of the node.")
+	fs.StringVar(&o.KubeletTimestampUnit, "kubelet-timestamp-unit", o.KubeletTimestampUnit, "Unit of timestamps of series reported by Kubelets: 'ms' for milliseconds used by Prometheus text format, 's' for Kubelets reporting seconds.")
+	fs.StringVar(&o.KubeletHealthSeries, "kubelet-health-series", o.KubeletHealthSeries, "Name of the series reported by Kubelet indicating its health. Metrics from responses with the series equal zero are skipped. Empty disables health gating.")
+	fs.StringVar(&o.KubeletNodeCPUGaugeMetric, "kubelet-node-cpu-gauge-metric", o.KubeletNodeCPUGaugeMetric, "Name of the series reporting node CPU usage in cores as a gauge, for Kubelets not exposing cumulative node_cpu_usage_seconds_total. Such nodes are served after a single scrape. Empty disables it.")
+	fs.IntVar(&o.ScrapeLogVerbosity, "scrape-log-verbosity", o.ScrapeLogVerbosity, "Log verbosity of structured logs emitted for each Kubelet scrape, with keys node, duration, bytes, podCount and err. Use --logging-format=json to emit them as JSON.")
+	fs.IntVar(&o.KubeletDecodeParallelism, "kubelet-decode-parallelism", o.KubeletDecodeParallelism, "Number of metric family groups decoded concurrently for large Kubelet responses, using multiple cores for nodes with many pods. Values below 2 decode responses serially.")
+	fs.IntVar(&o.KubeletPartialReadRetries, "kubelet-partial-read-retries", o.KubeletPartialReadRetries, "Number of times a Kubelet scrape is retried when connection fails while reading the response body, within the scrape timeout. Decode errors are not retried.")
+	fs.StringSliceVar(&o.IncludedNamespaces, "included-namespaces", o.IncludedNamespaces, "Comma separated list of namespaces pod metrics are served for. Metrics of pods in other namespaces are dropped when scraped. Empty means all namespaces.")
+	fs.BoolVar(&o.ScrapeTimeSkewMetric, "scrape-time-skew-metric", o.ScrapeTimeSkewMetric, "Expose metrics_server_scrape_time_skew_seconds histogram of difference between scrape time and timestamp of node metrics per node, helping to detect node clock skew.")
+	fs.BoolVar(&o.KubeletAddressDNSFallback, "kubelet-address-dns-fallback", o.KubeletAddressDNSFallback, "Resolve node hostname via DNS to connect to nodes having no address of types in --kubelet-preferred-address-types, instead of failing their scrape.")
+	fs.StringVar(&o.KubeletAddressDNSServer, "kubelet-address-dns-server", o.KubeletAddressDNSServer, "Address (host:port) of the DNS server used by --kubelet-address-dns-fallback. Empty uses the system resolver.")
+	fs.DurationVar(&o.KubeletAddressDNSTimeout, "kubelet-address-dns-timeout", o.KubeletAddressDNSTimeout, "Timeout of resolving node hostname used by --kubelet-address-dns-fallback. Zero means no timeout.")
+	fs.StringToStringVar(&o.KubeletMetricNames, "kubelet-metric-names", o.KubeletMetricNames, "Comma separated mapping of names of metrics decoded by Metrics Server to names reported by Kubelet, e.g. container_memory_working_set_bytes=container_memory_working_set, for Kubelets exposing metrics under different names. Reported values must use the same units.")
 	fs.StringVarP(&o.NodeSelector, "node-selector", "l", o.NodeSelector, "Selector (label query) to filter on, not including uninitialized ones, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2).")
 	// MarkDeprecated hides the flag from the help. We don't want that.
 	fs.BoolVar(&o.DeprecatedCompletelyInsecureKubelet, "deprecated-kubelet-completely-insecure", o.DeprecatedCompletelyInsecureKubelet, "DEPRECATED: Do not use any encryption, authorization, or authentication when communicating with the Kubelet. This is rarely the right option, since it leaves kubelet communication completely insecure.  If you encounter auth errors, make sure you've enabled token webhook auth on the Kubelet, and if you're in a test cluster with self-signed Kubelet certificates, consider using kubelet-insecure-tls instead.")
@@ -89,6 +196,12 @@ func NewKubeletClientOptions() *KubeletClientOptions {
 		KubeletPort:                  10250,
 		KubeletPreferredAddressTypes: make([]string, len(utils.DefaultAddressTypePriority)),
 		KubeletRequestTimeout:        10 * time.Second,
+		RequireNodeMemory:            true,
+		OnDuplicateSeries:            client.DuplicateSeriesLast,
+		KubeletTimestampUnit:         client.TimestampUnitMilliseconds,
+		ScrapeLogVerbosity:           2,
+		KubeletPartialReadRetries:    1,
+		KubeletAddressDNSTimeout:     5 * time.Second,
 	}
 
 	for i, addrType := range utils.DefaultAddressTypePriority {
@@ -98,13 +211,63 @@ func NewKubeletClientOptions() *KubeletClientOptions {
 	return o
 }
 
+// RestConfig returns config used to connect to Kubelets, loaded from the kubelet kubeconfig or context if set,
+// defaulting to restConfig used for the Kubernetes API server. Kubeconfig defaults to apiserverKubeconfig.
+func (o KubeletClientOptions) RestConfig(restConfig *rest.Config, apiserverKubeconfig string) (*rest.Config, error) {
+	if len(o.KubeletKubeconfig) == 0 && len(o.KubeletKubeconfigContext) == 0 {
+		return restConfig, nil
+	}
+	kubeconfig := o.KubeletKubeconfig
+	if len(kubeconfig) == 0 {
+		kubeconfig = apiserverKubeconfig
+	}
+	if len(kubeconfig) == 0 {
+		return nil, fmt.Errorf("kubelet-kubeconfig-context requires --kubelet-kubeconfig or --kubeconfig")
+	}
+	loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: o.KubeletKubeconfigContext}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct kubelet client config: %v", err)
+	}
+	return config, nil
+}
+
 func (o KubeletClientOptions) Config(restConfig *rest.Config) *client.KubeletClientConfig {
 	config := &client.KubeletClientConfig{
-		Scheme:              "https",
-		DefaultPort:         o.KubeletPort,
-		AddressTypePriority: o.addressResolverConfig(),
-		UseNodeStatusPort:   o.KubeletUseNodeStatusPort,
-		Client:              *rest.CopyConfig(restConfig),
+		Scheme:                    "https",
+		DefaultPort:               o.KubeletPort,
+		AddressTypePriority:       o.addressResolverConfig(),
+		AddressDNSFallback:        o.KubeletAddressDNSFallback,
+		AddressDNSServer:          o.KubeletAddressDNSServer,
+		AddressDNSTimeout:         o.KubeletAddressDNSTimeout,
+		UseNodeStatusPort:         o.KubeletUseNodeStatusPort,
+		RequireNodeMemory:         o.RequireNodeMemory,
+		AllowZeroMemory:           o.AllowZeroMemory,
+		ApproximateNodeMemory:     o.ApproximateNodeMemory,
+		NodeMemoryOverhead:        o.ApproximateNodeMemoryOverhead,
+		IncludedNamespaces:        o.IncludedNamespaces,
+		ObserveTimeSkew:           o.ScrapeTimeSkewMetric,
+		MetricNames:               o.KubeletMetricNames,
+		MaxContainersPerPod:       o.MaxContainersPerPod,
+		ClientTimeout:             o.KubeletClientTimeout,
+		DialTimeout:               o.KubeletDialTimeout,
+		TLSHandshakeTimeout:       o.KubeletTLSHandshakeTimeout,
+		ResponseHeaderTimeout:     o.KubeletResponseHeaderTimeout,
+		NodeLabel:                 o.KubeletNodeLabel,
+		PodLevelCPU:               o.PodLevelCPU,
+		PodLevelMemory:            o.PodLevelMemory,
+		ForceHTTP1:                o.KubeletForceHTTP1,
+		OnDuplicateSeries:         o.OnDuplicateSeries,
+		TimestampUnit:             o.KubeletTimestampUnit,
+		HealthSeries:              o.KubeletHealthSeries,
+		NodeCPUGaugeMetric:        o.KubeletNodeCPUGaugeMetric,
+		ScrapeLogVerbosity:        o.ScrapeLogVerbosity,
+		DecodeParallelism:         o.KubeletDecodeParallelism,
+		PartialReadRetries:        o.KubeletPartialReadRetries,
+		TLSServerNameFromHostname: o.KubeletTLSServerNameFromHostname,
+		NodeCADir:                 o.KubeletNodeCADir,
+		Client:                    *rest.CopyConfig(restConfig),
 	}
 	if o.DeprecatedCompletelyInsecureKubelet {
 		config.Scheme = "http"
@@ -14,6 +14,10 @@
 package options
 
 import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -21,6 +25,7 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
+	certutil "k8s.io/client-go/util/cert"
 
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 )
@@ -49,6 +54,12 @@ func TestConfig(t *testing.T) {
 		AddressTypePriority: []v1.NodeAddressType{"Hostname", "InternalDNS", "InternalIP", "ExternalDNS", "ExternalIP"},
 		Scheme:              "https",
 		DefaultPort:         10250,
+		RequireNodeMemory:   true,
+		OnDuplicateSeries:   client.DuplicateSeriesLast,
+		TimestampUnit:       client.TimestampUnitMilliseconds,
+		ScrapeLogVerbosity:  2,
+		PartialReadRetries:  1,
+		AddressDNSTimeout:   5 * time.Second,
 		Client:              *kubeconfig,
 	}
 
@@ -112,6 +123,32 @@ func TestConfig(t *testing.T) {
 				return e
 			},
 		},
+		{
+			name: "RequireNodeMemory can be disabled",
+			optionsFunc: func() *KubeletClientOptions {
+				o := NewKubeletClientOptions()
+				o.RequireNodeMemory = false
+				return o
+			},
+			expectFunc: func() client.KubeletClientConfig {
+				e := expected
+				e.RequireNodeMemory = false
+				return e
+			},
+		},
+		{
+			name: "KubeletClientTimeout sets client timeout",
+			optionsFunc: func() *KubeletClientOptions {
+				o := NewKubeletClientOptions()
+				o.KubeletClientTimeout = 5 * time.Second
+				return o
+			},
+			expectFunc: func() client.KubeletClientConfig {
+				e := expected
+				e.ClientTimeout = 5 * time.Second
+				return e
+			},
+		},
 		{
 			name: "KubeletClientCertFile overrides TLS client cert file",
 			optionsFunc: func() *KubeletClientOptions {
@@ -150,6 +187,105 @@ func TestConfig(t *testing.T) {
 	}
 }
 
+func TestRestConfig_KubeletKubeconfigContext(t *testing.T) {
+	cert, key, err := certutil.GenerateSelfSignedCertKey("kubelet-client", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	err = os.WriteFile(kubeconfig, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://10.96.0.1:443
+    insecure-skip-tls-verify: true
+users:
+- name: apiserver
+  user:
+    token: apiserver-token
+- name: kubelet
+  user:
+    client-certificate-data: %s
+    client-key-data: %s
+contexts:
+- name: apiserver
+  context:
+    cluster: cluster
+    user: apiserver
+- name: kubelet
+  context:
+    cluster: cluster
+    user: kubelet
+current-context: apiserver
+`, base64.StdEncoding.EncodeToString(cert), base64.StdEncoding.EncodeToString(key))), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiserverConfig := &rest.Config{Host: "https://10.96.0.1:443", BearerToken: "apiserver-token"}
+
+	for _, tc := range []struct {
+		name        string
+		options     KubeletClientOptions
+		kubeconfig  string
+		expectToken string
+		expectCert  bool
+		expectErr   bool
+	}{
+		{
+			name:        "Defaults to apiserver config",
+			kubeconfig:  kubeconfig,
+			expectToken: "apiserver-token",
+		},
+		{
+			name:       "Context of apiserver kubeconfig",
+			options:    KubeletClientOptions{KubeletKubeconfigContext: "kubelet"},
+			kubeconfig: kubeconfig,
+			expectCert: true,
+		},
+		{
+			name:       "Context of kubelet kubeconfig",
+			options:    KubeletClientOptions{KubeletKubeconfig: kubeconfig, KubeletKubeconfigContext: "kubelet"},
+			expectCert: true,
+		},
+		{
+			name:        "Current context of kubelet kubeconfig",
+			options:     KubeletClientOptions{KubeletKubeconfig: kubeconfig},
+			expectToken: "apiserver-token",
+		},
+		{
+			name:      "Context requires kubeconfig",
+			options:   KubeletClientOptions{KubeletKubeconfigContext: "kubelet"},
+			expectErr: true,
+		},
+		{
+			name:       "Unknown context",
+			options:    KubeletClientOptions{KubeletKubeconfigContext: "unknown"},
+			kubeconfig: kubeconfig,
+			expectErr:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := tc.options.RestConfig(apiserverConfig, tc.kubeconfig)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if config.BearerToken != tc.expectToken {
+				t.Errorf("Unexpected bearer token, want: %q, got: %q", tc.expectToken, config.BearerToken)
+			}
+			if hasCert := len(config.TLSClientConfig.CertData) != 0; hasCert != tc.expectCert {
+				t.Errorf("Unexpected client certificate presence, want: %v, got: %v", tc.expectCert, hasCert)
+			}
+			if _, err := rest.TransportFor(config); err != nil {
+				t.Errorf("Failed to construct transport: %v", err)
+			}
+		})
+	}
+}
+
 func TestValidate(t *testing.T) {
 	for _, tc := range []struct {
 		name               string
@@ -245,6 +381,22 @@ func TestValidate(t *testing.T) {
 			},
 			expectedErrorCount: 1,
 		},
+		{
+			name: "cannot give --max-containers-per-pod value less than 0",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				MaxContainersPerPod:   -1,
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "cannot give --kubelet-client-timeout value less than 0",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletClientTimeout:  -1 * time.Second,
+			},
+			expectedErrorCount: 1,
+		},
 		{
 			name: "cannot give --kubelet-request-timeout value less than 0",
 			options: &KubeletClientOptions{
@@ -252,6 +404,22 @@ func TestValidate(t *testing.T) {
 			},
 			expectedErrorCount: 1,
 		},
+		{
+			name: "cannot give unknown --on-duplicate-series value",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				OnDuplicateSeries:     "first",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "cannot give unknown --kubelet-timestamp-unit value",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletTimestampUnit:  "us",
+			},
+			expectedErrorCount: 1,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			errors := tc.options.Validate()
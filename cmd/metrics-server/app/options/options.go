@@ -34,6 +34,7 @@ import (
 	"sigs.k8s.io/metrics-server/pkg/api"
 	generatedopenapi "sigs.k8s.io/metrics-server/pkg/api/generated/openapi"
 	"sigs.k8s.io/metrics-server/pkg/server"
+	"sigs.k8s.io/metrics-server/pkg/storage"
 )
 
 type Options struct {
@@ -47,9 +48,48 @@ type Options struct {
 	KubeletClient           *KubeletClientOptions
 	Logging                 *logs.Options
 
-	MetricResolution time.Duration
-	ShowVersion      bool
-	Kubeconfig       string
+	MetricResolution         time.Duration
+	ShowVersion              bool
+	Kubeconfig               string
+	ClusterName              string
+	NodePodSumDiff           bool
+	ListCacheTTL             time.Duration
+	ExplainMissingPodMetrics bool
+	NodeRelistInterval       time.Duration
+	EnableStorageReset       bool
+	EnableLatestPoints       bool
+	EnablePodContainers      bool
+	ReadinessGracePeriod     time.Duration
+	DefaultWindow            time.Duration
+	ExcludeInitContainers    bool
+	ExcludeEphemeral         bool
+	PendingPodsAsZero        bool
+	CPURequestUtilization    bool
+	MetricsNamespace         string
+	MetricsSubsystemPrefix   string
+	PodEvictionTTL           time.Duration
+	TopPort                  int
+	ResponseCompressionLevel int
+	CPUEWMAAlpha             float64
+	PodUIDAnnotation         bool
+	ScrapePodSelector        string
+	SingleCycleWarmup        bool
+	MinStartTimeAge          time.Duration
+	StartTimeWindows         bool
+	NodeMetricsLabels        []string
+	MaxNodesPerCycle         int
+	PodNodeNameSelector      bool
+	PodSkipAnnotation        string
+	StaleAfter               time.Duration
+	VersionAnnotation        bool
+	NodeAgeAnnotation        bool
+	PodsMissingInInformer    bool
+	ListParallelism          int
+	MaxConcurrentScrapes     int
+	ScrapeWorkers            int
+	ScrapeBudgetBase         time.Duration
+	ScrapeBudgetPerNode      time.Duration
+	RefreshStaleNodesAfter   time.Duration
 
 	// Only to be used to for testing
 	DisableAuthForTesting bool
@@ -76,14 +116,104 @@ func (o *Options) validate() []error {
 	if o.MetricResolution*9/10 < o.KubeletClient.KubeletRequestTimeout {
 		errors = append(errors, fmt.Errorf("metric-resolution should be larger than kubelet-request-timeout, but metric-resolution value %v kubelet-request-timeout value %v provided", o.MetricResolution, o.KubeletClient.KubeletRequestTimeout))
 	}
+	if o.CPUEWMAAlpha < 0 || o.CPUEWMAAlpha > 1 {
+		errors = append(errors, fmt.Errorf("cpu-ewma-alpha should be between 0 and 1"))
+	}
+	if o.ResponseCompressionLevel < 0 || o.ResponseCompressionLevel > 9 {
+		errors = append(errors, fmt.Errorf("response-compression-level should be between 0 and 9"))
+	}
+	if o.TopPort < 0 || o.TopPort > 65535 {
+		errors = append(errors, fmt.Errorf("top-port should be between 0 and 65535"))
+	}
+	if o.PodEvictionTTL < 0 {
+		errors = append(errors, fmt.Errorf("pod-eviction-ttl should not be negative"))
+	}
+	if err := o.warmupPolicy().Validate(); err != nil {
+		errors = append(errors, fmt.Errorf("invalid warmup policy: %v", err))
+	}
+	if o.DefaultWindow < 0 {
+		errors = append(errors, fmt.Errorf("default-window should not be negative"))
+	}
+	if o.ReadinessGracePeriod < 0 {
+		errors = append(errors, fmt.Errorf("readiness-grace-period should not be negative"))
+	}
+	if o.MaxNodesPerCycle < 0 {
+		errors = append(errors, fmt.Errorf("max-nodes-per-cycle should not be negative"))
+	}
+	if o.MaxConcurrentScrapes < 0 {
+		errors = append(errors, fmt.Errorf("max-concurrent-scrapes should not be negative"))
+	}
+	if o.ScrapeWorkers < 0 {
+		errors = append(errors, fmt.Errorf("scrape-workers should not be negative"))
+	}
+	if o.ScrapeBudgetBase < 0 {
+		errors = append(errors, fmt.Errorf("scrape-budget-base should not be negative"))
+	}
+	if o.ScrapeBudgetPerNode < 0 {
+		errors = append(errors, fmt.Errorf("scrape-budget-per-node should not be negative"))
+	}
+	if o.RefreshStaleNodesAfter < 0 {
+		errors = append(errors, fmt.Errorf("refresh-stale-nodes-after should not be negative"))
+	}
+	if o.StaleAfter < 0 {
+		errors = append(errors, fmt.Errorf("annotate-stale-after should not be negative"))
+	}
+	if o.NodeRelistInterval < 0 {
+		errors = append(errors, fmt.Errorf("node-relist-interval should not be negative"))
+	}
+	if o.ListCacheTTL < 0 || o.ListCacheTTL >= o.MetricResolution {
+		errors = append(errors, fmt.Errorf("list-cache-ttl should not be negative and should be lower than metric-resolution, but list-cache-ttl value %v metric-resolution value %v provided", o.ListCacheTTL, o.MetricResolution))
+	}
 	return errors
 }
 
 func (o *Options) Flags() (fs flag.NamedFlagSets) {
 	msfs := fs.FlagSet("metrics server")
+	// Flags of features watching full pod objects are grouped, so their memory cost is documented once.
+	pfs := fs.FlagSet("metrics server (requires watching full pod objects, increasing memory usage)")
 	msfs.DurationVar(&o.MetricResolution, "metric-resolution", o.MetricResolution, "The resolution at which metrics-server will retain metrics, must set value at least 10s.")
 	msfs.BoolVar(&o.ShowVersion, "version", false, "Show version")
 	msfs.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "The path to the kubeconfig used to connect to the Kubernetes API server and the Kubelets (defaults to in-cluster config)")
+	msfs.BoolVar(&o.NodePodSumDiff, "node-pod-sum-diff-metric", o.NodePodSumDiff, "Expose metrics_server_node_pod_sum_diff metric comparing node usage with the sum of usage of its pods. Useful for debugging Kubelet accounting discrepancies.")
+	msfs.DurationVar(&o.ListCacheTTL, "list-cache-ttl", o.ListCacheTTL, "The length of time to cache List responses of the Metrics API to absorb bursts of identical requests. Cache is dropped when new metrics are stored. Must be lower than metric-resolution. Zero disables caching.")
+	msfs.DurationVar(&o.NodeRelistInterval, "node-relist-interval", o.NodeRelistInterval, "The interval of listing nodes directly from API server, in addition to node informer, to pick up nodes missed by the informer. Zero disables direct listing.")
+	msfs.BoolVar(&o.EnableLatestPoints, "enable-latest-points-handler", o.EnableLatestPoints, "Enable /debug/storage/latest endpoint serving the latest stored cumulative CPU usage and memory working set of nodes and containers as JSON, without computing rates, for consumers doing their own rate math.")
+	msfs.BoolVar(&o.EnablePodContainers, "enable-pod-containers-handler", o.EnablePodContainers, "Enable /debug/pods/containers endpoint listing containers of the pod given by namespace and pod query parameters, whether storage has their metrics and the reason of dropping them otherwise.")
+	msfs.BoolVar(&o.EnableStorageReset, "enable-storage-reset-handler", o.EnableStorageReset, "Enable /debug/storage/reset endpoint dropping all stored metrics on POST request. For troubleshooting purposes only.")
+	msfs.DurationVar(&o.ReadinessGracePeriod, "readiness-grace-period", o.ReadinessGracePeriod, "The length of time metric collection failures are tolerated by the metric-storage-ready readiness probe before it fails. Liveness probes are not affected.")
+	msfs.DurationVar(&o.DefaultWindow, "default-window", o.DefaultWindow, "The window reported for fresh containers with a single metrics point, clamped to metric-resolution. Zero uses time since container start.")
+	msfs.StringVar(&o.MetricsNamespace, "metrics-namespace", o.MetricsNamespace, "The namespace of metrics exposed by metrics server about itself. Empty keeps the default metrics_server namespace.")
+	msfs.StringVar(&o.MetricsSubsystemPrefix, "metrics-subsystem-prefix", o.MetricsSubsystemPrefix, "The prefix prepended to subsystem of metrics exposed by metrics server about itself, following the namespace. Empty keeps subsystems unchanged.")
+	msfs.DurationVar(&o.PodEvictionTTL, "pod-eviction-ttl", o.PodEvictionTTL, "The length of time after which stored metrics of pods that were not read are dropped until they are read again, bounding memory usage. Node metrics are never dropped. Zero disables eviction.")
+	msfs.Float64Var(&o.CPUEWMAAlpha, "cpu-ewma-alpha", o.CPUEWMAAlpha, "Serve exponentially weighted moving average of CPU usage with the given smoothing factor in (0, 1], reducing flapping of autoscalers. Lower values smooth more, served window reflects the effective lookback. Zero serves usage between the last two metrics points.")
+	msfs.BoolVar(&o.PodUIDAnnotation, "pod-uid-annotation", o.PodUIDAnnotation, "Annotate pod metrics with UID of the pod under metrics.k8s.io/pod-uid annotation, allowing to track pods across name reuse.")
+	msfs.IntVar(&o.ResponseCompressionLevel, "response-compression-level", o.ResponseCompressionLevel, "The gzip compression level, from 1 (fastest) to 9 (best compression), of responses served by Metrics Server's own HTTP endpoints, e.g. the top views, to clients accepting gzip encoding. Zero disables compression. Doesn't affect the Metrics API.")
+	msfs.IntVar(&o.TopPort, "top-port", o.TopPort, "The port of an optional HTTP server exposing read-only /top/pods and /top/nodes JSON views of usage WITHOUT authentication. Anyone with network access to the port can read usage of all pods and nodes. Zero disables it.")
+	msfs.DurationVar(&o.MinStartTimeAge, "min-start-time-age", o.MinStartTimeAge, "Minimum time since start of a container or node for usage to be calculated since its start time, as shorter windows can produce inaccurate usage.")
+	msfs.BoolVar(&o.StartTimeWindows, "start-time-windows", o.StartTimeWindows, "Serve containers started within metric-resolution with window since their start after a single scrape, instead of waiting for their second scrape.")
+	msfs.BoolVar(&o.SingleCycleWarmup, "single-cycle-warmup", o.SingleCycleWarmup, "Serve metrics after a single scrape instead of two, reporting usage averaged since start time for containers and nodes seen for the first time. Less precise than usage between scrapes. Nodes are only served early if Kubelet reports their start time.")
+	msfs.StringSliceVar(&o.NodeMetricsLabels, "node-metrics-labels", o.NodeMetricsLabels, "The list of node label keys copied to node metrics, reducing size of responses for nodes with many labels. Empty copies all labels.")
+	msfs.DurationVar(&o.RefreshStaleNodesAfter, "refresh-stale-nodes-after", o.RefreshStaleNodesAfter, "Age of node metrics after which requesting them triggers an immediate re-scrape of the node in background, so following requests get fresh metrics. Each node is re-scraped at most once per this duration. Zero disables it.")
+	msfs.IntVar(&o.ScrapeWorkers, "scrape-workers", o.ScrapeWorkers, "Number of goroutines reused to scrape nodes in each cycle, bounding goroutines spawned at scale. Zero means a goroutine per node.")
+	msfs.IntVar(&o.MaxConcurrentScrapes, "max-concurrent-scrapes", o.MaxConcurrentScrapes, "Maximum number of nodes scraped at the same time. Other nodes wait for a free slot, reported by the metrics_server_scraper_queue_depth metric. Zero means unlimited.")
+	msfs.DurationVar(&o.ScrapeBudgetBase, "scrape-budget-base", o.ScrapeBudgetBase, "Base of scrape timeout computed from the number of nodes, see --scrape-budget-per-node.")
+	msfs.DurationVar(&o.ScrapeBudgetPerNode, "scrape-budget-per-node", o.ScrapeBudgetPerNode, "Scrape timeout added for each scraped node to --scrape-budget-base, up to --metric-resolution, instead of using --kubelet-request-timeout. Re-evaluated when the number of nodes changes by more than 10%. Zero disables it.")
+	msfs.IntVar(&o.MaxNodesPerCycle, "max-nodes-per-cycle", o.MaxNodesPerCycle, "Maximum number of nodes scraped in a single metric-resolution cycle. Nodes are scraped round-robin across cycles, reporting last scraped metrics in between, so usage of each node is refreshed less frequently. Zero means unlimited.")
+	msfs.StringVar(&o.PodSkipAnnotation, "pod-skip-annotation", o.PodSkipAnnotation, "Annotation excluding pods carrying it from pod metrics served by the Metrics API, e.g. for privacy-sensitive workloads. Empty serves metrics of all pods.")
+	msfs.IntVar(&o.ListParallelism, "list-parallelism", o.ListParallelism, "Number of workers concurrently reading metrics of large pod lists, e.g. cluster-wide lists on big clusters, using multiple cores. Values below 2 read them serially.")
+	msfs.BoolVar(&o.VersionAnnotation, "version-annotation", o.VersionAnnotation, "Annotate served node and pod metrics with metrics-server.io/version holding version of metrics server serving them, so tooling can tell which version is serving.")
+	msfs.BoolVar(&o.NodeAgeAnnotation, "node-age-annotation", o.NodeAgeAnnotation, "Annotate served node metrics with metrics-server.io/age holding age of their points, as window only describes the period usage rate was calculated over, e.g. for nodes scraped off-cycle.")
+	msfs.BoolVar(&o.PodsMissingInInformer, "serve-pods-missing-in-informer", o.PodsMissingInInformer, "Serve metrics stored for pods not yet known to pod informer, e.g. lagging behind scrapes, with metadata limited to pod name and namespace, instead of responding not found. Counted by metrics_server_api_pods_missing_in_informer_total.")
+	msfs.DurationVar(&o.StaleAfter, "annotate-stale-after", o.StaleAfter, "The age after which served node and pod metrics are annotated with metrics-server.io/stale and metrics-server.io/stale-age, so clients can decide whether to use them. Zero disables it.")
+	msfs.StringVar(&o.ClusterName, "cluster-name", o.ClusterName, "Name of the cluster attached to scraped metrics batches, used by sinks aggregating metrics from multiple clusters. Not exposed via the Metrics API.")
+
+	pfs.BoolVar(&o.ExplainMissingPodMetrics, "explain-missing-pod-metrics", o.ExplainMissingPodMetrics, "Explain missing pod metrics (e.g. pod has no running containers) based on pod status.")
+	pfs.BoolVar(&o.PendingPodsAsZero, "report-pending-pods-as-zero", o.PendingPodsAsZero, "Report pods without metrics that are pending with no container started with zero usage and empty window, instead of omitting them.")
+	pfs.BoolVar(&o.CPURequestUtilization, "cpu-request-utilization-annotation", o.CPURequestUtilization, "Annotate pod metrics with CPU usage of containers relative to their CPU request, e.g. for right-sizing tools. Containers without CPU request are omitted.")
+	pfs.BoolVar(&o.ExcludeEphemeral, "exclude-ephemeral-containers", o.ExcludeEphemeral, "Exclude ephemeral containers, e.g. debug containers, from pod metrics, so they don't count toward pod usage for autoscaling.")
+	pfs.BoolVar(&o.ExcludeInitContainers, "exclude-init-containers", o.ExcludeInitContainers, "Exclude init containers, including sidecar containers, from pod metrics.")
+	pfs.StringVar(&o.ScrapePodSelector, "scrape-pod-selector", o.ScrapePodSelector, "Selector (label query) of pods, restricting scraping to nodes hosting at least one running pod matching it. Empty scrapes all nodes.")
+	pfs.BoolVar(&o.PodNodeNameSelector, "pod-node-name-selector", o.PodNodeNameSelector, "Support filtering pod metrics by spec.nodeName field selector, e.g. 'kubectl get podmetrics --field-selector spec.nodeName=node1', based on node assignment of running pods.")
 
 	o.GenericServerRunOptions.AddUniversalFlags(fs.FlagSet("generic"))
 	o.KubeletClient.AddFlags(fs.FlagSet("kubelet client"))
@@ -110,7 +240,22 @@ func NewOptions() *Options {
 		Logging:                 logs.NewOptions(),
 
 		MetricResolution: 60 * time.Second,
+		MinStartTimeAge:  storage.DefaultWarmupPolicy().MinStartTimeAge,
+		StartTimeWindows: storage.DefaultWarmupPolicy().StartTimeWindows,
+	}
+}
+
+// warmupPolicy returns the policy governing when stored points are enough to serve usage.
+func (o Options) warmupPolicy() storage.WarmupPolicy {
+	policy := storage.WarmupPolicy{
+		MinStartTimeAge:  o.MinStartTimeAge,
+		StartTimeWindows: o.StartTimeWindows,
+		RequiredSamples:  2,
+	}
+	if o.SingleCycleWarmup {
+		policy.RequiredSamples = 1
 	}
+	return policy
 }
 
 func (o Options) ServerConfig() (*server.Config, error) {
@@ -122,13 +267,54 @@ func (o Options) ServerConfig() (*server.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	kubeletRestConfig, err := o.KubeletClient.RestConfig(restConfig, o.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
 	return &server.Config{
-		Apiserver:        apiserver,
-		Rest:             restConfig,
-		Kubelet:          o.KubeletClient.Config(restConfig),
-		MetricResolution: o.MetricResolution,
-		ScrapeTimeout:    o.KubeletClient.KubeletRequestTimeout,
-		NodeSelector:     o.KubeletClient.NodeSelector,
+		Apiserver:                apiserver,
+		Rest:                     restConfig,
+		Kubelet:                  o.KubeletClient.Config(kubeletRestConfig),
+		MetricResolution:         o.MetricResolution,
+		ScrapeTimeout:            o.KubeletClient.KubeletRequestTimeout,
+		NodeSelector:             o.KubeletClient.NodeSelector,
+		ClusterName:              o.ClusterName,
+		NodePodSumDiff:           o.NodePodSumDiff,
+		ListCacheTTL:             o.ListCacheTTL,
+		ExplainMissingPodMetrics: o.ExplainMissingPodMetrics,
+		NodeRelistInterval:       o.NodeRelistInterval,
+		EnableStorageReset:       o.EnableStorageReset,
+		EnableLatestPoints:       o.EnableLatestPoints,
+		EnablePodContainers:      o.EnablePodContainers,
+		ReadinessGracePeriod:     o.ReadinessGracePeriod,
+		DefaultWindow:            o.DefaultWindow,
+		ExcludeInitContainers:    o.ExcludeInitContainers,
+		ExcludeEphemeral:         o.ExcludeEphemeral,
+		CPURequestUtilization:    o.CPURequestUtilization,
+		PendingPodsAsZero:        o.PendingPodsAsZero,
+		MetricsNamespace:         o.MetricsNamespace,
+		MetricsSubsystemPrefix:   o.MetricsSubsystemPrefix,
+		PodEvictionTTL:           o.PodEvictionTTL,
+		TopPort:                  o.TopPort,
+		ResponseCompressionLevel: o.ResponseCompressionLevel,
+		CPUEWMAAlpha:             o.CPUEWMAAlpha,
+		PodUIDAnnotation:         o.PodUIDAnnotation,
+		ScrapePodSelector:        o.ScrapePodSelector,
+		WarmupPolicy:             o.warmupPolicy(),
+		NodeMetricsLabels:        o.NodeMetricsLabels,
+		MaxNodesPerCycle:         o.MaxNodesPerCycle,
+		PodNodeNameSelector:      o.PodNodeNameSelector,
+		PodSkipAnnotation:        o.PodSkipAnnotation,
+		StaleAfter:               o.StaleAfter,
+		VersionAnnotation:        o.VersionAnnotation,
+		NodeAgeAnnotation:        o.NodeAgeAnnotation,
+		PodsMissingInInformer:    o.PodsMissingInInformer,
+		ListParallelism:          o.ListParallelism,
+		MaxConcurrentScrapes:     o.MaxConcurrentScrapes,
+		ScrapeWorkers:            o.ScrapeWorkers,
+		ScrapeBudgetBase:         o.ScrapeBudgetBase,
+		ScrapeBudgetPerNode:      o.ScrapeBudgetPerNode,
+		RefreshStaleNodesAfter:   o.RefreshStaleNodesAfter,
 	}, nil
 }
 
@@ -44,6 +44,26 @@ func TestOptions_validate(t *testing.T) {
 			},
 			expectedErrorCount: 1,
 		},
+		{
+			name: "can not give --list-cache-ttl equal to --metric-resolution",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				ListCacheTTL:     10 * time.Second,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give negative --min-start-time-age",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				MinStartTimeAge:  -time.Second,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			errors := tc.options.validate()
@@ -0,0 +1,103 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"sync"
+	"time"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// listCache caches assembled List responses for a short time to absorb bursts
+// of identical requests. Entries are dropped when new metrics are stored.
+// Nil listCache is valid and never caches.
+type listCache struct {
+	ttl        time.Duration
+	generation GenerationGetter
+
+	mu                sync.Mutex
+	entries           map[string]listCacheEntry
+	entriesGeneration uint64
+}
+
+type listCacheEntry struct {
+	object  runtime.Object
+	expires time.Time
+}
+
+func newListCache(ttl time.Duration, generation GenerationGetter) *listCache {
+	return &listCache{
+		ttl:        ttl,
+		generation: generation,
+		entries:    make(map[string]listCacheEntry),
+	}
+}
+
+func (c *listCache) get(key string) (runtime.Object, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateIfStored()
+	entry, found := c.entries[key]
+	if !found || !myClock.Now().Before(entry.expires) {
+		return nil, false
+	}
+	// Returned object can be modified by caller, so a copy is handed out.
+	return entry.object.DeepCopyObject(), true
+}
+
+func (c *listCache) set(key string, object runtime.Object) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateIfStored()
+	now := myClock.Now()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = listCacheEntry{object: object.DeepCopyObject(), expires: now.Add(c.ttl)}
+}
+
+// invalidateIfStored drops all entries if new metrics were stored since they were cached.
+func (c *listCache) invalidateIfStored() {
+	if c.generation == nil {
+		return
+	}
+	generation := c.generation.Generation()
+	if generation != c.entriesGeneration {
+		c.entries = make(map[string]listCacheEntry)
+		c.entriesGeneration = generation
+	}
+}
+
+func listCacheKey(namespace string, options *metainternalversion.ListOptions) string {
+	key := namespace + "/"
+	if options != nil && options.LabelSelector != nil {
+		key += options.LabelSelector.String()
+	}
+	key += "/"
+	if options != nil && options.FieldSelector != nil {
+		key += options.FieldSelector.String()
+	}
+	return key
+}
@@ -20,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apiserver/pkg/registry/generic"
+	v1listers "k8s.io/client-go/listers/core/v1"
 )
 
 func filterNodes(nodes []*v1.Node, selector fields.Selector) []*v1.Node {
@@ -53,3 +54,26 @@ func filterPartialObjectMetadata(objs []runtime.Object, selector fields.Selector
 	}
 	return newObjs
 }
+
+// filterPodsWithNodeName filters pods like filterPartialObjectMetadata, additionally matching spec.nodeName
+// of pods as assigned in the given lister. Pods missing in the lister have empty node name.
+func filterPodsWithNodeName(objs []runtime.Object, selector fields.Selector, podLister v1listers.PodLister) []runtime.Object {
+	newObjs := make([]runtime.Object, 0, len(objs))
+	fields := make(fields.Set, 3)
+	for _, obj := range objs {
+		for k := range fields {
+			delete(fields, k)
+		}
+		meta := &obj.(*metav1.PartialObjectMetadata).ObjectMeta
+		fieldsSet := generic.AddObjectMetaFieldsSet(fields, meta, true)
+		fieldsSet["spec.nodeName"] = ""
+		if pod, err := podLister.Pods(meta.Namespace).Get(meta.Name); err == nil {
+			fieldsSet["spec.nodeName"] = pod.Spec.NodeName
+		}
+		if !selector.Matches(fieldsSet) {
+			continue
+		}
+		newObjs = append(newObjs, obj)
+	}
+	return newObjs
+}
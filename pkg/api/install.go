@@ -15,6 +15,8 @@
 package api
 
 import (
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -53,10 +55,197 @@ func Build(pod, node rest.Storage) genericapiserver.APIGroupInfo {
 	return apiGroupInfo
 }
 
+// Option configures optional behavior of the metrics.k8s.io API.
+type Option func(*installOptions)
+
+type installOptions struct {
+	listCacheTTL    time.Duration
+	listWorkers     int
+	podStatusLister corev1.PodLister
+	podSpecLister   corev1.PodLister
+	// ephemeralSpecLister provides pod spec identifying ephemeral containers to exclude.
+	ephemeralSpecLister corev1.PodLister
+	// pendingPodLister provides pod status identifying pending pods to report with zero usage.
+	pendingPodLister corev1.PodLister
+	// cpuRequestLister provides pod spec with CPU requests of containers to annotate utilization.
+	cpuRequestLister corev1.PodLister
+	podUIDAnnotation bool
+	nodeLabels       []string
+	podNodeLister    corev1.PodLister
+	// podSkipAnnotation excludes pods carrying it from pod metrics.
+	podSkipAnnotation string
+	staleAfter        time.Duration
+	version           string
+	nodeAgeAnnotation bool
+	refreshAfter      time.Duration
+	refreshNode       func(name string)
+	// servePodsMissingInInformer serves metrics stored for pods missing in pod informer.
+	servePodsMissingInInformer bool
+}
+
+// WithListCache enables caching List responses for the given time. Cached responses
+// are dropped earlier when new metrics are stored, if MetricsGetter implements GenerationGetter.
+func WithListCache(ttl time.Duration) Option {
+	return func(o *installOptions) {
+		o.listCacheTTL = ttl
+	}
+}
+
+// WithPodStatusLister enables explaining missing pod metrics based on pod status
+// provided by the given lister.
+func WithPodStatusLister(podStatusLister corev1.PodLister) Option {
+	return func(o *installOptions) {
+		o.podStatusLister = podStatusLister
+	}
+}
+
+// WithoutInitContainers excludes metrics of init containers from pod metrics,
+// identifying them based on pod spec provided by the given lister.
+func WithoutInitContainers(podSpecLister corev1.PodLister) Option {
+	return func(o *installOptions) {
+		o.podSpecLister = podSpecLister
+	}
+}
+
+// WithoutEphemeralContainers excludes metrics of ephemeral containers, e.g. debug containers, from pod metrics,
+// identifying them based on pod spec provided by the given lister.
+func WithoutEphemeralContainers(podSpecLister corev1.PodLister) Option {
+	return func(o *installOptions) {
+		o.ephemeralSpecLister = podSpecLister
+	}
+}
+
+// WithPendingPodsAsZero reports pods without metrics that are pending with no container started
+// with zero usage and empty window, based on pod status provided by the given lister.
+func WithPendingPodsAsZero(podStatusLister corev1.PodLister) Option {
+	return func(o *installOptions) {
+		o.pendingPodLister = podStatusLister
+	}
+}
+
+// WithCPURequestUtilization annotates pod metrics with CPU usage of containers relative to their CPU request,
+// based on pod spec provided by the given lister. See AnnotationCPURequestUtilization.
+func WithCPURequestUtilization(podSpecLister corev1.PodLister) Option {
+	return func(o *installOptions) {
+		o.cpuRequestLister = podSpecLister
+	}
+}
+
+// WithPodUIDAnnotation annotates pod metrics with UID of the pod, allowing clients to track pods
+// across name reuse. See AnnotationPodUID.
+func WithPodUIDAnnotation() Option {
+	return func(o *installOptions) {
+		o.podUIDAnnotation = true
+	}
+}
+
+// WithNodeLabels restricts node labels copied to node metrics to the given keys.
+func WithNodeLabels(keys []string) Option {
+	return func(o *installOptions) {
+		o.nodeLabels = keys
+	}
+}
+
+// WithPodNodeNameSelector enables filtering pod metrics by spec.nodeName field selector,
+// based on node assignment of pods provided by the given lister.
+func WithPodNodeNameSelector(podLister corev1.PodLister) Option {
+	return func(o *installOptions) {
+		o.podNodeLister = podLister
+	}
+}
+
+// WithPodSkipAnnotation excludes pods carrying the given annotation from pod metrics, e.g. privacy-sensitive pods.
+func WithPodSkipAnnotation(key string) Option {
+	return func(o *installOptions) {
+		o.podSkipAnnotation = key
+	}
+}
+
+// WithStaleAnnotation annotates node and pod metrics older than the given age as stale,
+// together with their age, so clients can decide whether to use them.
+func WithStaleAnnotation(after time.Duration) Option {
+	return func(o *installOptions) {
+		o.staleAfter = after
+	}
+}
+
+// WithVersionAnnotation annotates node and pod metrics with the given metrics server version,
+// so clients can tell which version is serving them.
+func WithVersionAnnotation(version string) Option {
+	return func(o *installOptions) {
+		o.version = version
+	}
+}
+
+// WithNodeAgeAnnotation annotates node metrics with age of their points when served, as the window only
+// describes the period usage rate was calculated over, not how fresh the metrics are.
+func WithNodeAgeAnnotation() Option {
+	return func(o *installOptions) {
+		o.nodeAgeAnnotation = true
+	}
+}
+
+// WithPodsMissingInInformer serves Get requests for pods missing in pod informer, e.g. lagging behind storage,
+// with stored metrics and metadata limited to pod name and namespace, instead of not found error.
+func WithPodsMissingInInformer() Option {
+	return func(o *installOptions) {
+		o.servePodsMissingInInformer = true
+	}
+}
+
+// WithListParallelism reads metrics of large pod lists, e.g. cluster-wide ones, using up to the given number
+// of concurrent workers. Values below 2 read them serially.
+func WithListParallelism(workers int) Option {
+	return func(o *installOptions) {
+		o.listWorkers = workers
+	}
+}
+
+// WithStaleNodeRefresh calls refresh with name of each node whose served metrics are older than the given age,
+// allowing to re-scrape the node so following requests get fresh metrics. Calls are not rate limited.
+func WithStaleNodeRefresh(after time.Duration, refresh func(name string)) Option {
+	return func(o *installOptions) {
+		o.refreshAfter = after
+		o.refreshNode = refresh
+	}
+}
+
 // Install builds the metrics for the metrics.k8s.io API, and then installs it into the given API metrics-server.
-func Install(m MetricsGetter, podMetadataLister cache.GenericLister, nodeLister corev1.NodeLister, server *genericapiserver.GenericAPIServer, nodeSelector []labels.Requirement) error {
+func Install(m MetricsGetter, podMetadataLister cache.GenericLister, nodeLister corev1.NodeLister, server *genericapiserver.GenericAPIServer, nodeSelector []labels.Requirement, opts ...Option) error {
+	o := &installOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	node := newNodeMetrics(metrics.Resource("nodemetrics"), m, nodeLister, nodeSelector)
+	node.labels = o.nodeLabels
+	node.staleAfter = o.staleAfter
+	node.version = o.version
+	node.ageAnnotation = o.nodeAgeAnnotation
+	node.refreshAfter = o.refreshAfter
+	node.refreshNode = o.refreshNode
 	pod := newPodMetrics(metrics.Resource("podmetrics"), m, podMetadataLister)
+	pod.podStatusLister = o.podStatusLister
+	pod.podSpecLister = o.podSpecLister
+	pod.ephemeralSpecLister = o.ephemeralSpecLister
+	pod.pendingPodLister = o.pendingPodLister
+	pod.cpuRequestLister = o.cpuRequestLister
+	pod.podUIDAnnotation = o.podUIDAnnotation
+	pod.podNodeLister = o.podNodeLister
+	pod.skipAnnotation = o.podSkipAnnotation
+	pod.staleAfter = o.staleAfter
+	pod.version = o.version
+	pod.serveMissingInInformer = o.servePodsMissingInInformer
+	readiness, _ := m.(ReadinessGetter)
+	node.readiness = readiness
+	pod.readiness = readiness
+	if o.listWorkers > 1 {
+		pod.metrics = NewParallelPodMetricsGetter(m, o.listWorkers)
+	}
+	if o.listCacheTTL > 0 {
+		generation, _ := m.(GenerationGetter)
+		node.cache = newListCache(o.listCacheTTL, generation)
+		pod.cache = newListCache(o.listCacheTTL, generation)
+	}
 	info := Build(pod, node)
 	return server.InstallAPIGroup(&info)
 }
@@ -59,3 +59,15 @@ type NodeMetricsGetter interface {
 	// returning both the metrics and the associated collection timestamp.
 	GetNodeMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics, error)
 }
+
+// ReadinessGetter knows whether enough metrics were collected to serve them.
+type ReadinessGetter interface {
+	// Ready returns true after metrics were collected long enough to serve them, e.g. to calculate CPU usage.
+	Ready() bool
+}
+
+// GenerationGetter knows how to report changes of stored metrics.
+type GenerationGetter interface {
+	// Generation returns a number that changes each time new metrics are stored.
+	Generation() uint64
+}
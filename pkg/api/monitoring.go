@@ -15,24 +15,99 @@
 package api
 
 import (
+	"time"
+
 	"k8s.io/component-base/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 var (
+	// definedPrefix is the prefix metrics were last defined with.
+	definedPrefix         utils.MetricsPrefix
+	metricFreshness       *metrics.HistogramVec
+	requestDuration       *metrics.HistogramVec
+	emptyResponses        *metrics.CounterVec
+	podsMissingInInformer *metrics.CounterVec
+)
+
+func init() {
+	defineMetrics(utils.MetricsPrefix{})
+}
+
+// defineMetrics defines metrics of the package with names prefixed with prefix.
+func defineMetrics(prefix utils.MetricsPrefix) {
+	definedPrefix = prefix
 	metricFreshness = metrics.NewHistogramVec(
 		&metrics.HistogramOpts{
-			Namespace: "metrics_server",
-			Subsystem: "api",
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("api"),
 			Name:      "metric_freshness_seconds",
 			Help:      "Freshness of metrics exported",
 			Buckets:   metrics.ExponentialBuckets(1, 1.364, 20),
 		},
 		[]string{},
 	)
-)
+	requestDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("api"),
+			Name:      "request_duration_seconds",
+			Help:      "Duration of serving Metrics API requests in seconds",
+			Buckets:   metrics.DefBuckets,
+		},
+		[]string{"verb", "resource"},
+	)
+	emptyResponses = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("api"),
+			Name:      "empty_response_total",
+			Help:      "Number of List requests served with no metrics, by phase: warmup before storage is ready, steady after",
+		},
+		[]string{"phase"},
+	)
+	podsMissingInInformer = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("api"),
+			Name:      "pods_missing_in_informer_total",
+			Help:      "Number of Get requests served with metrics stored for pods missing in informer",
+		},
+		[]string{},
+	)
+}
+
+// RegisterAPIMetrics registers histogram metrics for the freshness of
+// exported metrics and duration of serving requests, and counters of empty responses and pods missing in informer.
+func RegisterAPIMetrics(registrationFunc func(metrics.Registerable) error, prefix utils.MetricsPrefix) error {
+	if prefix != definedPrefix {
+		defineMetrics(prefix)
+	}
+	for _, metric := range []metrics.Registerable{
+		metricFreshness,
+		requestDuration,
+		emptyResponses,
+		podsMissingInInformer,
+	} {
+		err := registrationFunc(metric)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func observeRequestDuration(verb, resource string, startTime time.Time) {
+	requestDuration.WithLabelValues(verb, resource).Observe(myClock.Since(startTime).Seconds())
+}
 
-// RegisterAPIMetrics registers a histogram metric for the freshness of
-// exported metrics.
-func RegisterAPIMetrics(registrationFunc func(metrics.Registerable) error) error {
-	return registrationFunc(metricFreshness)
+// observeEmptyResponse counts empty List response, as served during warm-up if readiness reports storage as not ready.
+// Nil readiness is considered ready.
+func observeEmptyResponse(readiness ReadinessGetter) {
+	phase := "steady"
+	if readiness != nil && !readiness.Ready() {
+		phase = "warmup"
+	}
+	emptyResponses.WithLabelValues(phase).Inc()
 }
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -34,11 +35,29 @@ import (
 	_ "k8s.io/metrics/pkg/apis/metrics/install"
 )
 
+// AnnotationApproximateMemory is the annotation of NodeMetrics marking memory usage approximated from memory usage
+// of pods running on the node, as Kubelet didn't report it.
+const AnnotationApproximateMemory = "metrics-server.io/approximate-memory"
+
 type nodeMetrics struct {
 	groupResource schema.GroupResource
 	metrics       NodeMetricsGetter
 	nodeLister    v1listers.NodeLister
 	nodeSelector  []labels.Requirement
+	cache         *listCache
+	// labels restricts node labels copied to node metrics, nil means all labels.
+	labels []string
+	// staleAfter is the age after which node metrics are annotated as stale, zero disables it.
+	staleAfter time.Duration
+	// refreshNode is called with nodes whose metrics are older than refreshAfter, if set.
+	refreshAfter time.Duration
+	refreshNode  func(name string)
+	// version is the metrics server version node metrics are annotated with, empty disables it.
+	version string
+	// ageAnnotation enables annotating node metrics with age of their points.
+	ageAnnotation bool
+	// readiness distinguishes empty responses during warm-up. Nil considers storage ready.
+	readiness ReadinessGetter
 }
 
 var _ rest.KindProvider = &nodeMetrics{}
@@ -79,6 +98,12 @@ func (m *nodeMetrics) NewList() runtime.Object {
 
 // List implements rest.Lister interface
 func (m *nodeMetrics) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	defer observeRequestDuration("list", "nodes", myClock.Now())
+	key := listCacheKey("", options)
+	if list, found := m.cache.get(key); found {
+		withRequestedNodeResources(ctx, list.(*metrics.NodeMetricsList).Items)
+		return list, nil
+	}
 	nodes, err := m.nodes(ctx, options)
 	if err != nil {
 		return &metrics.NodeMetricsList{}, err
@@ -89,7 +114,13 @@ func (m *nodeMetrics) List(ctx context.Context, options *metainternalversion.Lis
 		klog.ErrorS(err, "Failed reading nodes metrics")
 		return &metrics.NodeMetricsList{}, fmt.Errorf("failed reading nodes metrics: %w", err)
 	}
-	return &metrics.NodeMetricsList{Items: ms}, nil
+	if len(ms) == 0 {
+		observeEmptyResponse(m.readiness)
+	}
+	list := &metrics.NodeMetricsList{Items: ms}
+	m.cache.set(key, list)
+	withRequestedNodeResources(ctx, list.Items)
+	return list, nil
 }
 
 func (m *nodeMetrics) nodes(ctx context.Context, options *metainternalversion.ListOptions) ([]*corev1.Node, error) {
@@ -113,6 +144,7 @@ func (m *nodeMetrics) nodes(ctx context.Context, options *metainternalversion.Li
 
 // Get implements rest.Getter interface
 func (m *nodeMetrics) Get(ctx context.Context, name string, opts *metav1.GetOptions) (runtime.Object, error) {
+	defer observeRequestDuration("get", "nodes", myClock.Now())
 	node, err := m.nodeLister.Get(name)
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -133,6 +165,7 @@ func (m *nodeMetrics) Get(ctx context.Context, name string, opts *metav1.GetOpti
 	if len(ms) == 0 {
 		return nil, errors.NewNotFound(m.groupResource, name)
 	}
+	withRequestedNodeResources(ctx, ms)
 	return &ms[0], nil
 }
 
@@ -161,8 +194,32 @@ func (m *nodeMetrics) getMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics,
 	if err != nil {
 		return nil, err
 	}
-	for _, m := range ms {
-		metricFreshness.WithLabelValues().Observe(myClock.Since(m.Timestamp.Time).Seconds())
+	for _, nm := range ms {
+		age := myClock.Since(nm.Timestamp.Time)
+		metricFreshness.WithLabelValues().Observe(age.Seconds())
+		if m.refreshNode != nil && age > m.refreshAfter {
+			m.refreshNode(nm.Name)
+		}
+	}
+	if m.staleAfter > 0 {
+		for i := range ms {
+			ms[i].Annotations = annotateStale(ms[i].Annotations, ms[i].Timestamp.Time, m.staleAfter)
+		}
+	}
+	if m.version != "" {
+		for i := range ms {
+			ms[i].Annotations = annotateVersion(ms[i].Annotations, m.version)
+		}
+	}
+	if m.ageAnnotation {
+		for i := range ms {
+			ms[i].Annotations = annotateAge(ms[i].Annotations, ms[i].Timestamp.Time)
+		}
+	}
+	if m.labels != nil {
+		for i := range ms {
+			ms[i].Labels = allowedLabels(ms[i].Labels, m.labels)
+		}
 	}
 	// maintain the same ordering invariant as the Kube API would over nodes
 	sort.Slice(ms, func(i, j int) bool {
@@ -171,6 +228,17 @@ func (m *nodeMetrics) getMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics,
 	return ms, nil
 }
 
+// allowedLabels returns a copy of labels with only the given keys, leaving labels shared with lister intact.
+func allowedLabels(labels map[string]string, keys []string) map[string]string {
+	allowed := map[string]string{}
+	for _, key := range keys {
+		if value, found := labels[key]; found {
+			allowed[key] = value
+		}
+	}
+	return allowed
+}
+
 // NamespaceScoped implements rest.Scoper interface
 func (m *nodeMetrics) NamespaceScoped() bool {
 	return false
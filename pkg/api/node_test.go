@@ -171,6 +171,169 @@ func TestNodeGet(t *testing.T) {
 	}
 }
 
+func TestNodeList_Labels(t *testing.T) {
+	tcs := []struct {
+		name       string
+		labels     []string
+		wantLabels map[string]map[string]string
+	}{
+		{
+			name: "All labels are copied by default",
+			wantLabels: map[string]map[string]string{
+				"node1": {"labelKey": "labelValue"},
+				"node2": {"otherKey": "labelValue"},
+				"node3": {"labelKey": "otherValue"},
+			},
+		},
+		{
+			name:   "Only allowlisted labels are copied",
+			labels: []string{"labelKey"},
+			wantLabels: map[string]map[string]string{
+				"node1": {"labelKey": "labelValue"},
+				"node2": {},
+				"node3": {"labelKey": "otherValue"},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewTestNodeStorage(nil)
+			r.labels = tc.labels
+
+			got, err := r.List(genericapirequest.NewContext(), nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			gotLabels := map[string]map[string]string{}
+			for _, node := range got.(*metrics.NodeMetricsList).Items {
+				gotLabels[node.Name] = node.Labels
+			}
+			if diff := cmp.Diff(tc.wantLabels, gotLabels); diff != "" {
+				t.Errorf("Unexpected labels, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestNodeList_StaleAnnotation(t *testing.T) {
+	c := &fakeClock{}
+	myClock = c
+	r := NewTestNodeStorage(nil)
+
+	for _, tc := range []struct {
+		name            string
+		staleAfter      time.Duration
+		age             time.Duration
+		wantAnnotations map[string]string
+	}{
+		{
+			name: "Disabled by default",
+			age:  time.Minute,
+		},
+		{
+			name:       "Fresh metrics are not annotated",
+			staleAfter: 30 * time.Second,
+			age:        10 * time.Second,
+		},
+		{
+			name:            "Stale metrics are annotated with age",
+			staleAfter:      30 * time.Second,
+			age:             90 * time.Second,
+			wantAnnotations: map[string]string{AnnotationStale: "true", AnnotationStaleAge: "1m30s"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r.staleAfter = tc.staleAfter
+			c.now = r.metrics.(fakeNodeMetricsGetter).now.Add(tc.age)
+
+			got, err := r.Get(genericapirequest.NewContext(), "node1", nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantAnnotations, got.(*metrics.NodeMetrics).Annotations); diff != "" {
+				t.Errorf("Unexpected annotations, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestNodeList_AgeAnnotation(t *testing.T) {
+	c := &fakeClock{}
+	myClock = c
+	r := NewTestNodeStorage(nil)
+	r.ageAnnotation = true
+	c.now = r.metrics.(fakeNodeMetricsGetter).now.Add(12500 * time.Millisecond)
+
+	got, err := r.List(genericapirequest.NewContext(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res := got.(*metrics.NodeMetricsList)
+	if len(res.Items) != 3 {
+		t.Fatalf("len(res.Items) != 3, got: %d", len(res.Items))
+	}
+	for _, node := range res.Items {
+		if node.Annotations[AnnotationAge] != "12.5s" {
+			t.Errorf("Expected node %s to be annotated with age 12.5s, got annotations: %v", node.Name, node.Annotations)
+		}
+	}
+	if res.Items[0].Window.Duration != 1000 {
+		t.Errorf("Expected window to be independent of age, got: %v", res.Items[0].Window.Duration)
+	}
+}
+
+func TestNodeGet_VersionAnnotation(t *testing.T) {
+	r := NewTestNodeStorage(nil)
+	r.version = "v0.8.0"
+
+	got, err := r.Get(genericapirequest.NewContext(), "node1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(map[string]string{AnnotationVersion: "v0.8.0"}, got.(*metrics.NodeMetrics).Annotations); diff != "" {
+		t.Errorf("Unexpected annotations, diff: %s", diff)
+	}
+}
+
+func TestNodeList_StaleRefresh(t *testing.T) {
+	c := &fakeClock{}
+	myClock = c
+	r := NewTestNodeStorage(nil)
+
+	for _, tc := range []struct {
+		name          string
+		age           time.Duration
+		wantRefreshed []string
+	}{
+		{
+			name: "Fresh metrics don't trigger refresh",
+			age:  10 * time.Second,
+		},
+		{
+			name:          "Stale metrics trigger refresh of the node",
+			age:           90 * time.Second,
+			wantRefreshed: []string{"node1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var refreshed []string
+			r.refreshAfter = 30 * time.Second
+			r.refreshNode = func(name string) {
+				refreshed = append(refreshed, name)
+			}
+			c.now = r.metrics.(fakeNodeMetricsGetter).now.Add(tc.age)
+
+			_, err := r.Get(genericapirequest.NewContext(), "node1", nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantRefreshed, refreshed); diff != "" {
+				t.Errorf("Unexpected refreshed nodes, diff: %s", diff)
+			}
+		})
+	}
+}
+
 func TestNodeList_Monitoring(t *testing.T) {
 	c := &fakeClock{}
 	myClock = c
@@ -217,6 +380,58 @@ func TestNodeList_Monitoring(t *testing.T) {
 	}
 }
 
+func TestNodeList_EmptyResponseMonitoring(t *testing.T) {
+	tcs := []struct {
+		name      string
+		readiness ReadinessGetter
+		want      string
+	}{
+		{
+			name:      "Storage not ready",
+			readiness: fakeReadiness(false),
+			want:      "warmup",
+		},
+		{
+			name:      "Storage ready",
+			readiness: fakeReadiness(true),
+			want:      "steady",
+		},
+		{
+			name: "Readiness unknown",
+			want: "steady",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			emptyResponses.Create(nil)
+			emptyResponses.Reset()
+
+			r := NewTestNodeStorage(nil)
+			r.nodeLister = fakeNodeLister{}
+			r.readiness = tc.readiness
+			_, err := r.List(genericapirequest.NewContext(), nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			err = testutil.CollectAndCompare(emptyResponses, strings.NewReader(fmt.Sprintf(`
+	# HELP metrics_server_api_empty_response_total [ALPHA] Number of List requests served with no metrics, by phase: warmup before storage is ready, steady after
+	# TYPE metrics_server_api_empty_response_total counter
+	metrics_server_api_empty_response_total{phase=%q} 1
+	`, tc.want)), "metrics_server_api_empty_response_total")
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+type fakeReadiness bool
+
+func (r fakeReadiness) Ready() bool {
+	return bool(r)
+}
+
 // fakes both PodLister and PodNamespaceLister at once
 type fakeNodeLister struct {
 	data []*corev1.Node
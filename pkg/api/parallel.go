@@ -0,0 +1,71 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// parallelMinPodsPerShard is the minimal number of pods read by a single worker, as reading smaller shards
+// concurrently costs more than it saves.
+var parallelMinPodsPerShard = 500
+
+// parallelPodMetrics reads metrics of large pod lists in shards, concurrently by up to workers goroutines.
+type parallelPodMetrics struct {
+	PodMetricsGetter
+	workers int
+}
+
+// NewParallelPodMetricsGetter returns getter reading metrics of large pod lists using up to workers goroutines,
+// speeding up cluster-wide lists. The given getter must be safe for concurrent use.
+func NewParallelPodMetricsGetter(getter PodMetricsGetter, workers int) PodMetricsGetter {
+	return parallelPodMetrics{PodMetricsGetter: getter, workers: workers}
+}
+
+func (p parallelPodMetrics) GetPodMetrics(pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
+	if p.workers < 2 || len(pods) <= parallelMinPodsPerShard {
+		return p.PodMetricsGetter.GetPodMetrics(pods...)
+	}
+	shardSize := max((len(pods)+p.workers-1)/p.workers, parallelMinPodsPerShard)
+	var (
+		wg      sync.WaitGroup
+		results = make([][]metrics.PodMetrics, (len(pods)+shardSize-1)/shardSize)
+		errs    = make([]error, len(results))
+	)
+	for i := range results {
+		shard := pods[i*shardSize : min((i+1)*shardSize, len(pods))]
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = p.PodMetricsGetter.GetPodMetrics(shard...)
+		}(i)
+	}
+	wg.Wait()
+	total := 0
+	for i := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		total += len(results[i])
+	}
+	ms := make([]metrics.PodMetrics, 0, total)
+	for _, r := range results {
+		ms = append(ms, r...)
+	}
+	return ms, nil
+}
@@ -18,27 +18,60 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	metav1beta1 "k8s.io/apimachinery/pkg/apis/meta/v1beta1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	apitypes "k8s.io/apimachinery/pkg/types"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/rest"
+	v1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"k8s.io/metrics/pkg/apis/metrics"
 	_ "k8s.io/metrics/pkg/apis/metrics/install"
 )
 
+// AnnotationPodUID is the annotation of PodMetrics holding UID of the pod, allowing to track pods across name reuse.
+const AnnotationPodUID = "metrics.k8s.io/pod-uid"
+
 type podMetrics struct {
 	groupResource schema.GroupResource
 	metrics       PodMetricsGetter
 	podLister     cache.GenericLister
+	cache         *listCache
+	// podStatusLister is used to explain missing pod metrics. Nil disables it.
+	podStatusLister v1listers.PodLister
+	// podSpecLister is used to exclude init containers from pod metrics. Nil includes them.
+	podSpecLister v1listers.PodLister
+	// ephemeralSpecLister is used to exclude ephemeral containers from pod metrics. Nil includes them.
+	ephemeralSpecLister v1listers.PodLister
+	// pendingPodLister is used to report pending pods without metrics with zero usage. Nil disables it.
+	pendingPodLister v1listers.PodLister
+	// cpuRequestLister is used to annotate pod metrics with CPU request utilization of containers. Nil disables it.
+	cpuRequestLister v1listers.PodLister
+	// podUIDAnnotation enables annotating pod metrics with pod UID.
+	podUIDAnnotation bool
+	// podNodeLister is used to filter pods by spec.nodeName field selector. Nil matches only empty node name.
+	podNodeLister v1listers.PodLister
+	// skipAnnotation is the annotation excluding pods carrying it from pod metrics. Empty disables it.
+	skipAnnotation string
+	// staleAfter is the age after which pod metrics are annotated as stale, zero disables it.
+	staleAfter time.Duration
+	// version is the metrics server version pod metrics are annotated with, empty disables it.
+	version string
+	// serveMissingInInformer serves metrics stored for pods missing in podLister, instead of not found error.
+	serveMissingInInformer bool
+	// readiness distinguishes empty responses during warm-up. Nil considers storage ready.
+	readiness ReadinessGetter
 }
 
 var _ rest.KindProvider = &podMetrics{}
@@ -78,6 +111,12 @@ func (m *podMetrics) NewList() runtime.Object {
 
 // List implements rest.Lister interface
 func (m *podMetrics) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	defer observeRequestDuration("list", "pods", myClock.Now())
+	key := listCacheKey(genericapirequest.NamespaceValue(ctx), options)
+	if list, found := m.cache.get(key); found {
+		withRequestedPodResources(ctx, list.(*metrics.PodMetricsList).Items)
+		return list, nil
+	}
 	pods, err := m.pods(ctx, options)
 	if err != nil {
 		return &metrics.PodMetricsList{}, err
@@ -88,7 +127,13 @@ func (m *podMetrics) List(ctx context.Context, options *metainternalversion.List
 		klog.ErrorS(err, "Failed reading pods metrics", "namespace", klog.KRef("", namespace))
 		return &metrics.PodMetricsList{}, fmt.Errorf("failed reading pods metrics: %w", err)
 	}
-	return &metrics.PodMetricsList{Items: ms}, nil
+	if len(ms) == 0 {
+		observeEmptyResponse(m.readiness)
+	}
+	list := &metrics.PodMetricsList{Items: ms}
+	m.cache.set(key, list)
+	withRequestedPodResources(ctx, list.Items)
+	return list, nil
 }
 
 func (m *podMetrics) pods(ctx context.Context, options *metainternalversion.ListOptions) ([]runtime.Object, error) {
@@ -103,17 +148,56 @@ func (m *podMetrics) pods(ctx context.Context, options *metainternalversion.List
 		klog.ErrorS(err, "Failed listing pods", "labelSelector", labelSelector, "namespace", klog.KRef("", namespace))
 		return nil, fmt.Errorf("failed listing pods: %w", err)
 	}
+	if m.pendingPodLister != nil {
+		pods = append(pods, m.pendingPods(namespace, labelSelector)...)
+	}
 	if options != nil && options.FieldSelector != nil {
-		pods = filterPartialObjectMetadata(pods, options.FieldSelector)
+		if m.podNodeLister != nil {
+			pods = filterPodsWithNodeName(pods, options.FieldSelector, m.podNodeLister)
+		} else {
+			pods = filterPartialObjectMetadata(pods, options.FieldSelector)
+		}
+	}
+	if m.skipAnnotation != "" {
+		pods = m.withoutSkipped(pods)
 	}
 	return pods, err
 }
 
+// skipped returns true if pod carries the skip annotation.
+func (m *podMetrics) skipped(pod runtime.Object) bool {
+	if m.skipAnnotation == "" {
+		return false
+	}
+	_, found := pod.(*metav1.PartialObjectMetadata).Annotations[m.skipAnnotation]
+	return found
+}
+
+// withoutSkipped filters out pods carrying the skip annotation.
+func (m *podMetrics) withoutSkipped(pods []runtime.Object) []runtime.Object {
+	kept := make([]runtime.Object, 0, len(pods))
+	for _, pod := range pods {
+		if !m.skipped(pod) {
+			kept = append(kept, pod)
+		}
+	}
+	return kept
+}
+
 // Get implements rest.Getter interface
 func (m *podMetrics) Get(ctx context.Context, name string, opts *metav1.GetOptions) (runtime.Object, error) {
+	defer observeRequestDuration("get", "pods", myClock.Now())
 	namespace := genericapirequest.NamespaceValue(ctx)
 
 	pod, err := m.podLister.ByNamespace(namespace).Get(name)
+	if m.pendingPodLister != nil && (errors.IsNotFound(err) || (err == nil && pod == nil)) {
+		if pending, pendingErr := m.pendingPodLister.Pods(namespace).Get(name); pendingErr == nil {
+			pod, err = podMetadata(pending), nil
+		}
+	}
+	if m.serveMissingInInformer && (errors.IsNotFound(err) || (err == nil && pod == nil)) {
+		return m.getMissingInInformer(ctx, namespace, name)
+	}
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// return not-found errors directly
@@ -125,18 +209,68 @@ func (m *podMetrics) Get(ctx context.Context, name string, opts *metav1.GetOptio
 	if pod == nil {
 		return &metrics.PodMetrics{}, errors.NewNotFound(corev1.Resource("pods"), fmt.Sprintf("%s/%s", namespace, name))
 	}
+	if m.skipped(pod) {
+		return &metrics.PodMetrics{}, errors.NewNotFound(m.groupResource, fmt.Sprintf("%s/%s", namespace, name))
+	}
+
+	ms, err := m.getMetrics(pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed reading pod metrics", "pod", klog.KRef(namespace, name))
+		return nil, fmt.Errorf("failed pod metrics: %w", err)
+	}
+	if len(ms) == 0 {
+		notFound := errors.NewNotFound(m.groupResource, fmt.Sprintf("%s/%s", namespace, name))
+		if reason := m.missingMetricsReason(namespace, name); reason != "" {
+			notFound.ErrStatus.Message = fmt.Sprintf("%s: %s", notFound.ErrStatus.Message, reason)
+		}
+		return nil, notFound
+	}
+	withRequestedPodResources(ctx, ms)
+	return &ms[0], nil
+}
 
+// getMissingInInformer serves metrics stored for pod missing in informer, e.g. lagging behind storage,
+// with synthesized metadata. Returns not found error if there are no metrics stored for the pod.
+func (m *podMetrics) getMissingInInformer(ctx context.Context, namespace, name string) (runtime.Object, error) {
+	pod := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
 	ms, err := m.getMetrics(pod)
 	if err != nil {
 		klog.ErrorS(err, "Failed reading pod metrics", "pod", klog.KRef(namespace, name))
 		return nil, fmt.Errorf("failed pod metrics: %w", err)
 	}
 	if len(ms) == 0 {
-		return nil, errors.NewNotFound(m.groupResource, fmt.Sprintf("%s/%s", namespace, name))
+		return &metrics.PodMetrics{}, errors.NewNotFound(corev1.Resource("pods"), fmt.Sprintf("%s/%s", namespace, name))
 	}
+	klog.V(2).InfoS("Serving metrics of pod missing in informer", "pod", klog.KRef(namespace, name))
+	podsMissingInInformer.WithLabelValues().Inc()
+	withRequestedPodResources(ctx, ms)
 	return &ms[0], nil
 }
 
+// missingMetricsReason explains why pod has no metrics based on its status, if pod status is available.
+func (m *podMetrics) missingMetricsReason(namespace, name string) string {
+	if m.podStatusLister == nil {
+		return ""
+	}
+	pod, err := m.podStatusLister.Pods(namespace).Get(name)
+	if err != nil {
+		return ""
+	}
+	var waiting []string
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running != nil {
+			return ""
+		}
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			waiting = append(waiting, fmt.Sprintf("%s: %s", status.Name, status.State.Waiting.Reason))
+		}
+	}
+	if len(waiting) == 0 {
+		return "no running containers"
+	}
+	return fmt.Sprintf("no running containers (%s)", strings.Join(waiting, ", "))
+}
+
 // ConvertToTable implements rest.TableConvertor interface
 func (m *podMetrics) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1beta1.Table, error) {
 	var table metav1beta1.Table
@@ -166,9 +300,42 @@ func (m *podMetrics) getMetrics(pods ...runtime.Object) ([]metrics.PodMetrics, e
 	if err != nil {
 		return nil, err
 	}
+	if m.podUIDAnnotation {
+		annotatePodUIDs(ms, objs)
+	}
+	if m.podSpecLister != nil {
+		for i := range ms {
+			ms[i].Containers = m.withoutInitContainers(ms[i].Namespace, ms[i].Name, ms[i].Containers)
+		}
+	}
+	if m.ephemeralSpecLister != nil {
+		for i := range ms {
+			ms[i].Containers = m.withoutEphemeralContainers(ms[i].Namespace, ms[i].Name, ms[i].Containers)
+		}
+	}
 	for _, m := range ms {
 		metricFreshness.WithLabelValues().Observe(myClock.Since(m.Timestamp.Time).Seconds())
 	}
+	if m.pendingPodLister != nil {
+		ms = append(ms, m.pendingPodMetrics(objs, ms)...)
+	}
+	if m.cpuRequestLister != nil {
+		for i := range ms {
+			if pod, err := m.cpuRequestLister.Pods(ms[i].Namespace).Get(ms[i].Name); err == nil {
+				ms[i].Annotations = annotateCPURequestUtilization(ms[i].Annotations, ms[i].Containers, pod)
+			}
+		}
+	}
+	if m.staleAfter > 0 {
+		for i := range ms {
+			ms[i].Annotations = annotateStale(ms[i].Annotations, ms[i].Timestamp.Time, m.staleAfter)
+		}
+	}
+	if m.version != "" {
+		for i := range ms {
+			ms[i].Annotations = annotateVersion(ms[i].Annotations, m.version)
+		}
+	}
 	sort.Slice(ms, func(i, j int) bool {
 		if ms[i].Namespace != ms[j].Namespace {
 			return ms[i].Namespace < ms[j].Namespace
@@ -178,6 +345,149 @@ func (m *podMetrics) getMetrics(pods ...runtime.Object) ([]metrics.PodMetrics, e
 	return ms, nil
 }
 
+// annotatePodUIDs annotates pod metrics with UID of the corresponding pods.
+func annotatePodUIDs(ms []metrics.PodMetrics, pods []*metav1.PartialObjectMetadata) {
+	uids := make(map[apitypes.NamespacedName]apitypes.UID, len(pods))
+	for _, pod := range pods {
+		uids[apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}] = pod.UID
+	}
+	for i := range ms {
+		uid, found := uids[apitypes.NamespacedName{Name: ms[i].Name, Namespace: ms[i].Namespace}]
+		if !found || uid == "" {
+			continue
+		}
+		if ms[i].Annotations == nil {
+			ms[i].Annotations = make(map[string]string, 1)
+		}
+		ms[i].Annotations[AnnotationPodUID] = string(uid)
+	}
+}
+
+// pendingPodMetrics returns metrics with zero usage and empty window for pending pods without metrics,
+// whose containers didn't start yet, so they are seen during scale-up instead of missing.
+func (m *podMetrics) pendingPodMetrics(pods []*metav1.PartialObjectMetadata, ms []metrics.PodMetrics) []metrics.PodMetrics {
+	found := make(map[apitypes.NamespacedName]struct{}, len(ms))
+	for _, pm := range ms {
+		found[apitypes.NamespacedName{Name: pm.Name, Namespace: pm.Namespace}] = struct{}{}
+	}
+	var pending []metrics.PodMetrics
+	for _, obj := range pods {
+		if _, ok := found[apitypes.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}]; ok {
+			continue
+		}
+		pod, err := m.pendingPodLister.Pods(obj.Namespace).Get(obj.Name)
+		if err != nil || !notStarted(pod) {
+			continue
+		}
+		containers := make([]metrics.ContainerMetrics, 0, len(pod.Spec.Containers))
+		for _, c := range pod.Spec.Containers {
+			containers = append(containers, metrics.ContainerMetrics{
+				Name: c.Name,
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewScaledQuantity(0, -9),
+					corev1.ResourceMemory: *resource.NewQuantity(0, resource.BinarySI),
+				},
+			})
+		}
+		pending = append(pending, metrics.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              obj.Name,
+				Namespace:         obj.Namespace,
+				Labels:            obj.Labels,
+				CreationTimestamp: metav1.NewTime(myClock.Now()),
+			},
+			Timestamp:  metav1.NewTime(myClock.Now()),
+			Containers: containers,
+		})
+	}
+	return pending
+}
+
+// pendingPods returns metadata of pending pods matching the selector, which are missing in podLister
+// as it only watches running pods.
+func (m *podMetrics) pendingPods(namespace string, selector labels.Selector) []runtime.Object {
+	var pods []*corev1.Pod
+	var err error
+	if namespace == metav1.NamespaceAll {
+		pods, err = m.pendingPodLister.List(selector)
+	} else {
+		pods, err = m.pendingPodLister.Pods(namespace).List(selector)
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed listing pending pods", "labelSelector", selector, "namespace", klog.KRef("", namespace))
+		return nil
+	}
+	objs := make([]runtime.Object, 0, len(pods))
+	for _, pod := range pods {
+		// pod that just started running may still be pending in the lagging informer
+		if running, err := m.podLister.ByNamespace(pod.Namespace).Get(pod.Name); err == nil && running != nil {
+			continue
+		}
+		objs = append(objs, podMetadata(pod))
+	}
+	return objs
+}
+
+// podMetadata returns metadata of the pod, as listed by podLister.
+func podMetadata(pod *corev1.Pod) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: pod.ObjectMeta,
+	}
+}
+
+// notStarted returns true if pod is pending and none of its containers started.
+func notStarted(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodPending {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running != nil || status.State.Terminated != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutInitContainers drops metrics of containers declared as init containers in pod spec.
+// Metrics are returned unchanged if pod spec is not available.
+func (m *podMetrics) withoutInitContainers(namespace, name string, containers []metrics.ContainerMetrics) []metrics.ContainerMetrics {
+	pod, err := m.podSpecLister.Pods(namespace).Get(name)
+	if err != nil || len(pod.Spec.InitContainers) == 0 {
+		return containers
+	}
+	initContainers := make(map[string]struct{}, len(pod.Spec.InitContainers))
+	for _, c := range pod.Spec.InitContainers {
+		initContainers[c.Name] = struct{}{}
+	}
+	return withoutContainers(containers, initContainers)
+}
+
+// withoutEphemeralContainers drops metrics of containers declared as ephemeral containers in pod spec,
+// e.g. debug containers. Metrics are returned unchanged if pod spec is not available.
+func (m *podMetrics) withoutEphemeralContainers(namespace, name string, containers []metrics.ContainerMetrics) []metrics.ContainerMetrics {
+	pod, err := m.ephemeralSpecLister.Pods(namespace).Get(name)
+	if err != nil || len(pod.Spec.EphemeralContainers) == 0 {
+		return containers
+	}
+	ephemeralContainers := make(map[string]struct{}, len(pod.Spec.EphemeralContainers))
+	for _, c := range pod.Spec.EphemeralContainers {
+		ephemeralContainers[c.Name] = struct{}{}
+	}
+	return withoutContainers(containers, ephemeralContainers)
+}
+
+// withoutContainers returns metrics of containers with names other than the given ones.
+func withoutContainers(containers []metrics.ContainerMetrics, names map[string]struct{}) []metrics.ContainerMetrics {
+	filtered := make([]metrics.ContainerMetrics, 0, len(containers))
+	for _, c := range containers {
+		if _, found := names[c.Name]; !found {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
 // NamespaceScoped implements rest.Scoper interface
 func (m *podMetrics) NamespaceScoped() bool {
 	return true
@@ -18,6 +18,8 @@ package api
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -25,6 +27,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -33,6 +36,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	apitypes "k8s.io/apimachinery/pkg/types"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	v1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/metrics/pkg/apis/metrics"
@@ -172,6 +176,556 @@ func TestPodGet(t *testing.T) {
 	}
 }
 
+func TestPodGet_ExplainMissingMetrics(t *testing.T) {
+	crashLooping := createTestPods()[3]
+	crashLooping.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{
+			Name:  "container1",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(crashLooping); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name            string
+		podStatusLister v1listers.PodLister
+		wantMessage     string
+	}{
+		{
+			name:        "Default returns plain not found",
+			wantMessage: `podmetrics.metrics.k8s.io "other/pod4" not found`,
+		},
+		{
+			name:            "Pod status lister explains crash looping pod",
+			podStatusLister: v1listers.NewPodLister(indexer),
+			wantMessage:     `podmetrics.metrics.k8s.io "other/pod4" not found: no running containers (container1: CrashLoopBackOff)`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPodTestStorage(nil)
+			r.groupResource = metrics.Resource("podmetrics")
+			r.podStatusLister = tc.podStatusLister
+
+			_, err := r.Get(genericapirequest.WithNamespace(genericapirequest.NewContext(), "other"), "pod4", nil)
+			if !errors.IsNotFound(err) {
+				t.Fatalf("Expected not found error, got: %v", err)
+			}
+			if err.Error() != tc.wantMessage {
+				t.Errorf("Unexpected error message, want: %q, got: %q", tc.wantMessage, err.Error())
+			}
+		})
+	}
+}
+
+func TestPodGet_WithoutInitContainers(t *testing.T) {
+	withInitContainer := createTestPods()[0]
+	withInitContainer.Spec.InitContainers = []corev1.Container{{Name: "metric1-b"}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(withInitContainer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name           string
+		podSpecLister  v1listers.PodLister
+		wantContainers []string
+	}{
+		{
+			name:           "Init containers are included by default",
+			wantContainers: []string{"metric1", "metric1-b"},
+		},
+		{
+			name:           "Init containers are excluded",
+			podSpecLister:  v1listers.NewPodLister(indexer),
+			wantContainers: []string{"metric1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPodTestStorage(nil)
+			r.podSpecLister = tc.podSpecLister
+
+			got, err := r.Get(genericapirequest.WithNamespace(genericapirequest.NewContext(), "other"), "pod1", nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var containers []string
+			for _, c := range got.(*metrics.PodMetrics).Containers {
+				containers = append(containers, c.Name)
+			}
+			if diff := cmp.Diff(tc.wantContainers, containers); diff != "" {
+				t.Errorf("Unexpected containers, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestPodGet_PendingPodsAsZero(t *testing.T) {
+	pending := createTestPods()[3]
+	pending.Status.Phase = corev1.PodPending
+	pending.Spec.Containers = []corev1.Container{{Name: "container1"}}
+	pending.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "container1", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}}}
+	pendingIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := pendingIndexer.Add(pending); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	runningIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := runningIndexer.Add(createTestPods()[3]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name             string
+		pendingPodLister v1listers.PodLister
+		wantFound        bool
+	}{
+		{
+			name: "Pending pod is missing by default",
+		},
+		{
+			name:             "Pending pod is reported with zero usage",
+			pendingPodLister: v1listers.NewPodLister(pendingIndexer),
+			wantFound:        true,
+		},
+		{
+			name:             "Running pod without metrics is missing",
+			pendingPodLister: v1listers.NewPodLister(runningIndexer),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPodTestStorage(nil)
+			// pending pods are missing in pod metadata informer watching only running pods
+			r.podLister = fakePodLister{data: createTestPods()[:3]}
+			r.pendingPodLister = tc.pendingPodLister
+
+			got, err := r.Get(genericapirequest.WithNamespace(genericapirequest.NewContext(), "other"), "pod4", nil)
+			if !tc.wantFound {
+				if !errors.IsNotFound(err) {
+					t.Errorf("Expected not found error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			res := got.(*metrics.PodMetrics)
+			testPod(t, *res, apitypes.NamespacedName{Name: "pod4", Namespace: "other"})
+			if res.Window.Duration != 0 {
+				t.Errorf("Expected empty window, got %v", res.Window.Duration)
+			}
+			wantContainers := []metrics.ContainerMetrics{{
+				Name: "container1",
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewScaledQuantity(0, -9),
+					corev1.ResourceMemory: *resource.NewQuantity(0, resource.BinarySI),
+				},
+			}}
+			if diff := cmp.Diff(wantContainers, res.Containers); diff != "" {
+				t.Errorf("Unexpected containers, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestPodList_PendingPodsAsZero(t *testing.T) {
+	pending := createTestPods()[3]
+	pending.Status.Phase = corev1.PodPending
+	pending.Spec.Containers = []corev1.Container{{Name: "container1"}}
+	pendingIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err := pendingIndexer.Add(pending); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := NewPodTestStorage(nil)
+	r.podLister = fakePodLister{data: createTestPods()[:3]}
+	r.pendingPodLister = v1listers.NewPodLister(pendingIndexer)
+
+	got, err := r.List(genericapirequest.WithNamespace(genericapirequest.NewContext(), "other"), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for _, pm := range got.(*metrics.PodMetricsList).Items {
+		names = append(names, pm.Name)
+	}
+	// fake pod lister ignores namespace, results are sorted by namespace
+	if diff := cmp.Diff([]string{"pod1", "pod2", "pod4", "pod3"}, names); diff != "" {
+		t.Errorf("Unexpected pods, diff: %s", diff)
+	}
+}
+
+func TestPodGet_CPURequestUtilization(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		containers     []corev1.Container
+		wantAnnotation string
+	}{
+		{
+			name: "Containers with CPU request",
+			containers: []corev1.Container{
+				{Name: "metric1", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("40m")}}},
+				{Name: "metric1-b", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}}},
+			},
+			wantAnnotation: "metric1=0.250,metric1-b=0.000",
+		},
+		{
+			name: "Container without CPU request is omitted",
+			containers: []corev1.Container{
+				{Name: "metric1", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("5m")}}},
+				{Name: "metric1-b", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("10Mi")}}},
+			},
+			wantAnnotation: "metric1=2.000",
+		},
+		{
+			name:       "Containers without CPU request are not annotated",
+			containers: []corev1.Container{{Name: "metric1"}, {Name: "metric1-b"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := createTestPods()[0]
+			pod.Spec.Containers = tc.containers
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := indexer.Add(pod); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			r := NewPodTestStorage(nil)
+			r.cpuRequestLister = v1listers.NewPodLister(indexer)
+
+			got, err := r.Get(genericapirequest.WithNamespace(genericapirequest.NewContext(), "other"), "pod1", nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			annotation, found := got.(*metrics.PodMetrics).Annotations[AnnotationCPURequestUtilization]
+			if found != (tc.wantAnnotation != "") || annotation != tc.wantAnnotation {
+				t.Errorf("Unexpected annotation, want: %q, got: %q (found: %v)", tc.wantAnnotation, annotation, found)
+			}
+		})
+	}
+}
+
+func TestPodGet_PodsMissingInInformer(t *testing.T) {
+	podsMissingInInformer.Create(nil)
+	for _, tc := range []struct {
+		name       string
+		serve      bool
+		pod        apitypes.NamespacedName
+		wantFound  bool
+		wantMissed float64
+	}{
+		{
+			name: "Pod missing in informer is not found by default",
+			pod:  apitypes.NamespacedName{Name: "pod1", Namespace: "other"},
+		},
+		{
+			name:       "Pod missing in informer is served with stored metrics",
+			serve:      true,
+			pod:        apitypes.NamespacedName{Name: "pod1", Namespace: "other"},
+			wantFound:  true,
+			wantMissed: 1,
+		},
+		{
+			name:  "Pod missing in informer and storage is not found",
+			serve: true,
+			pod:   apitypes.NamespacedName{Name: "pod5", Namespace: "other"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPodTestStorage(nil)
+			r.podLister = fakePodLister{}
+			r.serveMissingInInformer = tc.serve
+			before, err := testutil.GetCounterMetricValue(podsMissingInInformer.WithLabelValues())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got, err := r.Get(genericapirequest.WithNamespace(genericapirequest.NewContext(), tc.pod.Namespace), tc.pod.Name, nil)
+			if !tc.wantFound {
+				if !errors.IsNotFound(err) {
+					t.Errorf("Expected not found error, got: %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				res := got.(*metrics.PodMetrics)
+				if res.Name != tc.pod.Name || res.Namespace != tc.pod.Namespace {
+					t.Errorf("Unexpected pod, want: %s, got: %s/%s", tc.pod, res.Namespace, res.Name)
+				}
+				if len(res.Containers) != 2 {
+					t.Errorf("Expected stored metrics of 2 containers, got: %v", res.Containers)
+				}
+			}
+			after, err := testutil.GetCounterMetricValue(podsMissingInInformer.WithLabelValues())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if after-before != tc.wantMissed {
+				t.Errorf("Unexpected number of pods missing in informer, want: %v, got: %v", tc.wantMissed, after-before)
+			}
+		})
+	}
+}
+
+func TestPodGet_WithoutEphemeralContainers(t *testing.T) {
+	withEphemeralContainer := createTestPods()[0]
+	withEphemeralContainer.Spec.EphemeralContainers = []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "metric1-b"}}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(withEphemeralContainer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name                string
+		ephemeralSpecLister v1listers.PodLister
+		wantContainers      []string
+	}{
+		{
+			name:           "Ephemeral containers are included by default",
+			wantContainers: []string{"metric1", "metric1-b"},
+		},
+		{
+			name:                "Ephemeral containers are excluded",
+			ephemeralSpecLister: v1listers.NewPodLister(indexer),
+			wantContainers:      []string{"metric1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPodTestStorage(nil)
+			r.ephemeralSpecLister = tc.ephemeralSpecLister
+
+			got, err := r.Get(genericapirequest.WithNamespace(genericapirequest.NewContext(), "other"), "pod1", nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var containers []string
+			for _, c := range got.(*metrics.PodMetrics).Containers {
+				containers = append(containers, c.Name)
+			}
+			if diff := cmp.Diff(tc.wantContainers, containers); diff != "" {
+				t.Errorf("Unexpected containers, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestPodList_NodeNameFieldSelector(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, pod := range createTestPods() {
+		switch pod.Name {
+		case "pod1", "pod3":
+			pod.Spec.NodeName = "node1"
+		case "pod2":
+			pod.Spec.NodeName = "node2"
+		}
+		if err := indexer.Add(pod); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	options := &metainternalversion.ListOptions{
+		FieldSelector: fields.SelectorFromSet(map[string]string{"spec.nodeName": "node1"}),
+	}
+
+	for _, tc := range []struct {
+		name          string
+		podNodeLister v1listers.PodLister
+		wantPods      []apitypes.NamespacedName
+	}{
+		{
+			name: "Node name is not matched by default",
+		},
+		{
+			name:          "Pods are filtered by node assignment",
+			podNodeLister: v1listers.NewPodLister(indexer),
+			wantPods:      []apitypes.NamespacedName{{Name: "pod1", Namespace: "other"}, {Name: "pod3", Namespace: "testValue"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPodTestStorage(nil)
+			r.podNodeLister = tc.podNodeLister
+
+			got, err := r.List(genericapirequest.NewContext(), options)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			res := got.(*metrics.PodMetricsList)
+			if len(res.Items) != len(tc.wantPods) {
+				t.Fatalf("len(res.Items) != %d, got: %d", len(tc.wantPods), len(res.Items))
+			}
+			for i := range res.Items {
+				testPod(t, res.Items[i], tc.wantPods[i])
+			}
+		})
+	}
+}
+
+func TestPod_SkipAnnotation(t *testing.T) {
+	pods := createTestPods()
+	pods[1].Annotations = map[string]string{"example.com/skip-metrics": "true"}
+	r := NewPodTestStorage(nil)
+	r.groupResource = metrics.Resource("podmetrics")
+	r.podLister = fakePodLister{data: pods}
+	r.skipAnnotation = "example.com/skip-metrics"
+
+	got, err := r.List(genericapirequest.NewContext(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res := got.(*metrics.PodMetricsList)
+	wantPods := []apitypes.NamespacedName{{Name: "pod1", Namespace: "other"}, {Name: "pod3", Namespace: "testValue"}}
+	if len(res.Items) != len(wantPods) {
+		t.Fatalf("len(res.Items) != %d, got: %d", len(wantPods), len(res.Items))
+	}
+	for i := range res.Items {
+		testPod(t, res.Items[i], wantPods[i])
+	}
+
+	_, err = r.Get(genericapirequest.WithNamespace(genericapirequest.NewContext(), "other"), "pod2", nil)
+	if !errors.IsNotFound(err) {
+		t.Errorf("Expected not found error for skipped pod, got: %v", err)
+	}
+	_, err = r.Get(genericapirequest.WithNamespace(genericapirequest.NewContext(), "other"), "pod1", nil)
+	if err != nil {
+		t.Errorf("Unexpected error for not skipped pod: %v", err)
+	}
+}
+
+func TestPodList_ListParallelism(t *testing.T) {
+	defer func(minPods int) { parallelMinPodsPerShard = minPods }(parallelMinPodsPerShard)
+	parallelMinPodsPerShard = 1
+
+	serial := NewPodTestStorage(nil)
+	want, err := serial.List(genericapirequest.NewContext(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, workers := range []int{0, 2, 8} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			r := NewPodTestStorage(nil)
+			r.metrics = NewParallelPodMetricsGetter(r.metrics, workers)
+
+			got, err := r.List(genericapirequest.NewContext(), nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Unexpected list, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestPodList_RequestedResources(t *testing.T) {
+	r := NewPodTestStorage(nil)
+	r.cache = newListCache(time.Minute, nil)
+	list := func(resources string) *metrics.PodMetricsList {
+		var got runtime.Object
+		var err error
+		handler := RequestedResourcesHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			got, err = r.List(req.Context(), nil)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/apis/metrics.k8s.io/v1beta1/pods", nil)
+		if resources != "" {
+			req.Header.Set(ResourcesHeader, resources)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return got.(*metrics.PodMetricsList)
+	}
+	usage := func(list *metrics.PodMetricsList) map[string]corev1.ResourceList {
+		res := map[string]corev1.ResourceList{}
+		for _, pod := range list.Items {
+			for _, container := range pod.Containers {
+				res[container.Name] = container.Usage
+			}
+		}
+		return res
+	}
+
+	want := map[string]corev1.ResourceList{
+		"metric1":   {corev1.ResourceCPU: resource.MustParse("10m")},
+		"metric1-b": {},
+		"metric2":   {corev1.ResourceCPU: resource.MustParse("20m")},
+		"metric3":   {corev1.ResourceCPU: resource.MustParse("20m")},
+	}
+	if diff := cmp.Diff(want, usage(list("cpu"))); diff != "" {
+		t.Errorf("Unexpected usage with CPU requested, diff: %s", diff)
+	}
+	// Cached response is not limited to resources requested by previous request.
+	want = map[string]corev1.ResourceList{
+		"metric1":   {corev1.ResourceCPU: resource.MustParse("10m")},
+		"metric1-b": {corev1.ResourceMemory: resource.MustParse("5Mi")},
+		"metric2":   {corev1.ResourceCPU: resource.MustParse("20m"), corev1.ResourceMemory: resource.MustParse("15Mi")},
+		"metric3":   {corev1.ResourceCPU: resource.MustParse("20m"), corev1.ResourceMemory: resource.MustParse("25Mi")},
+	}
+	if diff := cmp.Diff(want, usage(list(""))); diff != "" {
+		t.Errorf("Unexpected usage with all resources requested, diff: %s", diff)
+	}
+}
+
+func TestPodList_StaleAnnotation(t *testing.T) {
+	c := &fakeClock{}
+	myClock = c
+	r := NewPodTestStorage(nil)
+	r.staleAfter = 30 * time.Second
+	c.now = r.metrics.(fakePodMetricsGetter).now.Add(45 * time.Second)
+
+	got, err := r.List(genericapirequest.NewContext(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res := got.(*metrics.PodMetricsList)
+	if len(res.Items) != 3 {
+		t.Fatalf("len(res.Items) != 3, got: %d", len(res.Items))
+	}
+	for _, pod := range res.Items {
+		if pod.Annotations[AnnotationStale] != "true" || pod.Annotations[AnnotationStaleAge] != "45s" {
+			t.Errorf("Expected pod %s/%s to be annotated as stale, got annotations: %v", pod.Namespace, pod.Name, pod.Annotations)
+		}
+	}
+}
+
+func TestPodList_PodUIDAnnotation(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		podUIDAnnotation bool
+		wantAnnotations  map[string]map[string]string
+	}{
+		{
+			name:            "Pod metrics are not annotated when disabled",
+			wantAnnotations: map[string]map[string]string{"pod1": nil, "pod2": nil, "pod3": nil},
+		},
+		{
+			name:             "Pod metrics are annotated with UID from lister",
+			podUIDAnnotation: true,
+			wantAnnotations: map[string]map[string]string{
+				"pod1": {AnnotationPodUID: "uid-pod1"},
+				"pod2": {AnnotationPodUID: "uid-pod2"},
+				"pod3": {AnnotationPodUID: "uid-pod3"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPodTestStorage(nil)
+			r.podUIDAnnotation = tc.podUIDAnnotation
+
+			got, err := r.List(genericapirequest.WithNamespace(genericapirequest.NewContext(), "other"), nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			annotations := map[string]map[string]string{}
+			for _, pod := range got.(*metrics.PodMetricsList).Items {
+				annotations[pod.Name] = pod.Annotations
+			}
+			if diff := cmp.Diff(tc.wantAnnotations, annotations); diff != "" {
+				t.Errorf("Unexpected annotations, diff: %s", diff)
+			}
+		})
+	}
+}
+
 func TestPodList_Monitoring(t *testing.T) {
 	c := &fakeClock{}
 	myClock = c
@@ -218,6 +772,97 @@ func TestPodList_Monitoring(t *testing.T) {
 	}
 }
 
+func TestPodList_RequestDuration(t *testing.T) {
+	c := &fakeClock{}
+	myClock = c
+
+	requestDuration.Create(nil)
+	requestDuration.Reset()
+
+	r := NewPodTestStorage(nil)
+	_, err := r.List(genericapirequest.NewContext(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = testutil.CollectAndCompare(requestDuration, strings.NewReader(`
+	# HELP metrics_server_api_request_duration_seconds [ALPHA] Duration of serving Metrics API requests in seconds
+	# TYPE metrics_server_api_request_duration_seconds histogram
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="0.005"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="0.01"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="0.025"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="0.05"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="0.1"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="0.25"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="0.5"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="1"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="2.5"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="5"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="10"} 1
+	metrics_server_api_request_duration_seconds_bucket{resource="pods",verb="list",le="+Inf"} 1
+	metrics_server_api_request_duration_seconds_sum{resource="pods",verb="list"} 0
+	metrics_server_api_request_duration_seconds_count{resource="pods",verb="list"} 1
+	`), "metrics_server_api_request_duration_seconds")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPodList_Cache(t *testing.T) {
+	c := &fakeClock{}
+	myClock = c
+
+	getter := &countingPodMetricsGetter{}
+	r := NewPodTestStorage(nil)
+	r.metrics = getter
+	r.cache = newListCache(time.Second, getter)
+	ctx := genericapirequest.NewContext()
+
+	for _, step := range []struct {
+		name      string
+		advance   time.Duration
+		store     bool
+		wantCalls int
+	}{
+		{name: "First list assembles response", wantCalls: 1},
+		{name: "List within TTL hits cache", advance: 500 * time.Millisecond, wantCalls: 1},
+		{name: "List after store misses cache", store: true, wantCalls: 2},
+		{name: "List after TTL misses cache", advance: time.Second, wantCalls: 3},
+	} {
+		c.now = c.now.Add(step.advance)
+		if step.store {
+			getter.generation++
+		}
+		res, err := r.List(ctx, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if got := len(res.(*metrics.PodMetricsList).Items); got != 3 {
+			t.Errorf("%s: unexpected number of pods, want: 3, got: %d", step.name, got)
+		}
+		if getter.calls != step.wantCalls {
+			t.Errorf("%s: unexpected number of metrics reads, want: %d, got: %d", step.name, step.wantCalls, getter.calls)
+		}
+	}
+}
+
+type countingPodMetricsGetter struct {
+	fakePodMetricsGetter
+	calls      int
+	generation uint64
+}
+
+var _ GenerationGetter = (*countingPodMetricsGetter)(nil)
+
+func (mp *countingPodMetricsGetter) GetPodMetrics(pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
+	mp.calls++
+	return mp.fakePodMetricsGetter.GetPodMetrics(pods...)
+}
+
+func (mp *countingPodMetricsGetter) Generation() uint64 {
+	return mp.generation
+}
+
 // fakes both PodLister and PodNamespaceLister at once
 type fakePodLister struct {
 	data []*corev1.Pod
@@ -233,9 +878,11 @@ func (pl fakePodLister) List(selector labels.Selector) (ret []runtime.Object, er
 		if selector.Matches(labels.Set(pod.Labels)) {
 			res = append(res, &metav1.PartialObjectMetadata{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      pod.Name,
-					Namespace: pod.Namespace,
-					Labels:    pod.Labels,
+					Name:        pod.Name,
+					Namespace:   pod.Namespace,
+					Labels:      pod.Labels,
+					Annotations: pod.Annotations,
+					UID:         pod.UID,
 				},
 			})
 		}
@@ -250,9 +897,11 @@ func (pl fakePodLister) Get(name string) (runtime.Object, error) {
 		if pod.Name == name {
 			return &metav1.PartialObjectMetadata{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      pod.Name,
-					Namespace: pod.Namespace,
-					Labels:    pod.Labels,
+					Name:        pod.Name,
+					Namespace:   pod.Namespace,
+					Labels:      pod.Labels,
+					Annotations: pod.Annotations,
+					UID:         pod.UID,
 				},
 			}, nil
 		}
@@ -331,21 +980,25 @@ func createTestPods() []*corev1.Pod {
 	pod1 := &corev1.Pod{}
 	pod1.Namespace = "other"
 	pod1.Name = "pod1"
+	pod1.UID = "uid-pod1"
 	pod1.Status.Phase = corev1.PodRunning
 	pod1.Labels = podLabels(pod1.Name, pod1.Namespace)
 	pod2 := &corev1.Pod{}
 	pod2.Namespace = "other"
 	pod2.Name = "pod2"
+	pod2.UID = "uid-pod2"
 	pod2.Status.Phase = corev1.PodRunning
 	pod2.Labels = podLabels(pod2.Name, pod2.Namespace)
 	pod3 := &corev1.Pod{}
 	pod3.Namespace = "testValue"
 	pod3.Name = "pod3"
+	pod3.UID = "uid-pod3"
 	pod3.Status.Phase = corev1.PodRunning
 	pod3.Labels = podLabels(pod3.Name, pod3.Namespace)
 	pod4 := &corev1.Pod{}
 	pod4.Namespace = "other"
 	pod4.Name = "pod4"
+	pod4.UID = "uid-pod4"
 	pod4.Status.Phase = corev1.PodRunning
 	pod4.Labels = podLabels(pod4.Name, pod4.Namespace)
 	return []*corev1.Pod{pod1, pod2, pod3, pod4}
@@ -0,0 +1,88 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// ResourcesHeader is the request header limiting resources reported in usage of node and pod metrics
+// to the given comma separated resource names, e.g. "cpu". All resources are reported if it's not set.
+const ResourcesHeader = "X-Metrics-Resources"
+
+type requestedResourcesKey struct{}
+
+// RequestedResourcesHandler passes resources requested with ResourcesHeader to the metrics API served by the handler.
+func RequestedResourcesHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var resources []corev1.ResourceName
+		for _, value := range req.Header.Values(ResourcesHeader) {
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					resources = append(resources, corev1.ResourceName(name))
+				}
+			}
+		}
+		if len(resources) != 0 {
+			req = req.WithContext(context.WithValue(req.Context(), requestedResourcesKey{}, resources))
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// requestedResources returns resources requested to be reported, nil means all.
+func requestedResources(ctx context.Context) []corev1.ResourceName {
+	resources, _ := ctx.Value(requestedResourcesKey{}).([]corev1.ResourceName)
+	return resources
+}
+
+// withRequestedNodeResources limits usage of node metrics to requested resources.
+func withRequestedNodeResources(ctx context.Context, ms []metrics.NodeMetrics) {
+	resources := requestedResources(ctx)
+	if resources == nil {
+		return
+	}
+	for i := range ms {
+		ms[i].Usage = requestedUsage(ms[i].Usage, resources)
+	}
+}
+
+// withRequestedPodResources limits usage of containers in pod metrics to requested resources.
+func withRequestedPodResources(ctx context.Context, ms []metrics.PodMetrics) {
+	resources := requestedResources(ctx)
+	if resources == nil {
+		return
+	}
+	for i := range ms {
+		for j := range ms[i].Containers {
+			ms[i].Containers[j].Usage = requestedUsage(ms[i].Containers[j].Usage, resources)
+		}
+	}
+}
+
+func requestedUsage(usage corev1.ResourceList, resources []corev1.ResourceName) corev1.ResourceList {
+	res := make(corev1.ResourceList, len(resources))
+	for _, name := range resources {
+		if quantity, found := usage[name]; found {
+			res[name] = quantity
+		}
+	}
+	return res
+}
@@ -21,6 +21,40 @@ import (
 
 var myClock clock = &realClock{}
 
+const (
+	// AnnotationStale marks metrics older than the configured staleness threshold, served in degraded mode.
+	AnnotationStale = "metrics-server.io/stale"
+	// AnnotationStaleAge is the age of stale metrics, allowing clients to decide whether to use them.
+	AnnotationStaleAge = "metrics-server.io/stale-age"
+	// AnnotationAge is the age of the metric point at the time it's served, independent of the rate window.
+	AnnotationAge = "metrics-server.io/age"
+)
+
+// annotateStale returns annotations marking metrics measured at timestamp as stale, if older than staleAfter.
+// Zero staleAfter disables it. The given annotations are modified in place, unless nil.
+func annotateStale(annotations map[string]string, timestamp time.Time, staleAfter time.Duration) map[string]string {
+	age := myClock.Since(timestamp)
+	if staleAfter == 0 || age <= staleAfter {
+		return annotations
+	}
+	if annotations == nil {
+		annotations = make(map[string]string, 2)
+	}
+	annotations[AnnotationStale] = "true"
+	annotations[AnnotationStaleAge] = age.Truncate(time.Second).String()
+	return annotations
+}
+
+// annotateAge returns annotations with age of metrics measured at timestamp.
+// The given annotations are modified in place, unless nil.
+func annotateAge(annotations map[string]string, timestamp time.Time) map[string]string {
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[AnnotationAge] = myClock.Since(timestamp).Truncate(time.Millisecond).String()
+	return annotations
+}
+
 type clock interface {
 	Now() time.Time
 	Since(time.Time) time.Duration
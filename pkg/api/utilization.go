@@ -0,0 +1,56 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// AnnotationCPURequestUtilization is the annotation of pod metrics holding CPU usage of containers relative
+// to their CPU request, as comma separated "<container>=<ratio>" pairs, e.g. "app=0.250,sidecar=1.100".
+// Containers without CPU request are omitted.
+const AnnotationCPURequestUtilization = "metrics-server.io/cpu-request-utilization"
+
+// annotateCPURequestUtilization returns annotations with CPU request utilization of containers with CPU request
+// in the given pod spec. The given annotations are modified in place, unless nil.
+func annotateCPURequestUtilization(annotations map[string]string, containers []metrics.ContainerMetrics, pod *corev1.Pod) map[string]string {
+	requests := make(map[string]float64, len(pod.Spec.Containers))
+	for _, c := range pod.Spec.Containers {
+		if request, found := c.Resources.Requests[corev1.ResourceCPU]; found && !request.IsZero() {
+			requests[c.Name] = request.AsApproximateFloat64()
+		}
+	}
+	var utilization []string
+	for _, c := range containers {
+		request, found := requests[c.Name]
+		if !found {
+			continue
+		}
+		usage := c.Usage[corev1.ResourceCPU]
+		utilization = append(utilization, c.Name+"="+strconv.FormatFloat(usage.AsApproximateFloat64()/request, 'f', 3, 64))
+	}
+	if len(utilization) == 0 {
+		return annotations
+	}
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[AnnotationCPURequestUtilization] = strings.Join(utilization, ",")
+	return annotations
+}
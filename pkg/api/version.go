@@ -0,0 +1,31 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// AnnotationVersion is the annotation of node and pod metrics holding version of metrics server serving them.
+const AnnotationVersion = "metrics-server.io/version"
+
+// annotateVersion returns annotations with the given metrics server version. Empty version disables it.
+// The given annotations are modified in place, unless nil.
+func annotateVersion(annotations map[string]string, version string) map[string]string {
+	if version == "" {
+		return annotations
+	}
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[AnnotationVersion] = version
+	return annotations
+}
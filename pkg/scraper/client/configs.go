@@ -15,15 +15,94 @@
 package client
 
 import (
+	"net/http"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 )
 
+// Handling of container series repeated within a single Kubelet response.
+const (
+	// DuplicateSeriesLast keeps the last value of repeated series.
+	DuplicateSeriesLast = "last"
+	// DuplicateSeriesSum adds up values of repeated series.
+	DuplicateSeriesSum = "sum"
+	// DuplicateSeriesError fails decoding the whole response.
+	DuplicateSeriesError = "error"
+)
+
+// Units of timestamps reported by Kubelets.
+const (
+	// TimestampUnitMilliseconds is the unit of Prometheus text format timestamps.
+	TimestampUnitMilliseconds = "ms"
+	// TimestampUnitSeconds is used by Kubelets reporting timestamps in seconds.
+	TimestampUnitSeconds = "s"
+)
+
 // KubeletClientConfig represents configuration for connecting to Kubelets.
 type KubeletClientConfig struct {
 	Client              rest.Config
 	AddressTypePriority []corev1.NodeAddressType
-	Scheme              string
-	DefaultPort         int
-	UseNodeStatusPort   bool
+	// AddressDNSFallback resolves node hostname via DNS if node has no address of types in AddressTypePriority,
+	// using AddressDNSServer ("host:port", empty means system resolver) within AddressDNSTimeout.
+	AddressDNSFallback bool
+	AddressDNSServer   string
+	AddressDNSTimeout  time.Duration
+	Scheme             string
+	DefaultPort        int
+	UseNodeStatusPort  bool
+	RequireNodeMemory  bool
+	// AllowZeroMemory keeps containers reporting zero memory working set, which are dropped by default.
+	AllowZeroMemory     bool
+	MaxContainersPerPod int
+	ClientTimeout       time.Duration
+	NodeLabel           string
+	PodLevelCPU         bool
+	PodLevelMemory      bool
+	// DialTimeout, TLSHandshakeTimeout and ResponseHeaderTimeout limit phases of connecting to Kubelets. Zero uses the defaults.
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// OnDuplicateSeries selects how container series repeated within a single Kubelet response are handled,
+	// one of DuplicateSeriesLast, DuplicateSeriesSum or DuplicateSeriesError. Empty means DuplicateSeriesLast.
+	OnDuplicateSeries string
+	// HealthSeries is the name of the series indicating Kubelet health. Responses with it equal zero are skipped. Empty disables it.
+	HealthSeries string
+	// NodeCPUGaugeMetric is the name of the series reporting node CPU usage in cores as a gauge, used by Kubelets
+	// not exposing cumulative usage. Nodes reporting it are served after a single scrape. Empty disables it.
+	NodeCPUGaugeMetric string
+	// ScrapeLogVerbosity is the klog verbosity of structured logs emitted for each scrape of a Kubelet.
+	ScrapeLogVerbosity int
+	// DecodeParallelism is the number of metric family groups of large Prometheus text format responses decoded
+	// concurrently. Values below 2 decode responses serially.
+	DecodeParallelism int
+	// PartialReadRetries is the number of times a scrape is retried after connection failed while reading
+	// Kubelet response body, within the scrape timeout.
+	PartialReadRetries int
+	// ApproximateNodeMemory approximates missing node memory usage as the sum of memory usage of its pods
+	// increased by NodeMemoryOverhead bytes. Such node metrics are annotated as approximate.
+	ApproximateNodeMemory bool
+	NodeMemoryOverhead    int64
+	// IncludedNamespaces restricts stored pod metrics to the given namespaces. Empty means all namespaces.
+	IncludedNamespaces []string
+	// ObserveTimeSkew observes difference between scrape time and timestamps of node metrics per node,
+	// helping to detect clock skew of nodes.
+	ObserveTimeSkew bool
+	// MetricNames maps names of metrics decoded by Metrics Server to names reported by Kubelet, for Kubelets
+	// exposing them under different names. Values are expected in the same units. Empty uses the default names.
+	MetricNames map[string]string
+	// ForceHTTP1 disables negotiating HTTP/2 with Kubelets, working around Kubelets misbehaving with it.
+	ForceHTTP1 bool
+	// TLSServerNameFromHostname connects to the resolved node address, while verifying the Kubelet serving certificate against node hostname.
+	TLSServerNameFromHostname bool
+	// TimestampUnit is the unit of timestamps reported by Kubelets, one of TimestampUnitMilliseconds or
+	// TimestampUnitSeconds. Empty means TimestampUnitMilliseconds.
+	TimestampUnit string
+	// NodeCADir is the directory with CA bundles of nodes, named "<node name>.crt", used to verify serving certificate
+	// of Kubelet on the node instead of the cluster CA. Bundles are re-read when their modification time changes.
+	// Nodes without a bundle are verified with the cluster CA. Empty disables it.
+	NodeCADir string
+	// WrapTransport optionally wraps transport used to connect to Kubelets, e.g. to add custom authentication.
+	WrapTransport func(rt http.RoundTripper) http.RoundTripper
 }
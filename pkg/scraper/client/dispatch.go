@@ -0,0 +1,73 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+const (
+	// AnnotationScrapeSource is the node annotation used to override the source its metrics are scraped from.
+	AnnotationScrapeSource = "metrics-server.io/scrape-source"
+	// ScrapeSourceResource is the Kubelet resource metrics endpoint.
+	ScrapeSourceResource = "resource"
+)
+
+type sourceDispatcher struct {
+	defaultSource string
+	sources       map[string]KubeletMetricsGetter
+}
+
+var _ KubeletMetricsGetter = (*sourceDispatcher)(nil)
+var _ NodeForgetter = (*sourceDispatcher)(nil)
+
+// NewSourceDispatcher returns KubeletMetricsGetter picking the getter for each node based on
+// its AnnotationScrapeSource annotation, falling back to defaultSource for nodes without it.
+func NewSourceDispatcher(defaultSource string, sources map[string]KubeletMetricsGetter) KubeletMetricsGetter {
+	return &sourceDispatcher{
+		defaultSource: defaultSource,
+		sources:       sources,
+	}
+}
+
+// GetMetrics implements KubeletMetricsGetter
+func (d *sourceDispatcher) GetMetrics(ctx context.Context, node *v1.Node) (*storage.MetricsBatch, error) {
+	source := d.defaultSource
+	if s := node.Annotations[AnnotationScrapeSource]; s != "" {
+		source = s
+	}
+	getter, found := d.sources[source]
+	if !found {
+		return nil, fmt.Errorf("unknown scrape source %q of node %q", source, node.Name)
+	}
+	batch, err := getter.GetMetrics(ctx, node)
+	scrapeTotal.WithLabelValues(source, strconv.FormatBool(err == nil)).Inc()
+	return batch, err
+}
+
+// ForgetNode implements NodeForgetter, forwarding to all sources keeping per-node state.
+func (d *sourceDispatcher) ForgetNode(nodeName string) {
+	for _, getter := range d.sources {
+		if f, ok := getter.(NodeForgetter); ok {
+			f.ForgetNode(nodeName)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics/testutil"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+type namedGetter string
+
+func (g namedGetter) GetMetrics(ctx context.Context, node *v1.Node) (*storage.MetricsBatch, error) {
+	return &storage.MetricsBatch{ClusterName: string(g)}, nil
+}
+
+type failingGetter struct{}
+
+func (failingGetter) GetMetrics(ctx context.Context, node *v1.Node) (*storage.MetricsBatch, error) {
+	return nil, fmt.Errorf("failed decoding")
+}
+
+type forgettingGetter struct {
+	namedGetter
+	forgotten []string
+}
+
+func (g *forgettingGetter) ForgetNode(nodeName string) {
+	g.forgotten = append(g.forgotten, nodeName)
+}
+
+func TestSourceDispatcher_ForgetNode(t *testing.T) {
+	forgetting := &forgettingGetter{namedGetter: "resource"}
+	d := NewSourceDispatcher(ScrapeSourceResource, map[string]KubeletMetricsGetter{
+		ScrapeSourceResource: forgetting,
+		"other":              namedGetter("other"),
+	})
+	d.(NodeForgetter).ForgetNode("node1")
+	if len(forgetting.forgotten) != 1 || forgetting.forgotten[0] != "node1" {
+		t.Errorf("Unexpected forgotten nodes, want: [node1], got: %v", forgetting.forgotten)
+	}
+}
+
+func TestSourceDispatcher(t *testing.T) {
+	d := NewSourceDispatcher(ScrapeSourceResource, map[string]KubeletMetricsGetter{
+		ScrapeSourceResource: namedGetter("resource"),
+		"other":              namedGetter("other"),
+	})
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		wantSource  string
+		wantErr     bool
+	}{
+		{
+			name:       "Node without annotation uses default source",
+			wantSource: "resource",
+		},
+		{
+			name:        "Annotated node uses its source",
+			annotations: map[string]string{AnnotationScrapeSource: "other"},
+			wantSource:  "other",
+		},
+		{
+			name:        "Node annotated with unknown source fails",
+			annotations: map[string]string{AnnotationScrapeSource: "unknown"},
+			wantErr:     true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: tc.annotations}}
+			batch, err := d.GetMetrics(context.Background(), node)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error, wantErr: %v, got: %v", tc.wantErr, err)
+			}
+			if err == nil && batch.ClusterName != tc.wantSource {
+				t.Errorf("Unexpected source used, want: %q, got: %q", tc.wantSource, batch.ClusterName)
+			}
+		})
+	}
+}
+
+func TestSourceDispatcher_ScrapeTotal(t *testing.T) {
+	scrapeTotal.Create(nil)
+	scrapeTotal.Reset()
+
+	d := NewSourceDispatcher(ScrapeSourceResource, map[string]KubeletMetricsGetter{
+		ScrapeSourceResource: namedGetter("resource"),
+		"other":              failingGetter{},
+	})
+	other := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2", Annotations: map[string]string{AnnotationScrapeSource: "other"}}}
+	for _, node := range []*v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, other, other} {
+		_, _ = d.GetMetrics(context.Background(), node)
+	}
+	err := testutil.CollectAndCompare(scrapeTotal, strings.NewReader(`
+	# HELP metrics_server_scrape_total [ALPHA] Number of node scrapes by scrape source and whether metrics were successfully scraped and decoded.
+	# TYPE metrics_server_scrape_total counter
+	metrics_server_scrape_total{source="other",success="false"} 2
+	metrics_server_scrape_total{source="resource",success="true"} 1
+	`), "metrics_server_scrape_total")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+}
@@ -27,3 +27,9 @@ type KubeletMetricsGetter interface {
 	// GetMetrics fetches Resource metrics from the given Kubelet
 	GetMetrics(ctx context.Context, node *v1.Node) (*storage.MetricsBatch, error)
 }
+
+// NodeForgetter is implemented by KubeletMetricsGetter keeping per-node state, like metrics labeled by node.
+type NodeForgetter interface {
+	// ForgetNode drops state of the node, called once the node is no longer scraped.
+	ForgetNode(nodeName string)
+}
@@ -0,0 +1,61 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"k8s.io/component-base/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+var (
+	// definedPrefix is the prefix metrics were last defined with.
+	definedPrefix utils.MetricsPrefix
+	scrapeTotal   *metrics.CounterVec
+)
+
+func init() {
+	defineMetrics(utils.MetricsPrefix{})
+}
+
+// defineMetrics defines metrics of the package with names prefixed with prefix.
+func defineMetrics(prefix utils.MetricsPrefix) {
+	definedPrefix = prefix
+	scrapeTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "scrape_total",
+			Help:      "Number of node scrapes by scrape source and whether metrics were successfully scraped and decoded.",
+		},
+		[]string{"source", "success"},
+	)
+}
+
+// RegisterSourceMetrics registers metrics comparing scrapes of different sources.
+func RegisterSourceMetrics(registrationFunc func(metrics.Registerable) error, prefix utils.MetricsPrefix) error {
+	if prefix != definedPrefix {
+		defineMetrics(prefix)
+	}
+	for _, metric := range []metrics.Registerable{
+		scrapeTotal,
+	} {
+		err := registrationFunc(metric)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
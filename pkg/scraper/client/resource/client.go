@@ -17,6 +17,7 @@ package resource
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -27,7 +28,9 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 	"sigs.k8s.io/metrics-server/pkg/storage"
@@ -35,6 +38,8 @@ import (
 )
 
 const (
+	// defaultScrapeLogVerbosity is the verbosity of per node scrape logs, matching other per node logs of scraper.
+	defaultScrapeLogVerbosity = 2
 	// AnnotationResourceMetricsPath is the annotation used to specify the path to the resource metrics endpoint.
 	AnnotationResourceMetricsPath = "metrics.k8s.io/resource-metrics-path"
 )
@@ -46,30 +51,178 @@ type kubeletClient struct {
 	scheme            string
 	addrResolver      utils.NodeAddressResolver
 	buffers           sync.Pool
+	decodeOptions     decodeOptions
+	// logVerbosity is the verbosity of structured logs emitted for each scrape.
+	logVerbosity klog.Level
+	// serverNameFromHostname requests Kubelets by node hostname, dialing the resolved node address.
+	serverNameFromHostname bool
+	// partialReadRetries is the number of times a scrape is retried after connection failed while reading response body.
+	partialReadRetries int
+	// nodeCAs provides clients verifying Kubelets against CA bundles of their nodes. Nil uses client for all nodes.
+	nodeCAs *nodeCAClients
 }
 
+// dialAddressKey is the context key of address dialed instead of the one in request URL.
+type dialAddressKey struct{}
+
 var _ client.KubeletMetricsGetter = (*kubeletClient)(nil)
+var _ client.NodeForgetter = (*kubeletClient)(nil)
 
 func NewForConfig(config *client.KubeletClientConfig) (*kubeletClient, error) {
-	transport, err := rest.TransportFor(&config.Client)
+	restConfig := config.Client
+	if config.DialTimeout > 0 && restConfig.Dial == nil {
+		dialer := &net.Dialer{Timeout: config.DialTimeout, KeepAlive: 30 * time.Second}
+		restConfig.Dial = dialer.DialContext
+	}
+	if config.TLSServerNameFromHostname {
+		restConfig.Dial = dialResolvedAddress(restConfig.Dial)
+	}
+	if config.ForceHTTP1 {
+		// Only offering HTTP/1.1 via ALPN prevents the transport from upgrading to HTTP/2.
+		restConfig.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+	c, err := newHTTPClient(config, &restConfig)
 	if err != nil {
-		return nil, fmt.Errorf("unable to construct transport: %v", err)
+		return nil, err
+	}
+	opts := decodeOptions{
+		allowMissingNodeMemory: !config.RequireNodeMemory,
+		allowZeroMemory:        config.AllowZeroMemory,
+		maxContainersPerPod:    config.MaxContainersPerPod,
+		nodeLabel:              config.NodeLabel,
+		podLevelCpu:            config.PodLevelCPU,
+		podLevelMemory:         config.PodLevelMemory,
+		onDuplicateSeries:      config.OnDuplicateSeries,
+		healthSeries:           config.HealthSeries,
+		nodeCpuGauge:           config.NodeCPUGaugeMetric,
+		parallelism:            config.DecodeParallelism,
+		approximateNodeMemory:  config.ApproximateNodeMemory,
+		nodeMemoryOverhead:     uint64(config.NodeMemoryOverhead),
+		observeTimeSkew:        config.ObserveTimeSkew,
+	}
+	if config.TimestampUnit == client.TimestampUnitSeconds {
+		opts.timestampScale = 1000
 	}
+	if opts.metricNames, err = metricNameMapping(config.MetricNames); err != nil {
+		return nil, fmt.Errorf("invalid metric name mapping: %w", err)
+	}
+	if len(config.IncludedNamespaces) > 0 {
+		opts.includedNamespaces = make(map[string]struct{}, len(config.IncludedNamespaces))
+		for _, ns := range config.IncludedNamespaces {
+			opts.includedNamespaces[ns] = struct{}{}
+		}
+	}
+	resolver := utils.NewPriorityNodeAddressResolver(config.AddressTypePriority)
+	if config.AddressDNSFallback {
+		resolver = utils.NewDNSFallbackNodeAddressResolver(resolver, hostResolver(config.AddressDNSServer), config.AddressDNSTimeout)
+	}
+	kc := newClient(c, resolver, config.DefaultPort, config.Scheme, config.UseNodeStatusPort, config.ClientTimeout, opts)
+	kc.serverNameFromHostname = config.TLSServerNameFromHostname
+	kc.logVerbosity = klog.Level(config.ScrapeLogVerbosity)
+	kc.partialReadRetries = config.PartialReadRetries
+	if config.NodeCADir != "" {
+		kc.nodeCAs = newNodeCAClients(config.NodeCADir, func(caData []byte) (*http.Client, error) {
+			nodeConfig := restConfig
+			nodeConfig.TLSClientConfig.CAFile = ""
+			nodeConfig.TLSClientConfig.CAData = caData
+			c, err := newHTTPClient(config, &nodeConfig)
+			if err != nil {
+				return nil, err
+			}
+			// Client timeout applies to all nodes, see newClient.
+			c.Timeout = kc.client.Timeout
+			return c, nil
+		})
+	}
+	return kc, nil
+}
 
-	c := &http.Client{
+// newHTTPClient constructs client connecting to Kubelets with the given rest config.
+func newHTTPClient(config *client.KubeletClientConfig, restConfig *rest.Config) (*http.Client, error) {
+	var transport http.RoundTripper
+	var err error
+	if config.TLSHandshakeTimeout > 0 || config.ResponseHeaderTimeout > 0 {
+		transport, err = transportWithTimeouts(restConfig, config.TLSHandshakeTimeout, config.ResponseHeaderTimeout)
+	} else {
+		transport, err = rest.TransportFor(restConfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct transport: %v", err)
+	}
+	if config.WrapTransport != nil {
+		transport = config.WrapTransport(transport)
+	}
+	return &http.Client{
 		Transport: transport,
 		Timeout:   config.Client.Timeout,
+	}, nil
+}
+
+// hostResolver returns resolver querying the given DNS server, or the system resolver if empty.
+func hostResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// transportWithTimeouts constructs transport like rest.TransportFor, but with the given TLS handshake
+// and response header timeouts, which can't be configured via rest.Config. Zero uses the defaults.
+func transportWithTimeouts(restConfig *rest.Config, tlsHandshakeTimeout, responseHeaderTimeout time.Duration) (http.RoundTripper, error) {
+	tlsConfig, err := rest.TLSConfigFor(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	dial := restConfig.Dial
+	if dial == nil {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		dial = dialer.DialContext
 	}
-	return newClient(c, utils.NewPriorityNodeAddressResolver(config.AddressTypePriority), config.DefaultPort, config.Scheme, config.UseNodeStatusPort), nil
+	transport := &http.Transport{
+		Proxy:                 restConfig.Proxy,
+		TLSClientConfig:       tlsConfig,
+		DialContext:           dial,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+	}
+	return rest.HTTPWrappersForConfig(restConfig, utilnet.SetTransportDefaults(transport))
 }
 
-func newClient(c *http.Client, resolver utils.NodeAddressResolver, defaultPort int, scheme string, useNodeStatusPort bool) *kubeletClient {
+// dialResolvedAddress wraps dial function to connect to address passed in request context, if present.
+// Request URL host is then only used for TLS server name verification and connection pooling.
+func dialResolvedAddress(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dial == nil {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		dial = dialer.DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if resolved, ok := ctx.Value(dialAddressKey{}).(string); ok {
+			address = resolved
+		}
+		return dial(ctx, network, address)
+	}
+}
+
+func newClient(c *http.Client, resolver utils.NodeAddressResolver, defaultPort int, scheme string, useNodeStatusPort bool, timeout time.Duration, opts decodeOptions) *kubeletClient {
+	// Client timeout guards against connections hanging before response headers, independently of request context.
+	if timeout > 0 {
+		c.Timeout = timeout
+	}
 	return &kubeletClient{
-		addrResolver:      resolver,
-		defaultPort:       defaultPort,
-		client:            c,
-		scheme:            scheme,
-		useNodeStatusPort: useNodeStatusPort,
+		addrResolver:       resolver,
+		defaultPort:        defaultPort,
+		client:             c,
+		scheme:             scheme,
+		useNodeStatusPort:  useNodeStatusPort,
+		decodeOptions:      opts,
+		logVerbosity:       defaultScrapeLogVerbosity,
+		partialReadRetries: 1,
 		buffers: sync.Pool{
 			New: func() interface{} {
 				buf := make([]byte, 10e3)
@@ -92,29 +245,74 @@ func (kc *kubeletClient) GetMetrics(ctx context.Context, node *corev1.Node) (*st
 	}
 	addr, err := kc.addrResolver.NodeAddress(node)
 	if err != nil {
+		nodeAddressUnresolved.WithLabelValues(node.Name).Inc()
 		return nil, err
 	}
+	host := net.JoinHostPort(addr, strconv.Itoa(port))
+	if kc.serverNameFromHostname {
+		ctx = context.WithValue(ctx, dialAddressKey{}, host)
+		host = net.JoinHostPort(nodeHostname(node), strconv.Itoa(port))
+	}
 	url := url.URL{
 		Scheme: kc.scheme,
-		Host:   net.JoinHostPort(addr, strconv.Itoa(port)),
+		Host:   host,
 		Path:   path,
 	}
 	return kc.getMetrics(ctx, url.String(), node.Name)
 }
 
 func (kc *kubeletClient) getMetrics(ctx context.Context, url, nodeName string) (*storage.MetricsBatch, error) {
-	req, err := http.NewRequest("GET", url, nil)
+	startTime := time.Now()
+	httpClient, err := kc.clientFor(nodeName)
 	if err != nil {
 		return nil, err
 	}
+	ms, size, err := kc.fetchMetrics(ctx, httpClient, url, nodeName)
+	var partialErr partialReadError
+	for retry := 0; retry < kc.partialReadRetries && errors.As(err, &partialErr) && ctx.Err() == nil; retry++ {
+		klog.V(2).InfoS("Retrying scrape after incomplete response body", "node", nodeName, "err", err)
+		ms, size, err = kc.fetchMetrics(ctx, httpClient, url, nodeName)
+	}
+	var podCount int
+	if ms != nil {
+		podCount = len(ms.Pods)
+	}
+	klog.V(kc.logVerbosity).InfoS("Scraped node", "node", nodeName, "duration", time.Since(startTime), "bytes", size, "podCount", podCount, "err", err)
+	return ms, err
+}
+
+// ForgetNode implements client.NodeForgetter, dropping series of the node from per-node metrics
+// and client built from its CA bundle.
+func (kc *kubeletClient) ForgetNode(nodeName string) {
+	deleteNodeMetrics(nodeName)
+	kc.nodeCAs.forget(nodeName)
+}
+
+// clientFor returns client connecting to Kubelet of the node.
+func (kc *kubeletClient) clientFor(nodeName string) (*http.Client, error) {
+	c, err := kc.nodeCAs.clientFor(nodeName)
+	if err != nil || c == nil {
+		return kc.client, err
+	}
+	return c, nil
+}
+
+// fetchMetrics requests and decodes metrics from Kubelet, returning also size of the response body.
+func (kc *kubeletClient) fetchMetrics(ctx context.Context, httpClient *http.Client, url, nodeName string) (*storage.MetricsBatch, int, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
 	requestTime := time.Now()
-	response, err := kc.client.Do(req.WithContext(ctx))
+	response, err := httpClient.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		scrapeErrors.WithLabelValues(requestErrorReason(err)).Inc()
+		return nil, 0, err
 	}
 	defer response.Body.Close()
 	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request failed, status: %q", response.Status)
+		scrapeErrors.WithLabelValues(scrapeErrorHTTPStatus).Inc()
+		return nil, 0, fmt.Errorf("request failed, status: %q", response.Status)
 	}
 	bp := kc.buffers.Get().(*[]byte)
 	b := *bp
@@ -122,16 +320,66 @@ func (kc *kubeletClient) getMetrics(ctx context.Context, url, nodeName string) (
 		*bp = b
 		kc.buffers.Put(bp)
 	}()
+	contentType := response.Header.Get("Content-Type")
+	if kc.decodeOptions.parallelism < 2 && parserContentType(contentType) == "" {
+		// Text format is decoded as it's streamed, unless whole response is needed for parallel decoding.
+		var ms *storage.MetricsBatch
+		var size int
+		ms, size, b, err = decodeStream(response.Body, b, requestTime, nodeName, kc.decodeOptions)
+		var partialErr partialReadError
+		switch {
+		case errors.As(err, &partialErr):
+			scrapeErrors.WithLabelValues(requestErrorReason(partialErr.err)).Inc()
+		case err != nil:
+			scrapeErrors.WithLabelValues(scrapeErrorDecode).Inc()
+		}
+		return ms, size, err
+	}
 	buf := bytes.NewBuffer(b)
 	buf.Reset()
 	_, err = io.Copy(buf, response.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body - %v", err)
+		scrapeErrors.WithLabelValues(requestErrorReason(err)).Inc()
+		return nil, 0, partialReadError{err: err}
 	}
 	b = buf.Bytes()
-	ms, err := decodeBatch(b, requestTime, nodeName)
+	ms, err := decodeBatch(b, contentType, requestTime, nodeName, kc.decodeOptions)
 	if err != nil {
-		return nil, err
+		scrapeErrors.WithLabelValues(scrapeErrorDecode).Inc()
+		return nil, len(b), err
+	}
+	return ms, len(b), nil
+}
+
+// partialReadError is returned when reading response body fails, e.g. on connection reset, leaving it incomplete.
+// Unlike decode errors, such scrapes are retried.
+type partialReadError struct {
+	err error
+}
+
+func (e partialReadError) Error() string {
+	return fmt.Sprintf("failed to read response body - %v", e.err)
+}
+
+func (e partialReadError) Unwrap() error {
+	return e.err
+}
+
+// nodeHostname returns hostname address of the node, falling back to node name.
+func nodeHostname(node *corev1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeHostName && addr.Address != "" {
+			return addr.Address
+		}
+	}
+	return node.Name
+}
+
+// requestErrorReason categorizes error of request to Kubelet as a timeout or a connection error.
+func requestErrorReason(err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return scrapeErrorTimeout
 	}
-	return ms, nil
+	return scrapeErrorConnection
 }
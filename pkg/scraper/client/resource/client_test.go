@@ -15,10 +15,31 @@
 package resource
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/component-base/metrics/testutil"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/textlogger"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 func BenchmarkKubeletClient_GetMetrics(b *testing.B) {
@@ -27,7 +48,7 @@ func BenchmarkKubeletClient_GetMetrics(b *testing.B) {
 	}))
 	defer s.Close()
 
-	c := newClient(s.Client(), nil, 0, "http", false)
+	c := newClient(s.Client(), nil, 0, "http", false, 0, decodeOptions{})
 	b.ResetTimer()
 	b.ReportAllocs()
 
@@ -47,7 +68,7 @@ func TestGetMetrics(t *testing.T) {
 	}))
 	defer s.Close()
 
-	c := newClient(s.Client(), nil, 0, "http", false)
+	c := newClient(s.Client(), nil, 0, "http", false, 0, decodeOptions{})
 
 	ctx := context.Background()
 
@@ -63,6 +84,565 @@ func TestGetMetrics(t *testing.T) {
 	}
 }
 
+func TestGetMetrics_ChunkedResponse(t *testing.T) {
+	defer func(size int) { streamDecodeMinBuffer = size }(streamDecodeMinBuffer)
+	streamDecodeMinBuffer = 1 << 10
+
+	s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// Chunks split lines, no Content-Length makes the response chunked
+		for i := 0; i < len(resourceResponse); i += 100 {
+			_, _ = writer.Write([]byte(resourceResponse[i:min(i+100, len(resourceResponse))]))
+			writer.(http.Flusher).Flush()
+		}
+	}))
+	defer s.Close()
+
+	c := newClient(s.Client(), nil, 0, "http", false, 0, decodeOptions{})
+	c.buffers.New = func() interface{} {
+		buf := []byte{}
+		return &buf
+	}
+
+	ms, err := c.getMetrics(context.Background(), s.URL, "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms.Nodes) != 1 {
+		t.Fatalf("No node metrics")
+	}
+	if len(ms.Pods) != 70 {
+		t.Fatalf("Unexpected number of pods, want: %d, got %d", 70, len(ms.Pods))
+	}
+	bp := c.buffers.Get().(*[]byte)
+	if cap(*bp) >= len(resourceResponse) {
+		t.Errorf("Response was fully buffered, buffer size: %d, response size: %d", cap(*bp), len(resourceResponse))
+	}
+}
+
+func TestNewForConfig_WrapTransport(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("X-Custom-Auth") != "token" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = writer.Write([]byte(resourceResponse))
+	}))
+	defer s.Close()
+
+	c, err := NewForConfig(&client.KubeletClientConfig{
+		Scheme: "http",
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req = req.Clone(req.Context())
+				req.Header.Set("X-Custom-Auth", "token")
+				return rt.RoundTrip(req)
+			})
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = c.getMetrics(context.Background(), s.URL, "node1")
+	if err != nil {
+		t.Fatalf("Expected wrapped transport to set header, got: %v", err)
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestKubeletClient_ClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-done
+	}))
+	defer s.Close()
+	defer close(done)
+
+	c := newClient(s.Client(), nil, 0, "http", false, 100*time.Millisecond, decodeOptions{})
+
+	_, err := c.getMetrics(context.Background(), s.URL, "node1")
+	if err == nil {
+		t.Fatal("Expected client timeout error, got nil")
+	}
+	if !strings.Contains(err.Error(), "Client.Timeout exceeded") {
+		t.Fatalf("Expected client timeout error, got %v", err)
+	}
+}
+
+func TestKubeletClient_TLSServerNameFromHostname(t *testing.T) {
+	certPEM, keyPEM, err := certutil.GenerateSelfSignedCertKey("node1.kubelet.test", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(resourceResponse))
+	}))
+	s.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.StartTLS()
+	defer s.Close()
+
+	host, portStr, err := net.SplitHostPort(s.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "node1.kubelet.test"},
+				{Type: corev1.NodeInternalIP, Address: host},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name                      string
+		tlsServerNameFromHostname bool
+		wantErr                   bool
+	}{
+		{
+			name:    "Certificate is not valid for node IP",
+			wantErr: true,
+		},
+		{
+			name:                      "Certificate is verified against node hostname",
+			tlsServerNameFromHostname: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewForConfig(&client.KubeletClientConfig{
+				Client:                    rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: certPEM}},
+				AddressTypePriority:       []corev1.NodeAddressType{corev1.NodeInternalIP},
+				Scheme:                    "https",
+				DefaultPort:               port,
+				TLSServerNameFromHostname: tc.tlsServerNameFromHostname,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			_, err = c.GetMetrics(context.Background(), node)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Unexpected error, wantErr: %v, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestKubeletClient_NodeCADir(t *testing.T) {
+	newServer := func() (*httptest.Server, []byte, int32) {
+		certPEM, keyPEM, err := certutil.GenerateSelfSignedCertKey("kubelet.test", []net.IP{net.ParseIP("127.0.0.1")}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		s := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			_, _ = writer.Write([]byte(resourceResponse))
+		}))
+		s.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		s.StartTLS()
+		_, portStr, err := net.SplitHostPort(s.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return s, certPEM, int32(port)
+	}
+	nodeServer, nodeCA, nodePort := newServer()
+	defer nodeServer.Close()
+	clusterServer, clusterCA, clusterPort := newServer()
+	defer clusterServer.Close()
+	node := func(name string, port int32) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Addresses:       []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "127.0.0.1"}},
+				DaemonEndpoints: corev1.NodeDaemonEndpoints{KubeletEndpoint: corev1.DaemonEndpoint{Port: port}},
+			},
+		}
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"node1", "node3"} {
+		if err := os.WriteFile(filepath.Join(dir, name+".crt"), nodeCA, 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	c, err := NewForConfig(&client.KubeletClientConfig{
+		Client:              rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: clusterCA}},
+		AddressTypePriority: []corev1.NodeAddressType{corev1.NodeInternalIP},
+		Scheme:              "https",
+		UseNodeStatusPort:   true,
+		NodeCADir:           dir,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		node    *corev1.Node
+		wantErr bool
+	}{
+		{
+			name: "Node is verified with its CA",
+			node: node("node1", nodePort),
+		},
+		{
+			name: "Node without CA is verified with cluster CA",
+			node: node("node2", clusterPort),
+		},
+		{
+			name:    "Node with CA is not verified with cluster CA",
+			node:    node("node3", clusterPort),
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := c.GetMetrics(context.Background(), tc.node)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Unexpected error, wantErr: %v, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	// Rotated CA of node is read on next scrape.
+	path := filepath.Join(dir, "node1.crt")
+	if err := os.WriteFile(path, clusterCA, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Modification time is moved explicitly, as the file system can keep it unchanged for quick writes.
+	rotated := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, rotated, rotated); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.GetMetrics(context.Background(), node("node1", nodePort)); err == nil {
+		t.Errorf("Expected node not to be verified with its previous CA")
+	}
+	if _, err := c.GetMetrics(context.Background(), node("node1", clusterPort)); err != nil {
+		t.Errorf("Expected node to be verified with its rotated CA, got: %v", err)
+	}
+
+	// Clients of nodes no longer scraped are dropped.
+	c.ForgetNode("node1")
+	if _, found := c.nodeCAs.clients["node1"]; found {
+		t.Errorf("Expected client of forgotten node to be dropped")
+	}
+}
+
+func TestNewForConfig_ForceHTTP1(t *testing.T) {
+	var protoMajor int
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		protoMajor = request.ProtoMajor
+		_, _ = writer.Write([]byte(resourceResponse))
+	}))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	defer s.Close()
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+
+	for _, tc := range []struct {
+		name           string
+		forceHTTP1     bool
+		wantProtoMajor int
+	}{
+		{
+			name:           "HTTP/2 is negotiated by default",
+			wantProtoMajor: 2,
+		},
+		{
+			name:           "HTTP/1.1 is forced",
+			forceHTTP1:     true,
+			wantProtoMajor: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewForConfig(&client.KubeletClientConfig{
+				Client:     rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: caData}},
+				Scheme:     "https",
+				ForceHTTP1: tc.forceHTTP1,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			_, err = c.getMetrics(context.Background(), s.URL, "node1")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if protoMajor != tc.wantProtoMajor {
+				t.Errorf("Unexpected HTTP version, want: %d, got: %d", tc.wantProtoMajor, protoMajor)
+			}
+		})
+	}
+}
+
+func TestNewForConfig_TLSHandshakeTimeout(t *testing.T) {
+	// Listener accepting connections without ever completing TLS handshake.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	c, err := NewForConfig(&client.KubeletClientConfig{
+		Client:                rest.Config{TLSClientConfig: rest.TLSClientConfig{Insecure: true}},
+		Scheme:                "https",
+		TLSHandshakeTimeout:   100 * time.Millisecond,
+		ResponseHeaderTimeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = c.getMetrics(ctx, "https://"+l.Addr().String(), "node1")
+	if err == nil || !strings.Contains(err.Error(), "TLS handshake timeout") {
+		t.Errorf("Expected TLS handshake timeout, got: %v", err)
+	}
+	(<-accepted).Close()
+}
+
+func TestKubeletClient_NodeAddressUnresolved(t *testing.T) {
+	nodeAddressUnresolved.Create(nil)
+	nodeAddressUnresolved.Reset()
+
+	c := newClient(&http.Client{}, utils.NewPriorityNodeAddressResolver(utils.DefaultAddressTypePriority), 10250, "https", false, 0, decodeOptions{})
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: "Unknown", Address: "10.0.0.1"},
+		}},
+	}
+	_, err := c.GetMetrics(context.Background(), node)
+	if err == nil {
+		t.Fatal("Expected error for node without resolvable address")
+	}
+	err = testutil.CollectAndCompare(nodeAddressUnresolved, strings.NewReader(`
+	# HELP metrics_server_node_address_unresolved_total [ALPHA] Number of scrapes skipped as node had no address matching preferred address types.
+	# TYPE metrics_server_node_address_unresolved_total counter
+	metrics_server_node_address_unresolved_total{node="node1"} 1
+	`), "metrics_server_node_address_unresolved_total")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+}
+
+func TestKubeletClient_ForgetNode(t *testing.T) {
+	nodeFilesystemUsage.Create(nil)
+	nodeContainerDropRatio.Create(nil)
+	unhealthyBatches.Create(nil)
+	nodeFilesystemUsage.Reset()
+	nodeContainerDropRatio.Reset()
+	unhealthyBatches.Reset()
+	for _, node := range []string{"node1", "node2"} {
+		nodeFilesystemUsage.WithLabelValues(node).Set(100)
+		nodeContainerDropRatio.WithLabelValues(node).Set(0.5)
+		unhealthyBatches.WithLabelValues(node).Inc()
+	}
+
+	c := newClient(&http.Client{}, utils.NewPriorityNodeAddressResolver(utils.DefaultAddressTypePriority), 10250, "https", false, 0, decodeOptions{})
+	c.ForgetNode("node2")
+
+	err := testutil.CollectAndCompare(nodeFilesystemUsage, strings.NewReader(`
+	# HELP metrics_server_node_filesystem_usage_bytes [ALPHA] Filesystem usage of the node in bytes, if exposed by Kubelet.
+	# TYPE metrics_server_node_filesystem_usage_bytes gauge
+	metrics_server_node_filesystem_usage_bytes{node="node1"} 100
+	`), "metrics_server_node_filesystem_usage_bytes")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+	err = testutil.CollectAndCompare(nodeContainerDropRatio, strings.NewReader(`
+	# HELP metrics_server_node_container_drop_ratio [ALPHA] Fraction of containers running on the node dropped while decoding the last Kubelet response.
+	# TYPE metrics_server_node_container_drop_ratio gauge
+	metrics_server_node_container_drop_ratio{node="node1"} 0.5
+	`), "metrics_server_node_container_drop_ratio")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+	err = testutil.CollectAndCompare(unhealthyBatches, strings.NewReader(`
+	# HELP metrics_server_kubelet_unhealthy_responses_total [ALPHA] Number of Kubelet responses skipped as their health series indicated Kubelet is unhealthy.
+	# TYPE metrics_server_kubelet_unhealthy_responses_total counter
+	metrics_server_kubelet_unhealthy_responses_total{node="node1"} 1
+	`), "metrics_server_kubelet_unhealthy_responses_total")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+}
+
+func TestKubeletClient_ScrapeLog(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(resourceResponse))
+	}))
+	defer s.Close()
+
+	var buf bytes.Buffer
+	klog.SetLogger(textlogger.NewLogger(textlogger.NewConfig(textlogger.Output(&buf))))
+	defer klog.ClearLogger()
+
+	c := newClient(s.Client(), nil, 0, "http", false, 0, decodeOptions{})
+	c.logVerbosity = 0
+	_, err := c.getMetrics(context.Background(), s.URL, "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	klog.Flush()
+	out := buf.String()
+	for _, field := range []string{`"Scraped node"`, `node="node1"`, "duration=", fmt.Sprintf("bytes=%d", len(resourceResponse)), "podCount=70", "err=null"} {
+		if !strings.Contains(out, field) {
+			t.Errorf("Expected log to contain %s, got: %s", field, out)
+		}
+	}
+}
+
+func TestKubeletClient_ScrapeErrors(t *testing.T) {
+	closed := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	closed.Close()
+
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		url     string
+		reason  string
+	}{
+		{
+			name:   "Connection error",
+			url:    closed.URL,
+			reason: "connection",
+		},
+		{
+			name: "HTTP status error",
+			handler: func(writer http.ResponseWriter, request *http.Request) {
+				writer.WriteHeader(http.StatusUnauthorized)
+			},
+			reason: "http_status",
+		},
+		{
+			name: "Decode error",
+			handler: func(writer http.ResponseWriter, request *http.Request) {
+				_, _ = writer.Write([]byte("container_cpu_usage_seconds_total{ invalid"))
+			},
+			reason: "decode",
+		},
+		{
+			name: "Timeout",
+			handler: func(writer http.ResponseWriter, request *http.Request) {
+				<-request.Context().Done()
+			},
+			reason: "timeout",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			scrapeErrors.Create(nil)
+			scrapeErrors.Reset()
+			c := newClient(&http.Client{}, nil, 0, "http", false, 100*time.Millisecond, decodeOptions{})
+			url := tc.url
+			if tc.handler != nil {
+				s := httptest.NewServer(tc.handler)
+				defer s.Close()
+				url = s.URL
+			}
+
+			_, err := c.getMetrics(context.Background(), url, "node1")
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			err = testutil.CollectAndCompare(scrapeErrors, strings.NewReader(fmt.Sprintf(`
+			# HELP metrics_server_scrape_error_total [ALPHA] Number of failed requests to Kubelet resource metrics endpoint by reason: connection, http_status, decode or timeout.
+			# TYPE metrics_server_scrape_error_total counter
+			metrics_server_scrape_error_total{reason=%q} 1
+			`, tc.reason)), "metrics_server_scrape_error_total")
+			if err != nil {
+				t.Errorf("Unexpected metrics: %v", err)
+			}
+		})
+	}
+}
+
+func TestKubeletClient_PartialReadRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		retries       int
+		truncated     int
+		expectErr     bool
+		expectRequest int
+	}{
+		{
+			name:          "Retries once after incomplete body",
+			retries:       1,
+			truncated:     1,
+			expectRequest: 2,
+		},
+		{
+			name:          "Fails when retries are exhausted",
+			retries:       1,
+			truncated:     2,
+			expectErr:     true,
+			expectRequest: 2,
+		},
+		{
+			name:          "Retries can be disabled",
+			retries:       0,
+			truncated:     1,
+			expectErr:     true,
+			expectRequest: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				requests++
+				if requests > tc.truncated {
+					_, _ = writer.Write([]byte(resourceResponse))
+					return
+				}
+				// Announce whole body, but close connection after sending half of it
+				writer.Header().Set("Content-Length", strconv.Itoa(len(resourceResponse)))
+				_, _ = writer.Write([]byte(resourceResponse[:len(resourceResponse)/2]))
+				writer.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}))
+			defer s.Close()
+
+			c := newClient(s.Client(), nil, 0, "http", false, 0, decodeOptions{})
+			c.partialReadRetries = tc.retries
+			ms, err := c.getMetrics(context.Background(), s.URL, "node1")
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err == nil && len(ms.Pods) != 70 {
+				t.Errorf("Expected metrics of 70 pods, got %d", len(ms.Pods))
+			}
+			if requests != tc.expectRequest {
+				t.Errorf("Expected %d requests, got %d", tc.expectRequest, requests)
+			}
+		})
+	}
+}
+
 const resourceResponse = `
 # HELP container_cpu_usage_seconds_total [ALPHA] Cumulative cpu time consumed by the container in core-seconds
 # TYPE container_cpu_usage_seconds_total counter
@@ -18,6 +18,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
+	"mime"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/prometheus/prometheus/model/textparse"
@@ -26,27 +30,470 @@ import (
 	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
 
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 	"sigs.k8s.io/metrics-server/pkg/storage"
 )
 
 var (
 	nodeCpuUsageMetricName       = []byte("node_cpu_usage_seconds_total")
 	nodeMemUsageMetricName       = []byte("node_memory_working_set_bytes")
+	nodeFsUsageMetricName        = []byte("node_filesystem_usage_bytes")
 	containerCpuUsageMetricName  = []byte("container_cpu_usage_seconds_total")
 	containerMemUsageMetricName  = []byte("container_memory_working_set_bytes")
 	containerStartTimeMetricName = []byte("container_start_time_seconds")
+	containerOOMEventsMetricName = []byte("container_oom_events_total")
+	podCpuUsageMetricName        = []byte("pod_cpu_usage_seconds_total")
+	podMemUsageMetricName        = []byte("pod_memory_working_set_bytes")
+	// Swap usage is not stored, only counted for tracking coverage of resource types.
+	nodeSwapUsageMetricName      = []byte("node_swap_usage_bytes")
+	containerSwapUsageMetricName = []byte("container_swap_usage_bytes")
 )
 
-func decodeBatch(b []byte, defaultTime time.Time, nodeName string) (*storage.MetricsBatch, error) {
-	res := &storage.MetricsBatch{
-		Nodes: make(map[string]storage.MetricsPoint),
-		Pods:  make(map[apitypes.NamespacedName]storage.PodMetricsPoint),
+// decodedMetricNames are names of metrics decoded from Kubelet responses, which can be mapped to names reported by Kubelet.
+var decodedMetricNames = [][]byte{
+	nodeCpuUsageMetricName,
+	nodeMemUsageMetricName,
+	nodeFsUsageMetricName,
+	containerCpuUsageMetricName,
+	containerMemUsageMetricName,
+	containerStartTimeMetricName,
+	containerOOMEventsMetricName,
+	podCpuUsageMetricName,
+	podMemUsageMetricName,
+	nodeSwapUsageMetricName,
+	containerSwapUsageMetricName,
+}
+
+// metricNameMapping returns mapping of names reported by Kubelet to decoded metric names, inverting the given
+// mapping of decoded metric names to reported ones. Returns error for names that are not decoded.
+func metricNameMapping(names map[string]string) (map[string]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	mapping := make(map[string]string, len(names))
+	for name, reported := range names {
+		if !isDecodedMetricName(name) {
+			return nil, fmt.Errorf("unknown metric name %q", name)
+		}
+		mapping[reported] = name
+	}
+	return mapping, nil
+}
+
+func isDecodedMetricName(name string) bool {
+	for _, decoded := range decodedMetricNames {
+		if string(decoded) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeOptions configures how a Kubelet response is decoded. Zero value preserves the default behavior.
+type decodeOptions struct {
+	// allowMissingNodeMemory keeps node metrics with CPU usage only instead of dropping them.
+	allowMissingNodeMemory bool
+	// allowZeroMemory keeps containers reporting zero memory working set instead of dropping them.
+	allowZeroMemory bool
+	// maxContainersPerPod limits the number of containers stored per pod. Zero means unlimited.
+	maxContainersPerPod int
+	// nodeLabel is the name of the label identifying node of series, allowing to decode
+	// metrics of multiple nodes from a single response. Empty means single node response.
+	nodeLabel string
+	// podLevelCpu decodes pod-level CPU usage, which can differ from the sum of containers usage due to pod overhead.
+	podLevelCpu bool
+	// podLevelMemory decodes pod-level memory usage, which can differ from the sum of containers usage due to pod overhead.
+	podLevelMemory bool
+	// onDuplicateSeries selects how repeated container CPU and memory series are handled. Empty keeps the last value.
+	onDuplicateSeries string
+	// healthSeries is the name of the series indicating Kubelet health, zero value meaning unhealthy.
+	// Whole response is skipped if it's unhealthy. Empty disables health gating.
+	healthSeries string
+	// nodeCpuGauge is the name of the series reporting node CPU usage in cores as a gauge, for Kubelets
+	// not exposing cumulative usage. Empty disables it.
+	nodeCpuGauge string
+	// parallelism is the number of parts large Prometheus text format responses are split into by metric family
+	// and decoded concurrently. Values below 2 decode responses serially.
+	parallelism int
+	// approximateNodeMemory approximates missing node memory usage as the sum of memory usage of its pods
+	// increased by nodeMemoryOverhead, instead of dropping the node.
+	approximateNodeMemory bool
+	nodeMemoryOverhead    uint64
+	// includedNamespaces restricts decoded pods to the given namespaces. Nil means all namespaces.
+	includedNamespaces map[string]struct{}
+	// observeTimeSkew observes difference between scrape time and timestamps of node points per node.
+	observeTimeSkew bool
+	// metricNames maps names of metrics reported by Kubelet to decoded metric names. Nil uses the reported names.
+	metricNames map[string]string
+	// timestampScale converts timestamps reported by Kubelet to milliseconds. Zero means they are in milliseconds.
+	timestampScale int64
+}
+
+// renameSeries returns the series with metric name mapped to decoded metric name, if mapping is configured.
+func (o decodeOptions) renameSeries(timeseries []byte) []byte {
+	if len(o.metricNames) == 0 {
+		return timeseries
+	}
+	end := bytes.IndexByte(timeseries, '{')
+	if end < 0 {
+		end = len(timeseries)
+	}
+	name, found := o.metricNames[string(timeseries[:end])]
+	if !found {
+		return timeseries
+	}
+	return append([]byte(name), timeseries[end:]...)
+}
+
+// seriesNode returns name of the node the series belongs to.
+func (o decodeOptions) seriesNode(labels []byte, defaultNode string) string {
+	if o.nodeLabel == "" {
+		return defaultNode
+	}
+	if node := parseLabelValue(labels, o.nodeLabel); node != "" {
+		return node
+	}
+	return defaultNode
+}
+
+// containerSeries identifies a container series within a single response.
+type containerSeries struct {
+	metric    string
+	pod       apitypes.NamespacedName
+	container string
+}
+
+// seriesValues tracks values of container series decoded from a single response, resolving repeated series.
+type seriesValues struct {
+	onDuplicate string
+	values      map[containerSeries]float64
+}
+
+// resolve returns the value to store for the series, based on values of the same series seen before.
+func (s seriesValues) resolve(metric []byte, pod apitypes.NamespacedName, container string, value float64) (float64, error) {
+	key := containerSeries{metric: string(metric), pod: pod, container: container}
+	if prev, found := s.values[key]; found {
+		duplicateSeries.WithLabelValues(key.metric).Inc()
+		switch s.onDuplicate {
+		case client.DuplicateSeriesError:
+			return 0, fmt.Errorf("duplicate series %s for container %q of pod %s", key.metric, container, pod)
+		case client.DuplicateSeriesSum:
+			value += prev
+		}
+	}
+	s.values[key] = value
+	return value, nil
+}
+
+// reported returns true if the series was present in the response.
+func (s seriesValues) reported(metric []byte, pod apitypes.NamespacedName, container string) bool {
+	_, found := s.values[containerSeries{metric: string(metric), pod: pod, container: container}]
+	return found
+}
+
+// openMetricsContentType is the media type of OpenMetrics responses, which can carry exemplars.
+const openMetricsContentType = "application/openmetrics-text"
+
+// parserContentType returns the content type the response should be parsed with. Only OpenMetrics
+// is passed through, as other formats are parsed as Prometheus text format.
+func parserContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != openMetricsContentType {
+		return ""
+	}
+	return contentType
+}
+
+func decodeBatch(b []byte, contentType string, defaultTime time.Time, nodeName string, opts decodeOptions) (*storage.MetricsBatch, error) {
+	var s *decodeState
+	if opts.parallelism > 1 && len(b) >= parallelDecodeMinBytes && parserContentType(contentType) == "" {
+		var err error
+		if s, err = decodeParallel(b, defaultTime, nodeName, opts); err != nil {
+			return nil, err
+		}
+	} else {
+		s = newDecodeState(nodeName, opts)
+		if err := s.parse(b, contentType, defaultTime, nodeName, opts); err != nil {
+			return nil, err
+		}
+	}
+	return s.result(defaultTime, nodeName, opts), nil
+}
+
+// result returns metrics batch of the decoded response, observing metrics about it.
+func (s *decodeState) result(defaultTime time.Time, nodeName string, opts decodeOptions) *storage.MetricsBatch {
+	res := s.batch(nodeName, opts)
+	for _, resourceType := range resourceTypes {
+		batchResourceTypes.WithLabelValues(nodeName, resourceType).Set(float64(s.resourcePoints[resourceType]))
+	}
+	if opts.observeTimeSkew {
+		for name, node := range res.Nodes {
+			scrapeTimeSkew.WithLabelValues(name).Observe(defaultTime.Sub(node.Timestamp).Seconds())
+		}
+	}
+	return res
+}
+
+// streamDecodeMinBuffer is the minimal size of buffer used to decode streamed responses.
+var streamDecodeMinBuffer = 4 << 10
+
+// decodeStream decodes Prometheus text format response read from r as it arrives, in parts of complete lines,
+// so memory used is bounded by the buffer, grown only for lines longer than it, instead of the response size.
+// Returns also number of bytes read and the buffer for reuse. Read errors are returned as partialReadError.
+func decodeStream(r io.Reader, buf []byte, defaultTime time.Time, nodeName string, opts decodeOptions) (*storage.MetricsBatch, int, []byte, error) {
+	if cap(buf) < streamDecodeMinBuffer {
+		buf = make([]byte, streamDecodeMinBuffer)
+	}
+	buf = buf[:cap(buf)]
+	s := newDecodeState(nodeName, opts)
+	size, filled := 0, 0
+	for {
+		n, err := r.Read(buf[filled:])
+		size += n
+		filled += n
+		if err != nil && err != io.EOF {
+			return nil, size, buf, partialReadError{err: err}
+		}
+		eof := err == io.EOF
+		end := filled
+		if !eof {
+			end = bytes.LastIndexByte(buf[:filled], '\n') + 1
+		}
+		if end > 0 {
+			if err := s.parse(buf[:end:end], "", defaultTime, nodeName, opts); err != nil {
+				return nil, size, buf, err
+			}
+			filled = copy(buf, buf[end:filled])
+		}
+		if eof {
+			break
+		}
+		if filled == len(buf) {
+			// Line doesn't fit in the buffer
+			buf = append(buf, make([]byte, len(buf))...)
+			buf = buf[:cap(buf)]
+		}
+	}
+	return s.result(defaultTime, nodeName, opts), size, buf, nil
+}
+
+// parallelDecodeMinBytes is the minimal size of response decoded in parallel, below which overhead of splitting
+// and merging outweighs the gain.
+var parallelDecodeMinBytes = 256 << 10
+
+// decodeParallel decodes metric families of the response concurrently, merging them in order of the response.
+func decodeParallel(b []byte, defaultTime time.Time, nodeName string, opts decodeOptions) (*decodeState, error) {
+	parts := splitFamilies(b, opts.parallelism)
+	states := make([]*decodeState, len(parts))
+	errs := make([]error, len(parts))
+	var wg sync.WaitGroup
+	for i, part := range parts {
+		wg.Add(1)
+		go func(i int, part []byte) {
+			defer wg.Done()
+			states[i] = newDecodeState(nodeName, opts)
+			errs[i] = states[i].parse(part, "", defaultTime, nodeName, opts)
+		}(i, part)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range states[1:] {
+		if err := states[0].merge(s); err != nil {
+			return nil, err
+		}
+	}
+	return states[0], nil
+}
+
+// splitFamilies splits Prometheus text format response into at most n parts of similar size, only between
+// metric families so that each family is decoded as a whole.
+func splitFamilies(b []byte, n int) [][]byte {
+	starts := familyStarts(b)
+	parts := make([][]byte, 0, n)
+	prev := 0
+	for k := 1; k < n; k++ {
+		i := sort.SearchInts(starts, max(k*len(b)/n, prev+1))
+		if i == len(starts) {
+			break
+		}
+		// limit capacity, so that appending to a part can't overwrite the following one
+		parts = append(parts, b[prev:starts[i]:starts[i]])
+		prev = starts[i]
+	}
+	return append(parts, b[prev:])
+}
+
+// familyStarts returns offsets of lines starting metric families in Prometheus text format response,
+// including comments preceding their first series.
+func familyStarts(b []byte) []int {
+	var (
+		starts   []int
+		prevName []byte
+		comments = -1
+	)
+	for offset := 0; offset < len(b); {
+		end := bytes.IndexByte(b[offset:], '\n')
+		if end == -1 {
+			end = len(b)
+		} else {
+			end += offset + 1
+		}
+		line := b[offset:end]
+		if line[0] == '#' || line[0] == '\n' {
+			if comments == -1 {
+				comments = offset
+			}
+			offset = end
+			continue
+		}
+		name := line
+		if i := bytes.IndexAny(line, "{ \t\n"); i != -1 {
+			name = line[:i]
+		}
+		if !bytes.Equal(name, prevName) {
+			start := offset
+			if comments != -1 {
+				start = comments
+			}
+			starts = append(starts, start)
+			prevName = name
+		}
+		comments = -1
+		offset = end
+	}
+	return starts
+}
+
+// decodeState holds series decoded from a response, or a part of it, before checking their completeness.
+type decodeState struct {
+	nodes     map[string]*storage.MetricsPoint
+	pods      map[apitypes.NamespacedName]storage.PodMetricsPoint
+	podNodes  map[apitypes.NamespacedName]string
+	podCpu    map[apitypes.NamespacedName]storage.MetricsPoint
+	podMem    map[apitypes.NamespacedName]uint64
+	series    seriesValues
+	oomKills  map[string]float64
+	unhealthy bool
+	// resourcePoints counts node and container series by resource type.
+	resourcePoints map[string]int
+}
+
+func newDecodeState(nodeName string, opts decodeOptions) *decodeState {
+	s := &decodeState{
+		nodes:          make(map[string]*storage.MetricsPoint),
+		pods:           make(map[apitypes.NamespacedName]storage.PodMetricsPoint),
+		podNodes:       make(map[apitypes.NamespacedName]string),
+		podCpu:         make(map[apitypes.NamespacedName]storage.MetricsPoint),
+		podMem:         make(map[apitypes.NamespacedName]uint64),
+		series:         seriesValues{onDuplicate: opts.onDuplicateSeries, values: make(map[containerSeries]float64)},
+		oomKills:       make(map[string]float64),
+		resourcePoints: make(map[string]int, len(resourceTypes)),
+	}
+	if opts.nodeLabel == "" {
+		s.nodes[nodeName] = &storage.MetricsPoint{}
+	}
+	return s
+}
+
+// merge adds series decoded from a following part of the response, which take precedence like later series do.
+// Container series repeated across parts are resolved the same way as series repeated within a part.
+func (s *decodeState) merge(o *decodeState) error {
+	for key, value := range o.series.values {
+		if !s.series.reported([]byte(key.metric), key.pod, key.container) {
+			s.series.values[key] = value
+			continue
+		}
+		value, err := s.series.resolve([]byte(key.metric), key.pod, key.container, value)
+		if err != nil {
+			return err
+		}
+		point := o.pods[key.pod].Containers[key.container]
+		if key.metric == string(containerCpuUsageMetricName) {
+			point.CumulativeCpuUsed = cpuSecondsToNanoseconds(value)
+		} else {
+			point.MemoryUsage = uint64(value)
+		}
+		o.pods[key.pod].Containers[key.container] = point
 	}
-	node := &storage.MetricsPoint{}
-	pods := make(map[apitypes.NamespacedName]storage.PodMetricsPoint)
-	parser, err := textparse.New(b, "", false, nil)
+	for name, point := range o.nodes {
+		if existing, found := s.nodes[name]; found {
+			mergePoint(existing, *point)
+		} else {
+			s.nodes[name] = point
+		}
+	}
+	for ref, pod := range o.pods {
+		existing, found := s.pods[ref]
+		if !found {
+			s.pods[ref] = pod
+			continue
+		}
+		for name, point := range pod.Containers {
+			if container, found := existing.Containers[name]; found {
+				mergePoint(&container, point)
+				existing.Containers[name] = container
+			} else {
+				existing.Containers[name] = point
+			}
+		}
+	}
+	for ref, node := range o.podNodes {
+		s.podNodes[ref] = node
+	}
+	for ref, point := range o.podCpu {
+		s.podCpu[ref] = point
+	}
+	for ref, memory := range o.podMem {
+		s.podMem[ref] = memory
+	}
+	for name, count := range o.oomKills {
+		s.oomKills[name] += count
+	}
+	for resourceType, count := range o.resourcePoints {
+		s.resourcePoints[resourceType] += count
+	}
+	s.unhealthy = s.unhealthy || o.unhealthy
+	return nil
+}
+
+// mergePoint overrides fields of the point set by the other one.
+func mergePoint(point *storage.MetricsPoint, other storage.MetricsPoint) {
+	if !other.StartTime.IsZero() {
+		point.StartTime = other.StartTime
+	}
+	if !other.Timestamp.IsZero() {
+		point.Timestamp = other.Timestamp
+	}
+	if other.CumulativeCpuUsed != 0 {
+		point.CumulativeCpuUsed = other.CumulativeCpuUsed
+	}
+	if other.CpuUsage != 0 {
+		point.CpuUsage = other.CpuUsage
+	}
+	if other.MemoryUsage != 0 {
+		point.MemoryUsage = other.MemoryUsage
+	}
+	if other.FilesystemUsage != 0 {
+		point.FilesystemUsage = other.FilesystemUsage
+	}
+}
+
+// parse decodes series of the response into the state.
+func (s *decodeState) parse(b []byte, contentType string, defaultTime time.Time, nodeName string, opts decodeOptions) error {
+	nodePoint := func(labels []byte) *storage.MetricsPoint {
+		name := opts.seriesNode(labels, nodeName)
+		if _, found := s.nodes[name]; !found {
+			s.nodes[name] = &storage.MetricsPoint{}
+		}
+		return s.nodes[name]
+	}
+	parser, err := textparse.New(b, parserContentType(contentType), false, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize Prometheus parser: %w", err)
+		return fmt.Errorf("failed to initialize Prometheus parser: %w", err)
 	}
 	var (
 		defaultTimestamp = timestamp.FromTime(defaultTime)
@@ -57,57 +504,200 @@ func decodeBatch(b []byte, defaultTime time.Time, nodeName string) (*storage.Met
 			if err == io.EOF {
 				break
 			} else {
-				return nil, fmt.Errorf("failed parsing metrics: %w", err)
+				return fmt.Errorf("failed parsing metrics: %w", err)
 			}
 		}
 		if et != textparse.EntrySeries {
 			continue
 		}
 		timeseries, maybeTimestamp, value := parser.Series()
+		timeseries = opts.renameSeries(timeseries)
 		if maybeTimestamp == nil {
 			maybeTimestamp = &defaultTimestamp
+		} else if opts.timestampScale > 1 {
+			scaledTimestamp := *maybeTimestamp * opts.timestampScale
+			maybeTimestamp = &scaledTimestamp
 		}
 		switch {
 		case timeseriesMatchesName(timeseries, nodeCpuUsageMetricName):
-			parseNodeCpuUsageMetrics(*maybeTimestamp, value, node)
+			s.resourcePoints[resourceTypeCpu]++
+			parseNodeCpuUsageMetrics(*maybeTimestamp, value, nodePoint(timeseries[len(nodeCpuUsageMetricName):]))
 		case timeseriesMatchesName(timeseries, nodeMemUsageMetricName):
-			parseNodeMemUsageMetrics(*maybeTimestamp, value, node)
+			s.resourcePoints[resourceTypeMemory]++
+			parseNodeMemUsageMetrics(*maybeTimestamp, value, nodePoint(timeseries[len(nodeMemUsageMetricName):]))
+		case timeseriesMatchesName(timeseries, nodeFsUsageMetricName):
+			s.resourcePoints[resourceTypeFilesystem]++
+			parseNodeFsUsageMetrics(value, nodePoint(timeseries[len(nodeFsUsageMetricName):]))
 		case timeseriesMatchesName(timeseries, containerCpuUsageMetricName):
 			namespaceName, containerName := parseContainerLabels(timeseries[len(containerCpuUsageMetricName):])
-			parseContainerCpuMetrics(namespaceName, containerName, *maybeTimestamp, value, pods)
+			if namespaceName.Namespace == "" {
+				// Node-level system containers don't belong to any pod, counted once per container by CPU series.
+				droppedContainers.WithLabelValues("empty_namespace").Inc()
+				continue
+			}
+			s.resourcePoints[resourceTypeCpu]++
+			if value, err = s.series.resolve(containerCpuUsageMetricName, namespaceName, containerName, value); err != nil {
+				return err
+			}
+			parseContainerCpuMetrics(namespaceName, containerName, *maybeTimestamp, value, s.pods)
+			s.podNodes[namespaceName] = opts.seriesNode(timeseries[len(containerCpuUsageMetricName):], nodeName)
 		case timeseriesMatchesName(timeseries, containerMemUsageMetricName):
 			namespaceName, containerName := parseContainerLabels(timeseries[len(containerMemUsageMetricName):])
-			parseContainerMemMetrics(namespaceName, containerName, *maybeTimestamp, value, pods)
+			if namespaceName.Namespace == "" {
+				continue
+			}
+			s.resourcePoints[resourceTypeMemory]++
+			if value, err = s.series.resolve(containerMemUsageMetricName, namespaceName, containerName, value); err != nil {
+				return err
+			}
+			parseContainerMemMetrics(namespaceName, containerName, *maybeTimestamp, value, s.pods)
 		case timeseriesMatchesName(timeseries, containerStartTimeMetricName):
 			namespaceName, containerName := parseContainerLabels(timeseries[len(containerStartTimeMetricName):])
-			parseContainerStartTimeMetrics(namespaceName, containerName, *maybeTimestamp, value, pods)
+			if namespaceName.Namespace == "" {
+				continue
+			}
+			parseContainerStartTimeMetrics(namespaceName, containerName, *maybeTimestamp, value, s.pods)
+		case opts.podLevelCpu && timeseriesMatchesName(timeseries, podCpuUsageMetricName):
+			namespaceName := parsePodLabels(timeseries[len(podCpuUsageMetricName):])
+			if namespaceName.Namespace == "" {
+				continue
+			}
+			s.podCpu[namespaceName] = storage.MetricsPoint{
+				CumulativeCpuUsed: cpuSecondsToNanoseconds(value),
+				// unit of timestamp is millisecond, need to convert to nanosecond
+				Timestamp: time.Unix(0, *maybeTimestamp*1e6),
+			}
+		case opts.nodeCpuGauge != "" && timeseriesMatchesName(timeseries, []byte(opts.nodeCpuGauge)):
+			s.resourcePoints[resourceTypeCpu]++
+			parseNodeCpuGaugeMetrics(*maybeTimestamp, value, nodePoint(timeseries[len(opts.nodeCpuGauge):]))
+		case opts.healthSeries != "" && timeseriesMatchesName(timeseries, []byte(opts.healthSeries)):
+			s.unhealthy = s.unhealthy || value == 0
+		case opts.podLevelMemory && timeseriesMatchesName(timeseries, podMemUsageMetricName):
+			namespaceName := parsePodLabels(timeseries[len(podMemUsageMetricName):])
+			if namespaceName.Namespace == "" {
+				continue
+			}
+			s.podMem[namespaceName] = uint64(value)
+		case timeseriesMatchesName(timeseries, nodeSwapUsageMetricName) || timeseriesMatchesName(timeseries, containerSwapUsageMetricName):
+			s.resourcePoints[resourceTypeSwap]++
+		case timeseriesMatchesName(timeseries, containerOOMEventsMetricName):
+			// OOM events are only exposed for observability and not stored
+			s.oomKills[opts.seriesNode(timeseries[len(containerOOMEventsMetricName):], nodeName)] += value
 		default:
 			continue
 		}
 	}
+	return nil
+}
 
-	if node.Timestamp.IsZero() || node.CumulativeCpuUsed == 0 || node.MemoryUsage == 0 {
-		klog.V(1).InfoS("Failed getting complete node metric", "node", nodeName, "metric", node)
-		node = nil
-	} else {
-		res.Nodes[nodeName] = *node
+// batch returns metrics batch with complete node and pod metrics of the state.
+func (s *decodeState) batch(nodeName string, opts decodeOptions) *storage.MetricsBatch {
+	res := &storage.MetricsBatch{
+		Nodes: make(map[string]storage.MetricsPoint),
+		Pods:  make(map[apitypes.NamespacedName]storage.PodMetricsPoint),
+	}
+	if s.unhealthy {
+		klog.V(1).InfoS("Skipping metrics reported by unhealthy Kubelet", "node", nodeName, "healthSeries", opts.healthSeries)
+		unhealthyBatches.WithLabelValues(nodeName).Inc()
+		return res
 	}
 
-	for podRef, podMetric := range pods {
+	for name, count := range s.oomKills {
+		nodeContainerOOMKills.WithLabelValues(name).Set(count)
+	}
+
+	// containerCount and droppedCount count containers per node, to expose the fraction of dropped containers
+	containerCount, droppedCount := map[string]int{}, map[string]int{}
+	for podRef, podMetric := range s.pods {
 		if len(podMetric.Containers) != 0 {
+			containerCount[s.podNodes[podRef]] += len(podMetric.Containers)
 			// drop container metrics when Timestamp is zero
 
+			zeroMemoryAllowed := func(containerName string) bool {
+				return opts.allowZeroMemory && s.series.reported(containerMemUsageMetricName, podRef, containerName)
+			}
+			containers, reason := checkContainerMetrics(podMetric, zeroMemoryAllowed)
 			pm := storage.PodMetricsPoint{
-				Containers: checkContainerMetrics(podMetric),
+				Node:       s.podNodes[podRef],
+				Containers: containers,
+			}
+			if cpu, found := s.podCpu[podRef]; found {
+				pm.CumulativeCpuUsed = cpu.CumulativeCpuUsed
+				pm.Timestamp = cpu.Timestamp
+			}
+			if mem, found := s.podMem[podRef]; found {
+				pm.MemoryUsage = mem
 			}
 			if pm.Containers == nil {
 				klog.V(1).InfoS("Failed getting complete Pod metric", "pod", klog.KRef(podRef.Namespace, podRef.Name))
+				podsDroppedPartial.WithLabelValues(reason).Inc()
+				droppedCount[s.podNodes[podRef]] += len(podMetric.Containers)
+				for containerName, containerMetric := range podMetric.Containers {
+					res.AddDroppedContainer(podRef, containerName, droppedContainerReason(containerMetric, zeroMemoryAllowed(containerName)))
+				}
 			} else {
+				if opts.maxContainersPerPod > 0 && len(pm.Containers) > opts.maxContainersPerPod {
+					for _, containerName := range dropExcessContainers(podRef, pm.Containers, opts.maxContainersPerPod) {
+						res.AddDroppedContainer(podRef, containerName, droppedContainerLimit)
+						droppedCount[pm.Node]++
+					}
+				}
 				res.Pods[podRef] = pm
 			}
 		}
 	}
-	return res, nil
+	for name, count := range containerCount {
+		nodeContainerDropRatio.WithLabelValues(name).Set(float64(droppedCount[name]) / float64(count))
+	}
+
+	var podMemory map[string]uint64
+	if opts.approximateNodeMemory {
+		podMemory = podMemoryByNode(res.Pods)
+	}
+	for name, node := range s.nodes {
+		if node.MemoryUsage == 0 && podMemory[name] != 0 {
+			node.MemoryUsage = podMemory[name] + opts.nodeMemoryOverhead
+			node.MemoryApproximate = true
+		}
+		if node.Timestamp.IsZero() || (node.CumulativeCpuUsed == 0 && node.CpuUsage == 0) || (node.MemoryUsage == 0 && !opts.allowMissingNodeMemory) {
+			klog.V(1).InfoS("Failed getting complete node metric", "node", name, "metric", node)
+			continue
+		}
+		res.Nodes[name] = *node
+		if node.FilesystemUsage != 0 {
+			nodeFilesystemUsage.WithLabelValues(name).Set(float64(node.FilesystemUsage))
+		}
+	}
+
+	// pods are dropped only after approximating node memory, as pods of other namespaces still use node memory
+	if opts.includedNamespaces != nil {
+		for podRef := range res.Pods {
+			if _, found := opts.includedNamespaces[podRef.Namespace]; !found {
+				delete(res.Pods, podRef)
+			}
+		}
+		for podRef := range res.DroppedContainers {
+			if _, found := opts.includedNamespaces[podRef.Namespace]; !found {
+				delete(res.DroppedContainers, podRef)
+			}
+		}
+	}
+	return res
+}
+
+// podMemoryByNode returns the sum of memory usage of pods per node, preferring pod-level usage which includes pod overhead.
+func podMemoryByNode(pods map[apitypes.NamespacedName]storage.PodMetricsPoint) map[string]uint64 {
+	usage := make(map[string]uint64)
+	for _, pod := range pods {
+		if pod.MemoryUsage != 0 {
+			usage[pod.Node] += pod.MemoryUsage
+			continue
+		}
+		for _, container := range pod.Containers {
+			usage[pod.Node] += container.MemoryUsage
+		}
+	}
+	return usage
 }
 
 func timeseriesMatchesName(ts, name []byte) bool {
@@ -116,7 +706,14 @@ func timeseriesMatchesName(ts, name []byte) bool {
 
 func parseNodeCpuUsageMetrics(timestamp int64, value float64, node *storage.MetricsPoint) {
 	// unit of node_cpu_usage_seconds_total is second, need to convert 	i = bytes.Index(labels, podNameTag)
-	node.CumulativeCpuUsed = uint64(value * 1e9)
+	node.CumulativeCpuUsed = cpuSecondsToNanoseconds(value)
+	// unit of timestamp is millisecond, need to convert to nanosecond
+	node.Timestamp = time.Unix(0, timestamp*1e6)
+}
+
+func parseNodeCpuGaugeMetrics(timestamp int64, value float64, node *storage.MetricsPoint) {
+	// unit of the gauge is core, need to convert to nano core, keeping nonzero usage nonzero
+	node.CpuUsage = cpuSecondsToNanoseconds(value)
 	// unit of timestamp is millisecond, need to convert to nanosecond
 	node.Timestamp = time.Unix(0, timestamp*1e6)
 }
@@ -127,6 +724,11 @@ func parseNodeMemUsageMetrics(timestamp int64, value float64, node *storage.Metr
 	node.Timestamp = time.Unix(0, timestamp*1e6)
 }
 
+func parseNodeFsUsageMetrics(value float64, node *storage.MetricsPoint) {
+	// filesystem usage is not used for rate calculation, so it doesn't update the timestamp
+	node.FilesystemUsage = uint64(value)
+}
+
 func parseContainerCpuMetrics(namespaceName apitypes.NamespacedName, containerName string, timestamp int64, value float64, pods map[apitypes.NamespacedName]storage.PodMetricsPoint) {
 	if _, findPod := pods[namespaceName]; !findPod {
 		pods[namespaceName] = storage.PodMetricsPoint{Containers: make(map[string]storage.MetricsPoint)}
@@ -136,7 +738,7 @@ func parseContainerCpuMetrics(namespaceName apitypes.NamespacedName, containerNa
 	}
 	// unit of node_cpu_usage_seconds_total is second, need to convert to nanosecond
 	containerMetrics := pods[namespaceName].Containers[containerName]
-	containerMetrics.CumulativeCpuUsed = uint64(value * 1e9)
+	containerMetrics.CumulativeCpuUsed = cpuSecondsToNanoseconds(value)
 	// unit of timestamp is millisecond, need to convert to nanosecond
 	containerMetrics.Timestamp = time.Unix(0, timestamp*1e6)
 	pods[namespaceName].Containers[containerName] = containerMetrics
@@ -164,10 +766,31 @@ func parseContainerStartTimeMetrics(namespaceName apitypes.NamespacedName, conta
 		pods[namespaceName].Containers[containerName] = storage.MetricsPoint{}
 	}
 	containerMetrics := pods[namespaceName].Containers[containerName]
-	containerMetrics.StartTime = time.Unix(0, int64(value*1e9))
+	containerMetrics.StartTime = parseStartTime(value)
 	pods[namespaceName].Containers[containerName] = containerMetrics
 }
 
+// parseStartTime converts start time in seconds since epoch to time, splitting whole seconds from the fraction,
+// as converting to nanoseconds overflows int64 for times after year 2262. Negative, non-finite and
+// out of range values are treated as unknown start time.
+func parseStartTime(value float64) time.Time {
+	if math.IsNaN(value) || value < 0 || value >= math.MaxInt64 {
+		return time.Time{}
+	}
+	seconds, fraction := math.Modf(value)
+	return time.Unix(int64(seconds), int64(math.Round(fraction*1e9)))
+}
+
+// cpuSecondsToNanoseconds converts cumulative CPU usage to nanoseconds rounding to the nearest one.
+// Nonzero usage below a nanosecond is rounded up, so it's not mistaken for a missing metric.
+func cpuSecondsToNanoseconds(value float64) uint64 {
+	ns := math.Round(value * 1e9)
+	if ns == 0 && value > 0 {
+		return 1
+	}
+	return uint64(ns)
+}
+
 var (
 	containerNameTag = []byte(`container="`)
 	podNameTag       = []byte(`pod="`)
@@ -181,24 +804,92 @@ func parseContainerLabels(labels []byte) (namespaceName apitypes.NamespacedName,
 	i = bytes.Index(labels, podNameTag) + len(podNameTag)
 	j = bytes.IndexByte(labels[i:], '"')
 	namespaceName.Name = string(labels[i : i+j])
-	i = bytes.Index(labels, namespaceTag) + len(namespaceTag)
+	i = bytes.Index(labels, namespaceTag)
+	if i < 0 {
+		// Series of node-level containers can lack namespace, leaving it empty.
+		return namespaceName, containerName
+	}
+	i += len(namespaceTag)
 	j = bytes.IndexByte(labels[i:], '"')
 	namespaceName.Namespace = string(labels[i : i+j])
 	return namespaceName, containerName
 }
 
-func checkContainerMetrics(podMetric storage.PodMetricsPoint) map[string]storage.MetricsPoint {
+func parsePodLabels(labels []byte) apitypes.NamespacedName {
+	return apitypes.NamespacedName{
+		Name:      parseLabelValue(labels, "pod"),
+		Namespace: parseLabelValue(labels, "namespace"),
+	}
+}
+
+// parseLabelValue returns value of the label with given name, or empty string if not found.
+func parseLabelValue(labels []byte, name string) string {
+	for _, prefix := range []string{"{", ","} {
+		tag := []byte(prefix + name + `="`)
+		i := bytes.Index(labels, tag)
+		if i < 0 {
+			continue
+		}
+		i += len(tag)
+		j := bytes.IndexByte(labels[i:], '"')
+		if j < 0 {
+			return ""
+		}
+		return string(labels[i : i+j])
+	}
+	return ""
+}
+
+// checkContainerMetrics returns metrics of pod containers, or nil and the reason if any container metric is incomplete.
+// Zero memory usage is treated as incomplete, unless zeroMemoryAllowed returns true for the container.
+func checkContainerMetrics(podMetric storage.PodMetricsPoint, zeroMemoryAllowed func(containerName string) bool) (map[string]storage.MetricsPoint, string) {
 	podMetrics := make(map[string]storage.MetricsPoint)
 	for containerName, containerMetric := range podMetric.Containers {
 		if containerMetric != (storage.MetricsPoint{}) {
 			// drop metrics when CumulativeCpuUsed or MemoryUsage is zero
-			if containerMetric.CumulativeCpuUsed == 0 || containerMetric.MemoryUsage == 0 {
+			if containerMetric.CumulativeCpuUsed == 0 || (containerMetric.MemoryUsage == 0 && !zeroMemoryAllowed(containerName)) {
 				klog.V(1).InfoS("Failed getting complete container metric", "containerName", containerName, "containerMetric", containerMetric)
-				return nil
+				return nil, partialDataReason(containerMetric)
 			} else {
 				podMetrics[containerName] = containerMetric
 			}
 		}
 	}
-	return podMetrics
+	return podMetrics, ""
+}
+
+// partialDataReason returns the reason of dropping a pod due to incomplete container metric.
+func partialDataReason(containerMetric storage.MetricsPoint) string {
+	switch {
+	case containerMetric.CumulativeCpuUsed == 0 && containerMetric.MemoryUsage == 0:
+		return partialDataMissingContainer
+	case containerMetric.CumulativeCpuUsed == 0:
+		return partialDataMissingCpu
+	default:
+		return partialDataMissingMemory
+	}
+}
+
+// droppedContainerReason returns the reason of dropping container of a pod dropped due to incomplete container metric.
+func droppedContainerReason(containerMetric storage.MetricsPoint, zeroMemoryAllowed bool) string {
+	if containerMetric.CumulativeCpuUsed == 0 || (containerMetric.MemoryUsage == 0 && !zeroMemoryAllowed) {
+		return partialDataReason(containerMetric)
+	}
+	return droppedIncompletePod
+}
+
+// dropExcessContainers removes containers above the limit, keeping the first ones ordered by name
+// so that the same containers are kept between scrapes. Returns names of removed containers.
+func dropExcessContainers(podRef apitypes.NamespacedName, containers map[string]storage.MetricsPoint, limit int) []string {
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names[limit:] {
+		delete(containers, name)
+	}
+	droppedContainers.WithLabelValues(droppedContainerLimit).Add(float64(len(names) - limit))
+	klog.V(2).InfoS("Dropping containers exceeding per pod limit", "pod", klog.KRef(podRef.Namespace, podRef.Name), "droppedCount", len(names)-limit)
+	return names[limit:]
 }
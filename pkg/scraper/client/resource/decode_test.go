@@ -16,13 +16,17 @@ package resource
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 
 	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/component-base/metrics/testutil"
 
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 	"sigs.k8s.io/metrics-server/pkg/storage"
 )
 
@@ -31,11 +35,21 @@ func TestDecode(t *testing.T) {
 		Nodes: map[string]storage.MetricsPoint{},
 		Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{},
 	}
+	droppedMetrics := func(reason string) *storage.MetricsBatch {
+		return &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{},
+			Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+			DroppedContainers: map[apitypes.NamespacedName]map[string]string{
+				{Namespace: "kube-system", Name: "coredns-558bd4d5db-4dpjz"}: {"coredns": reason},
+			},
+		}
+	}
 
 	tcs := []struct {
 		name          string
 		input         string
 		defaultTime   time.Time
+		opts          decodeOptions
 		expectMetrics *storage.MetricsBatch
 		wantError     bool
 	}{
@@ -76,6 +90,7 @@ scrape_error 0
 				},
 				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
 					{Name: "coredns-558bd4d5db-4dpjz", Namespace: "kube-system"}: {
+						Node: "node1",
 						Containers: map[string]storage.MetricsPoint{
 							"coredns": {
 								Timestamp:         time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC),
@@ -108,6 +123,7 @@ node_memory_working_set_bytes 1.616273408e+09
 				},
 				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
 					{Name: "coredns-558bd4d5db-4dpjz", Namespace: "kube-system"}: {
+						Node: "node1",
 						Containers: map[string]storage.MetricsPoint{
 							"coredns": {
 								Timestamp:         time.Date(2077, 7, 7, 7, 7, 7, 0, time.UTC),
@@ -131,6 +147,7 @@ container_start_time_seconds{container="coredns",namespace="kube-system",pod="co
 				Nodes: map[string]storage.MetricsPoint{},
 				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
 					{Name: "coredns-558bd4d5db-4dpjz", Namespace: "kube-system"}: {
+						Node: "node1",
 						Containers: map[string]storage.MetricsPoint{
 							"coredns": {
 								Timestamp:         time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC),
@@ -148,7 +165,7 @@ container_start_time_seconds{container="coredns",namespace="kube-system",pod="co
 			input: `
 container_memory_working_set_bytes{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 1.253376e+07 1633253812125
 `,
-			expectMetrics: &emptyMetrics,
+			expectMetrics: droppedMetrics("missing_cpu"),
 		},
 		{
 			name: "Empty container CPU drops container metrics",
@@ -156,14 +173,14 @@ container_memory_working_set_bytes{container="coredns",namespace="kube-system",p
 container_cpu_usage_seconds_total{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 0 1633253812125
 container_memory_working_set_bytes{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 1.253376e+07 1633253812125
 `,
-			expectMetrics: &emptyMetrics,
+			expectMetrics: droppedMetrics("missing_cpu"),
 		},
 		{
 			name: "No container Memory drops container metrics",
 			input: `
 container_cpu_usage_seconds_total{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 4.710169 1633253812125
 `,
-			expectMetrics: &emptyMetrics,
+			expectMetrics: droppedMetrics("missing_memory"),
 		},
 		{
 			name: "Empty container Memory drops container metrics",
@@ -171,7 +188,7 @@ container_cpu_usage_seconds_total{container="coredns",namespace="kube-system",po
 container_cpu_usage_seconds_total{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 4.710169 1633253812125
 container_memory_working_set_bytes{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 0 1633253812125
 `,
-			expectMetrics: &emptyMetrics,
+			expectMetrics: droppedMetrics("missing_memory"),
 		},
 		{
 			name: "Single node",
@@ -190,6 +207,27 @@ node_memory_working_set_bytes 1.616273408e+09 1633253809720
 				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{},
 			},
 		},
+		{
+			name: "Node filesystem usage",
+			input: `
+node_cpu_usage_seconds_total 357.35491 1633253809720
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+# HELP node_filesystem_usage_bytes Current filesystem usage of the node in bytes
+# TYPE node_filesystem_usage_bytes gauge
+node_filesystem_usage_bytes 5.36870912e+09 1633253809720
+`,
+			expectMetrics: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {
+						Timestamp:         time.Date(2021, 10, 3, 9, 36, 49, 720000000, time.UTC),
+						CumulativeCpuUsed: 357354910000,
+						MemoryUsage:       1616273408,
+						FilesystemUsage:   5368709120,
+					},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+			},
+		},
 		{
 			name: "No node CPU drops metric",
 			input: `
@@ -212,6 +250,30 @@ node_cpu_usage_seconds_total 357.35491 1633253809720
 `,
 			expectMetrics: &emptyMetrics,
 		},
+		{
+			name: "No node Memory keeps CPU only metrics if node memory is not required",
+			input: `
+node_cpu_usage_seconds_total 357.35491 1633253809720
+`,
+			opts: decodeOptions{allowMissingNodeMemory: true},
+			expectMetrics: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {
+						Timestamp:         time.Date(2021, 10, 3, 9, 36, 49, 720000000, time.UTC),
+						CumulativeCpuUsed: 357354910000,
+					},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+			},
+		},
+		{
+			name: "No node CPU drops metric even if node memory is not required",
+			input: `
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+`,
+			opts:          decodeOptions{allowMissingNodeMemory: true},
+			expectMetrics: &emptyMetrics,
+		},
 		{
 			name: "Empty node Memory drops metric",
 			input: `
@@ -234,7 +296,7 @@ container_start_time_seconds{container="metrics-server",namespace="kubernetes-da
 	}
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			ms, err := decodeBatch([]byte(tc.input), tc.defaultTime, "node1")
+			ms, err := decodeBatch([]byte(tc.input), "", tc.defaultTime, "node1", tc.opts)
 			if (err != nil) != tc.wantError {
 				t.Fatalf("Unexpected error: %v", err)
 			}
@@ -245,6 +307,1142 @@ container_start_time_seconds{container="metrics-server",namespace="kubernetes-da
 	}
 }
 
+func TestDecode_NodeFilesystemUsageMetric(t *testing.T) {
+	nodeFilesystemUsage.Create(nil)
+	nodeFilesystemUsage.Reset()
+
+	input := `
+node_cpu_usage_seconds_total 357.35491 1633253809720
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+node_filesystem_usage_bytes 5.36870912e+09 1633253809720
+`
+	_, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = testutil.CollectAndCompare(nodeFilesystemUsage, strings.NewReader(`
+	# HELP metrics_server_node_filesystem_usage_bytes [ALPHA] Filesystem usage of the node in bytes, if exposed by Kubelet.
+	# TYPE metrics_server_node_filesystem_usage_bytes gauge
+	metrics_server_node_filesystem_usage_bytes{node="node1"} 5.36870912e+09
+	`), "metrics_server_node_filesystem_usage_bytes")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+}
+
+func TestDecode_MultipleNodes(t *testing.T) {
+	input := `
+node_cpu_usage_seconds_total{node="node1"} 1 1633253812125
+node_memory_working_set_bytes{node="node1"} 1000 1633253812125
+node_cpu_usage_seconds_total{node="node2"} 2 1633253812125
+node_memory_working_set_bytes{node="node2"} 2000 1633253812125
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",node="node1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",node="node1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",node="node2",pod="pod2"} 2 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",node="node2",pod="pod2"} 2000 1633253812125
+`
+	ms, err := decodeBatch([]byte(input), "", time.Time{}, "proxy", decodeOptions{nodeLabel: "node"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	timestamp := time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC)
+	expectMetrics := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{
+			"node1": {Timestamp: timestamp, CumulativeCpuUsed: 1e9, MemoryUsage: 1000},
+			"node2": {Timestamp: timestamp, CumulativeCpuUsed: 2e9, MemoryUsage: 2000},
+		},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			{Name: "pod1", Namespace: "ns1"}: {
+				Node: "node1",
+				Containers: map[string]storage.MetricsPoint{
+					"container1": {Timestamp: timestamp, CumulativeCpuUsed: 1e9, MemoryUsage: 1000},
+				},
+			},
+			{Name: "pod2", Namespace: "ns1"}: {
+				Node: "node2",
+				Containers: map[string]storage.MetricsPoint{
+					"container1": {Timestamp: timestamp, CumulativeCpuUsed: 2e9, MemoryUsage: 2000},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(expectMetrics, ms); diff != "" {
+		t.Errorf("Unexpected diff: %s", diff)
+	}
+}
+
+func TestDecode_SmallContainerCpu(t *testing.T) {
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 3e-10 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container2",namespace="ns1",pod="pod1"} 0.000001234 1633253812125
+container_memory_working_set_bytes{container="container2",namespace="ns1",pod="pod1"} 1000 1633253812125
+`
+	ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	timestamp := time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC)
+	expectMetrics := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			{Name: "pod1", Namespace: "ns1"}: {
+				Node: "node1",
+				Containers: map[string]storage.MetricsPoint{
+					"container1": {Timestamp: timestamp, CumulativeCpuUsed: 1, MemoryUsage: 1000},
+					"container2": {Timestamp: timestamp, CumulativeCpuUsed: 1234, MemoryUsage: 1000},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(expectMetrics, ms); diff != "" {
+		t.Errorf("Unexpected diff: %s", diff)
+	}
+}
+
+func TestDecode_PodLevelCpu(t *testing.T) {
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container2",namespace="ns1",pod="pod1"} 2 1633253812125
+container_memory_working_set_bytes{container="container2",namespace="ns1",pod="pod1"} 1000 1633253812125
+pod_cpu_usage_seconds_total{namespace="ns1",pod="pod1"} 3.5 1633253813125
+`
+	timestamp := time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC)
+	containers := map[string]storage.MetricsPoint{
+		"container1": {Timestamp: timestamp, CumulativeCpuUsed: 1e9, MemoryUsage: 1000},
+		"container2": {Timestamp: timestamp, CumulativeCpuUsed: 2e9, MemoryUsage: 1000},
+	}
+	for _, tc := range []struct {
+		name      string
+		opts      decodeOptions
+		expectPod storage.PodMetricsPoint
+	}{
+		{
+			name:      "Pod-level CPU is ignored by default",
+			expectPod: storage.PodMetricsPoint{Node: "node1", Containers: containers},
+		},
+		{
+			name: "Pod-level CPU includes overhead above containers sum",
+			opts: decodeOptions{podLevelCpu: true},
+			expectPod: storage.PodMetricsPoint{
+				Node:              "node1",
+				Containers:        containers,
+				CumulativeCpuUsed: 3.5e9,
+				Timestamp:         timestamp.Add(time.Second),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expectPod, ms.Pods[apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}]); diff != "" {
+				t.Errorf("Unexpected diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestDecode_PodLevelMemory(t *testing.T) {
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container2",namespace="ns1",pod="pod1"} 2 1633253812125
+container_memory_working_set_bytes{container="container2",namespace="ns1",pod="pod1"} 2000 1633253812125
+pod_memory_working_set_bytes{namespace="ns1",pod="pod1"} 3500 1633253812125
+`
+	for _, tc := range []struct {
+		name         string
+		opts         decodeOptions
+		expectMemory uint64
+	}{
+		{
+			name: "Pod-level memory is ignored by default",
+		},
+		{
+			name:         "Pod-level memory includes overhead above containers sum",
+			opts:         decodeOptions{podLevelMemory: true},
+			expectMemory: 3500,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			pod := ms.Pods[apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}]
+			var containersSum uint64
+			for _, c := range pod.Containers {
+				containersSum += c.MemoryUsage
+			}
+			if containersSum != 3000 {
+				t.Errorf("Unexpected sum of containers memory, want: 3000, got: %d", containersSum)
+			}
+			if pod.MemoryUsage != tc.expectMemory {
+				t.Errorf("Unexpected pod-level memory, want: %d, got: %d", tc.expectMemory, pod.MemoryUsage)
+			}
+		})
+	}
+}
+
+func TestDecode_ApproximateNodeMemory(t *testing.T) {
+	input := `
+node_cpu_usage_seconds_total 357.35491 1633253809720
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container2",namespace="ns1",pod="pod2"} 2 1633253812125
+container_memory_working_set_bytes{container="container2",namespace="ns1",pod="pod2"} 2000 1633253812125
+`
+	for _, tc := range []struct {
+		name       string
+		opts       decodeOptions
+		expectNode map[string]storage.MetricsPoint
+	}{
+		{
+			name:       "Node without memory is dropped by default",
+			opts:       decodeOptions{},
+			expectNode: map[string]storage.MetricsPoint{},
+		},
+		{
+			name: "Node memory is approximated as sum of pods memory",
+			opts: decodeOptions{approximateNodeMemory: true},
+			expectNode: map[string]storage.MetricsPoint{
+				"node1": {
+					Timestamp:         time.Date(2021, 10, 3, 9, 36, 49, 720000000, time.UTC),
+					CumulativeCpuUsed: 357354910000,
+					MemoryUsage:       3000,
+					MemoryApproximate: true,
+				},
+			},
+		},
+		{
+			name: "Node memory approximation includes overhead",
+			opts: decodeOptions{approximateNodeMemory: true, nodeMemoryOverhead: 500},
+			expectNode: map[string]storage.MetricsPoint{
+				"node1": {
+					Timestamp:         time.Date(2021, 10, 3, 9, 36, 49, 720000000, time.UTC),
+					CumulativeCpuUsed: 357354910000,
+					MemoryUsage:       3500,
+					MemoryApproximate: true,
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expectNode, ms.Nodes); diff != "" {
+				t.Errorf("Node metrics diff: %s", diff)
+			}
+			if len(ms.Pods) != 2 {
+				t.Errorf("Expected metrics of 2 pods, got %d", len(ms.Pods))
+			}
+		})
+	}
+}
+
+func TestDecode_TimeSkew(t *testing.T) {
+	input := `
+node_cpu_usage_seconds_total 357.35491 1633253809720
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+`
+	scrapeTime := time.Date(2021, 10, 3, 9, 36, 52, 220000000, time.UTC)
+	for _, tc := range []struct {
+		name   string
+		opts   decodeOptions
+		expect string
+	}{
+		{
+			name: "Time skew is not observed by default",
+		},
+		{
+			name: "Time skew of node point is observed",
+			opts: decodeOptions{observeTimeSkew: true},
+			expect: `
+			# HELP metrics_server_scrape_time_skew_seconds [ALPHA] Difference between the time of scraping the node and timestamp of its metrics point in seconds. Negative or large values indicate clock skew of the node.
+			# TYPE metrics_server_scrape_time_skew_seconds histogram
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="-60"} 0
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="-10"} 0
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="-1"} 0
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="0"} 0
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="1"} 0
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="5"} 1
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="10"} 1
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="15"} 1
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="30"} 1
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="60"} 1
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="120"} 1
+			metrics_server_scrape_time_skew_seconds_bucket{node="node1",le="+Inf"} 1
+			metrics_server_scrape_time_skew_seconds_sum{node="node1"} 2.5
+			metrics_server_scrape_time_skew_seconds_count{node="node1"} 1
+			`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			scrapeTimeSkew.Create(nil)
+			scrapeTimeSkew.Reset()
+			_, err := decodeBatch([]byte(input), "", scrapeTime, "node1", tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.expect == "" {
+				count, err := testutil.GetHistogramMetricCount(scrapeTimeSkew.WithLabelValues("node1"))
+				if err != nil || count != 0 {
+					t.Errorf("Expected no observations, got %d, err: %v", count, err)
+				}
+				return
+			}
+			err = testutil.CollectAndCompare(scrapeTimeSkew, strings.NewReader(tc.expect), "metrics_server_scrape_time_skew_seconds")
+			if err != nil {
+				t.Errorf("Unexpected metrics: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecode_MetricNames(t *testing.T) {
+	input := `
+node_cpu_usage_seconds_total 357.35491 1633253809720
+node_memory_working_set 1.616273408e+09 1633253809720
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_start_time_seconds{container="container1",namespace="ns1",pod="pod1"} 1633253800 1633253812125
+`
+	names, err := metricNameMapping(map[string]string{
+		"node_memory_working_set_bytes":      "node_memory_working_set",
+		"container_memory_working_set_bytes": "container_memory_working_set",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{metricNames: names})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := ms.Nodes["node1"].MemoryUsage; got != 1616273408 {
+		t.Errorf("Unexpected node memory usage, got %d, want %d", got, 1616273408)
+	}
+	container := ms.Pods[apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}].Containers["container1"]
+	if container.MemoryUsage != 1000 {
+		t.Errorf("Unexpected container memory usage, got %d, want %d", container.MemoryUsage, 1000)
+	}
+	if container.CumulativeCpuUsed != 1e9 {
+		t.Errorf("Unexpected container CPU usage, got %d, want %d", container.CumulativeCpuUsed, uint64(1e9))
+	}
+}
+
+func TestDecode_TimestampUnitSeconds(t *testing.T) {
+	input := `
+node_cpu_usage_seconds_total 357.35491 1633253809
+node_memory_working_set_bytes 1.616273408e+09 1633253809
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812
+`
+	ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{timestampScale: 1000})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectMetrics := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{
+			"node1": {Timestamp: time.Unix(1633253809, 0), CumulativeCpuUsed: 357354910000, MemoryUsage: 1616273408},
+		},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			{Name: "pod1", Namespace: "ns1"}: {
+				Node: "node1",
+				Containers: map[string]storage.MetricsPoint{
+					"container1": {Timestamp: time.Unix(1633253812, 0), CumulativeCpuUsed: 1e9, MemoryUsage: 1000},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(expectMetrics, ms); diff != "" {
+		t.Errorf(`Metrics diff: %s`, diff)
+	}
+}
+
+func TestMetricNameMapping_UnknownName(t *testing.T) {
+	if _, err := metricNameMapping(map[string]string{"container_memory_rss": "container_rss"}); err == nil {
+		t.Error("Expected error for unknown metric name")
+	}
+}
+
+func TestDecode_IncludedNamespaces(t *testing.T) {
+	input := `
+node_cpu_usage_seconds_total 357.35491 1633253809720
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container1",namespace="ns2",pod="pod2"} 2 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns2",pod="pod2"} 2000 1633253812125
+container_cpu_usage_seconds_total{container="container1",namespace="ns3",pod="pod3"} 3 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns3",pod="pod3"} 3000 1633253812125
+`
+	for _, tc := range []struct {
+		name       string
+		opts       decodeOptions
+		expectPods map[apitypes.NamespacedName]bool
+	}{
+		{
+			name: "All namespaces are included by default",
+			expectPods: map[apitypes.NamespacedName]bool{
+				{Name: "pod1", Namespace: "ns1"}: true,
+				{Name: "pod2", Namespace: "ns2"}: true,
+				{Name: "pod3", Namespace: "ns3"}: true,
+			},
+		},
+		{
+			name: "Pods of other namespaces are dropped",
+			opts: decodeOptions{includedNamespaces: map[string]struct{}{"ns1": {}, "ns3": {}}},
+			expectPods: map[apitypes.NamespacedName]bool{
+				{Name: "pod1", Namespace: "ns1"}: true,
+				{Name: "pod3", Namespace: "ns3"}: true,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			pods := map[apitypes.NamespacedName]bool{}
+			for podRef := range ms.Pods {
+				pods[podRef] = true
+			}
+			if diff := cmp.Diff(tc.expectPods, pods); diff != "" {
+				t.Errorf("Pods diff: %s", diff)
+			}
+			if len(ms.Nodes) != 1 {
+				t.Errorf("Expected node metrics to be kept, got %d nodes", len(ms.Nodes))
+			}
+		})
+	}
+}
+
+func TestDecode_NodeCpuGauge(t *testing.T) {
+	input := `
+node_cpu_usage_cores 1.5 1633253809720
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+`
+	for _, tc := range []struct {
+		name         string
+		opts         decodeOptions
+		expectMetric *storage.MetricsBatch
+	}{
+		{
+			name: "Node with gauge CPU is dropped by default",
+			expectMetric: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{},
+				Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+			},
+		},
+		{
+			name: "Node CPU gauge is stored as usage",
+			opts: decodeOptions{nodeCpuGauge: "node_cpu_usage_cores"},
+			expectMetric: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {
+						Timestamp:   time.Date(2021, 10, 3, 9, 36, 49, 720000000, time.UTC),
+						CpuUsage:    1500000000,
+						MemoryUsage: 1616273408,
+					},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expectMetric, ms); diff != "" {
+				t.Errorf("Metrics diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestDecode_ContainerStartTime(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		startTime   string
+		expectStart time.Time
+	}{
+		{
+			name:        "Scientific notation",
+			startTime:   "1.6509742025e+09",
+			expectStart: time.Unix(1650974202, 500000000),
+		},
+		{
+			name:        "Very large valid epoch beyond nanoseconds range",
+			startTime:   "1.0e+10",
+			expectStart: time.Unix(10000000000, 0),
+		},
+		{
+			name:        "Zero",
+			startTime:   "0",
+			expectStart: time.Unix(0, 0),
+		},
+		{
+			name:      "Negative is unknown",
+			startTime: "-6.7953645788713455e+09",
+		},
+		{
+			name:      "Out of range is unknown",
+			startTime: "1e+300",
+		},
+		{
+			name:      "Infinity is unknown",
+			startTime: "+Inf",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			input := fmt.Sprintf(`
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_start_time_seconds{container="container1",namespace="ns1",pod="pod1"} %s 1633253812125
+`, tc.startTime)
+			ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			container, found := ms.Pods[apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}].Containers["container1"]
+			if !found {
+				t.Fatalf("Expected metrics of container1")
+			}
+			if !container.StartTime.Equal(tc.expectStart) {
+				t.Errorf("Unexpected start time, want: %v, got: %v", tc.expectStart, container.StartTime)
+			}
+		})
+	}
+}
+
+func TestDecode_OpenMetricsExemplars(t *testing.T) {
+	input := `# TYPE container_cpu_usage_seconds_total counter
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812.125 # {trace_id="4bf92f3577b34da6"} 0.5 1633253812.000
+# TYPE container_memory_working_set_bytes gauge
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812.125
+# TYPE node_cpu_usage_seconds_total counter
+node_cpu_usage_seconds_total 357.35491 1633253809.720 # {trace_id="0af7651916cd43dd"} 1 1633253809.000
+# TYPE node_memory_working_set_bytes gauge
+node_memory_working_set_bytes 1.616273408e+09 1633253809.720
+# EOF
+`
+	ms, err := decodeBatch([]byte(input), "application/openmetrics-text; version=1.0.0; charset=utf-8", time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectMetrics := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{
+			"node1": {
+				Timestamp:         time.Date(2021, 10, 3, 9, 36, 49, 720000000, time.UTC),
+				CumulativeCpuUsed: 357354910000,
+				MemoryUsage:       1616273408,
+			},
+		},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			{Name: "pod1", Namespace: "ns1"}: {
+				Node: "node1",
+				Containers: map[string]storage.MetricsPoint{
+					"container1": {Timestamp: time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC), CumulativeCpuUsed: 1e9, MemoryUsage: 1000},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(expectMetrics, ms); diff != "" {
+		t.Errorf("Unexpected diff: %s", diff)
+	}
+}
+
+func TestDecode_ContainerOOMEvents(t *testing.T) {
+	nodeContainerOOMKills.Create(nil)
+	nodeContainerOOMKills.Reset()
+
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_oom_events_total{container="container1",namespace="ns1",pod="pod1"} 2 1633253812125
+container_oom_events_total{container="container2",namespace="ns1",pod="pod1"} 1 1633253812125
+`
+	ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ms.Pods) != 1 {
+		t.Errorf("Unexpected number of pods, want: %d, got %d", 1, len(ms.Pods))
+	}
+	err = testutil.CollectAndCompare(nodeContainerOOMKills, strings.NewReader(`
+	# HELP metrics_server_node_container_oom_kills [ALPHA] Number of OOM kills of containers running on the node, if exposed by Kubelet.
+	# TYPE metrics_server_node_container_oom_kills gauge
+	metrics_server_node_container_oom_kills{node="node1"} 3
+	`), "metrics_server_node_container_oom_kills")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+}
+
+func TestDecode_DroppedContainers(t *testing.T) {
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container2",namespace="ns1",pod="pod1"} 2 1633253812125
+`
+	ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectDropped := map[apitypes.NamespacedName]map[string]string{
+		{Name: "pod1", Namespace: "ns1"}: {"container1": "incomplete_pod", "container2": "missing_memory"},
+	}
+	if diff := cmp.Diff(expectDropped, ms.DroppedContainers); diff != "" {
+		t.Errorf(`Dropped containers diff: %s`, diff)
+	}
+}
+
+func TestDecode_NodeContainerDropRatio(t *testing.T) {
+	nodeContainerDropRatio.Create(nil)
+	nodeContainerDropRatio.Reset()
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod2"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod2"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container2",namespace="ns1",pod="pod2"} 2 1633253812125
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod3"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod3"} 1000 1633253812125
+`
+	_, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = testutil.CollectAndCompare(nodeContainerDropRatio, strings.NewReader(`
+	# HELP metrics_server_node_container_drop_ratio [ALPHA] Fraction of containers running on the node dropped while decoding the last Kubelet response.
+	# TYPE metrics_server_node_container_drop_ratio gauge
+	metrics_server_node_container_drop_ratio{node="node1"} 0.5
+	`), "metrics_server_node_container_drop_ratio")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+}
+
+func TestDecode_MaxContainersPerPod(t *testing.T) {
+	droppedContainers.Create(nil)
+	droppedContainers.Reset()
+
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container2",namespace="ns1",pod="pod1"} 2 1633253812125
+container_memory_working_set_bytes{container="container2",namespace="ns1",pod="pod1"} 2000 1633253812125
+container_cpu_usage_seconds_total{container="container3",namespace="ns1",pod="pod1"} 3 1633253812125
+container_memory_working_set_bytes{container="container3",namespace="ns1",pod="pod1"} 3000 1633253812125
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod2"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod2"} 1000 1633253812125
+`
+	ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{maxContainersPerPod: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	timestamp := time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC)
+	expectMetrics := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			{Name: "pod1", Namespace: "ns1"}: {
+				Node: "node1",
+				Containers: map[string]storage.MetricsPoint{
+					"container1": {Timestamp: timestamp, CumulativeCpuUsed: 1e9, MemoryUsage: 1000},
+					"container2": {Timestamp: timestamp, CumulativeCpuUsed: 2e9, MemoryUsage: 2000},
+				},
+			},
+			{Name: "pod2", Namespace: "ns1"}: {
+				Node: "node1",
+				Containers: map[string]storage.MetricsPoint{
+					"container1": {Timestamp: timestamp, CumulativeCpuUsed: 1e9, MemoryUsage: 1000},
+				},
+			},
+		},
+		DroppedContainers: map[apitypes.NamespacedName]map[string]string{
+			{Name: "pod1", Namespace: "ns1"}: {"container3": "container_limit"},
+		},
+	}
+	if diff := cmp.Diff(expectMetrics, ms); diff != "" {
+		t.Errorf(`Metrics diff: %s`, diff)
+	}
+	err = testutil.CollectAndCompare(droppedContainers, strings.NewReader(`
+	# HELP metrics_server_kubelet_dropped_containers_total [ALPHA] Number of container metrics dropped while decoding Kubelet responses
+	# TYPE metrics_server_kubelet_dropped_containers_total counter
+	metrics_server_kubelet_dropped_containers_total{reason="container_limit"} 1
+	`), "metrics_server_kubelet_dropped_containers_total")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+}
+
+func TestDecode_BatchResourceTypes(t *testing.T) {
+	batchResourceTypes.Create(nil)
+	batchResourceTypes.Reset()
+
+	input := `
+node_cpu_usage_seconds_total 357.35491 1633253809720
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+node_swap_usage_bytes 0 1633253809720
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_swap_usage_bytes{container="container1",namespace="ns1",pod="pod1"} 100 1633253812125
+container_cpu_usage_seconds_total{container="container2",namespace="ns1",pod="pod1"} 2 1633253812125
+container_memory_working_set_bytes{container="container2",namespace="ns1",pod="pod1"} 2000 1633253812125
+`
+	if _, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	otherInput := `
+node_cpu_usage_seconds_total 357.35491 1633253809720
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+`
+	if _, err := decodeBatch([]byte(otherInput), "", time.Time{}, "node2", decodeOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err := testutil.CollectAndCompare(batchResourceTypes, strings.NewReader(`
+	# HELP metrics_server_batch_resource_types [ALPHA] Number of node and container metrics points carrying each resource type in the last decoded response of the node's Kubelet: cpu, memory, filesystem or swap.
+	# TYPE metrics_server_batch_resource_types gauge
+	metrics_server_batch_resource_types{node="node1",type="cpu"} 3
+	metrics_server_batch_resource_types{node="node1",type="filesystem"} 0
+	metrics_server_batch_resource_types{node="node1",type="memory"} 3
+	metrics_server_batch_resource_types{node="node1",type="swap"} 2
+	metrics_server_batch_resource_types{node="node2",type="cpu"} 1
+	metrics_server_batch_resource_types{node="node2",type="filesystem"} 0
+	metrics_server_batch_resource_types{node="node2",type="memory"} 1
+	metrics_server_batch_resource_types{node="node2",type="swap"} 0
+	`), "metrics_server_batch_resource_types")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+
+	deleteNodeMetrics("node2")
+	err = testutil.CollectAndCompare(batchResourceTypes, strings.NewReader(`
+	# HELP metrics_server_batch_resource_types [ALPHA] Number of node and container metrics points carrying each resource type in the last decoded response of the node's Kubelet: cpu, memory, filesystem or swap.
+	# TYPE metrics_server_batch_resource_types gauge
+	metrics_server_batch_resource_types{node="node1",type="cpu"} 3
+	metrics_server_batch_resource_types{node="node1",type="filesystem"} 0
+	metrics_server_batch_resource_types{node="node1",type="memory"} 3
+	metrics_server_batch_resource_types{node="node1",type="swap"} 2
+	`), "metrics_server_batch_resource_types")
+	if err != nil {
+		t.Errorf("Unexpected metrics after deleting node: %v", err)
+	}
+}
+
+func TestDecode_EmptyNamespace(t *testing.T) {
+	droppedContainers.Create(nil)
+	droppedContainers.Reset()
+
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="kubelet",namespace="",pod=""} 2 1633253812125
+container_memory_working_set_bytes{container="kubelet",namespace="",pod=""} 2000 1633253812125
+container_start_time_seconds{container="kubelet",namespace="",pod=""} 1633253800 1633253812125
+container_cpu_usage_seconds_total{container="runtime",pod=""} 3 1633253812125
+container_memory_working_set_bytes{container="runtime",pod=""} 3000 1633253812125
+`
+	ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	timestamp := time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC)
+	expectMetrics := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			{Name: "pod1", Namespace: "ns1"}: {
+				Node: "node1",
+				Containers: map[string]storage.MetricsPoint{
+					"container1": {Timestamp: timestamp, CumulativeCpuUsed: 1e9, MemoryUsage: 1000},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(expectMetrics, ms); diff != "" {
+		t.Errorf(`Metrics diff: %s`, diff)
+	}
+	err = testutil.CollectAndCompare(droppedContainers, strings.NewReader(`
+	# HELP metrics_server_kubelet_dropped_containers_total [ALPHA] Number of container metrics dropped while decoding Kubelet responses
+	# TYPE metrics_server_kubelet_dropped_containers_total counter
+	metrics_server_kubelet_dropped_containers_total{reason="empty_namespace"} 2
+	`), "metrics_server_kubelet_dropped_containers_total")
+	if err != nil {
+		t.Errorf("Unexpected metrics: %v", err)
+	}
+}
+
+func TestDecode_EmptyNamespacePodLevel(t *testing.T) {
+	input := `
+pod_cpu_usage_seconds_total{namespace="ns1",pod="pod1"} 1 1633253812125
+pod_memory_working_set_bytes{namespace="ns1",pod="pod1"} 1000 1633253812125
+pod_cpu_usage_seconds_total{namespace="",pod="system"} 2 1633253812125
+pod_memory_working_set_bytes{namespace="",pod="system"} 2000 1633253812125
+`
+	opts := decodeOptions{podLevelCpu: true, podLevelMemory: true}
+	s := newDecodeState("node1", opts)
+	if err := s.parse([]byte(input), "", time.Time{}, "node1", opts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pod := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+	if _, found := s.podCpu[pod]; !found || len(s.podCpu) != 1 {
+		t.Errorf("Expected pod-level cpu of pod %s only, got %v", pod, s.podCpu)
+	}
+	if _, found := s.podMem[pod]; !found || len(s.podMem) != 1 {
+		t.Errorf("Expected pod-level memory of pod %s only, got %v", pod, s.podMem)
+	}
+}
+
+func TestDecode_AllowZeroMemory(t *testing.T) {
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 0 1633253812125
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod2"} 1 1633253812125
+`
+	timestamp := time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC)
+	for _, tc := range []struct {
+		name       string
+		opts       decodeOptions
+		expectPods map[apitypes.NamespacedName]storage.PodMetricsPoint
+	}{
+		{
+			name:       "Containers with zero memory are dropped by default",
+			expectPods: map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+		},
+		{
+			name: "Containers with zero memory are kept if allowed, but not containers missing memory",
+			opts: decodeOptions{allowZeroMemory: true},
+			expectPods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				{Name: "pod1", Namespace: "ns1"}: {
+					Node:       "node1",
+					Containers: map[string]storage.MetricsPoint{"container1": {Timestamp: timestamp, CumulativeCpuUsed: 1e9}},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expectPods, ms.Pods); diff != "" {
+				t.Errorf("Unexpected diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestDecode_PodsDroppedPartial(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		input         string
+		expectMetrics string
+	}{
+		{
+			name: "Pod with container missing memory is dropped",
+			input: `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container2",namespace="ns1",pod="pod1"} 2 1633253812125
+`,
+			expectMetrics: `metrics_server_pods_dropped_partial_total{reason="missing_memory"} 1`,
+		},
+		{
+			name: "Pod with container missing usage is dropped",
+			input: `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_start_time_seconds{container="container2",namespace="ns1",pod="pod1"} 1633252812.125 1633253812125
+`,
+			expectMetrics: `metrics_server_pods_dropped_partial_total{reason="missing_container"} 1`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			podsDroppedPartial.Create(nil)
+			podsDroppedPartial.Reset()
+
+			ms, err := decodeBatch([]byte(tc.input), "", time.Time{}, "node1", decodeOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(ms.Pods) != 0 {
+				t.Errorf("Expected pod to be dropped, got %v", ms.Pods)
+			}
+			err = testutil.CollectAndCompare(podsDroppedPartial, strings.NewReader(`
+	# HELP metrics_server_pods_dropped_partial_total [ALPHA] Number of pods dropped while decoding Kubelet responses due to incomplete container metrics by reason: missing_cpu, missing_memory or missing_container.
+	# TYPE metrics_server_pods_dropped_partial_total counter
+	`+tc.expectMetrics+"\n"), "metrics_server_pods_dropped_partial_total")
+			if err != nil {
+				t.Errorf("Unexpected metrics: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecode_HealthSeries(t *testing.T) {
+	input := `
+kubelet_healthy %d
+node_cpu_usage_seconds_total 357.35491 1633253809720
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+`
+	for _, tc := range []struct {
+		name          string
+		healthy       int
+		opts          decodeOptions
+		expectSkipped bool
+	}{
+		{
+			name: "Health series is ignored by default",
+			opts: decodeOptions{},
+		},
+		{
+			name:    "Healthy Kubelet response is decoded",
+			healthy: 1,
+			opts:    decodeOptions{healthSeries: "kubelet_healthy"},
+		},
+		{
+			name:          "Unhealthy Kubelet response is skipped",
+			opts:          decodeOptions{healthSeries: "kubelet_healthy"},
+			expectSkipped: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			unhealthyBatches.Create(nil)
+			unhealthyBatches.Reset()
+
+			ms, err := decodeBatch([]byte(fmt.Sprintf(input, tc.healthy)), "", time.Time{}, "node1", tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if skipped := len(ms.Nodes) == 0 && len(ms.Pods) == 0; skipped != tc.expectSkipped {
+				t.Errorf("Expected skipped %v, got %+v", tc.expectSkipped, ms)
+			}
+			var expectMetrics string
+			var metricNames []string
+			if tc.expectSkipped {
+				metricNames = []string{"metrics_server_kubelet_unhealthy_responses_total"}
+				expectMetrics = `
+	# HELP metrics_server_kubelet_unhealthy_responses_total [ALPHA] Number of Kubelet responses skipped as their health series indicated Kubelet is unhealthy.
+	# TYPE metrics_server_kubelet_unhealthy_responses_total counter
+	metrics_server_kubelet_unhealthy_responses_total{node="node1"} 1
+	`
+			}
+			err = testutil.CollectAndCompare(unhealthyBatches, strings.NewReader(expectMetrics), metricNames...)
+			if err != nil {
+				t.Errorf("Unexpected metrics: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecode_DuplicateSeries(t *testing.T) {
+	input := `
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125
+container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 2 1633253812125
+`
+	timestamp := time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC)
+	for _, tc := range []struct {
+		name              string
+		onDuplicateSeries string
+		expectPods        map[apitypes.NamespacedName]storage.PodMetricsPoint
+		expectErr         bool
+	}{
+		{
+			name:              "Last value is kept by default",
+			onDuplicateSeries: "",
+			expectPods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				{Name: "pod1", Namespace: "ns1"}: {
+					Node:       "node1",
+					Containers: map[string]storage.MetricsPoint{"container1": {Timestamp: timestamp, CumulativeCpuUsed: 2e9, MemoryUsage: 1000}},
+				},
+			},
+		},
+		{
+			name:              "Last value is kept",
+			onDuplicateSeries: client.DuplicateSeriesLast,
+			expectPods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				{Name: "pod1", Namespace: "ns1"}: {
+					Node:       "node1",
+					Containers: map[string]storage.MetricsPoint{"container1": {Timestamp: timestamp, CumulativeCpuUsed: 2e9, MemoryUsage: 1000}},
+				},
+			},
+		},
+		{
+			name:              "Values are summed",
+			onDuplicateSeries: client.DuplicateSeriesSum,
+			expectPods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				{Name: "pod1", Namespace: "ns1"}: {
+					Node:       "node1",
+					Containers: map[string]storage.MetricsPoint{"container1": {Timestamp: timestamp, CumulativeCpuUsed: 3e9, MemoryUsage: 1000}},
+				},
+			},
+		},
+		{
+			name:              "Decoding fails",
+			onDuplicateSeries: client.DuplicateSeriesError,
+			expectErr:         true,
+		},
+	} {
+		// Decoding in parallel splits repeated series into different parts of the response.
+		for _, parallelism := range []int{1, 3} {
+			t.Run(fmt.Sprintf("%s with parallelism %d", tc.name, parallelism), func(t *testing.T) {
+				defer func(minBytes int) { parallelDecodeMinBytes = minBytes }(parallelDecodeMinBytes)
+				parallelDecodeMinBytes = 0
+				duplicateSeries.Create(nil)
+				duplicateSeries.Reset()
+
+				ms, err := decodeBatch([]byte(input), "", time.Time{}, "node1", decodeOptions{onDuplicateSeries: tc.onDuplicateSeries, parallelism: parallelism})
+				if (err != nil) != tc.expectErr {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if !tc.expectErr {
+					if diff := cmp.Diff(tc.expectPods, ms.Pods); diff != "" {
+						t.Errorf("Unexpected diff: %s", diff)
+					}
+				}
+				err = testutil.CollectAndCompare(duplicateSeries, strings.NewReader(`
+	# HELP metrics_server_kubelet_duplicate_series_total [ALPHA] Number of container series repeated within a single Kubelet response by metric name
+	# TYPE metrics_server_kubelet_duplicate_series_total counter
+	metrics_server_kubelet_duplicate_series_total{metric="container_cpu_usage_seconds_total"} 1
+	`), "metrics_server_kubelet_duplicate_series_total")
+				if err != nil {
+					t.Errorf("Unexpected metrics: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestDecode_Parallel(t *testing.T) {
+	input := largeResponse(2000)
+	if len(input) < parallelDecodeMinBytes {
+		t.Fatalf("Response of %d bytes is too small to be decoded in parallel", len(input))
+	}
+	serial, err := decodeBatch(input, "", time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(serial.Nodes) != 1 || len(serial.Pods) != 2000 {
+		t.Fatalf("Unexpected serial result with %d nodes and %d pods", len(serial.Nodes), len(serial.Pods))
+	}
+	for _, parallelism := range []int{2, 3, 8, 100} {
+		t.Run(fmt.Sprintf("parallelism %d", parallelism), func(t *testing.T) {
+			parts := splitFamilies(input, parallelism)
+			if len(parts) < 2 {
+				t.Errorf("Expected response to be split, got %d parts", len(parts))
+			}
+			ms, err := decodeBatch(input, "", time.Time{}, "node1", decodeOptions{parallelism: parallelism})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(serial, ms); diff != "" {
+				t.Errorf("Parallel result differs from serial: %s", diff)
+			}
+		})
+	}
+}
+
+func TestSplitFamilies(t *testing.T) {
+	input := `
+# HELP a_total A
+# TYPE a_total counter
+a_total{x="1"} 1
+a_total{x="2"} 2
+# HELP b_total B
+b_total 3
+c_total 4
+`
+	for _, tc := range []struct {
+		name   string
+		n      int
+		expect []string
+	}{
+		{
+			name:   "Single part",
+			n:      1,
+			expect: []string{input},
+		},
+		{
+			name: "Split between families including comments",
+			n:    2,
+			expect: []string{
+				"\n# HELP a_total A\n# TYPE a_total counter\na_total{x=\"1\"} 1\na_total{x=\"2\"} 2\n",
+				"# HELP b_total B\nb_total 3\nc_total 4\n",
+			},
+		},
+		{
+			name: "No more parts than families",
+			n:    10,
+			expect: []string{
+				"\n# HELP a_total A\n# TYPE a_total counter\na_total{x=\"1\"} 1\na_total{x=\"2\"} 2\n",
+				"# HELP b_total B\nb_total 3\n",
+				"c_total 4\n",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var parts []string
+			for _, part := range splitFamilies([]byte(input), tc.n) {
+				parts = append(parts, string(part))
+			}
+			if diff := cmp.Diff(tc.expect, parts); diff != "" {
+				t.Errorf("Parts diff: %s", diff)
+			}
+		})
+	}
+}
+
+func BenchmarkDecode_Parallel(b *testing.B) {
+	input := largeResponse(2000)
+	for _, parallelism := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("parallelism %d", parallelism), func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				if _, err := decodeBatch(input, "", time.Time{}, "node1", decodeOptions{parallelism: parallelism}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// largeResponse returns a Kubelet resource metrics response of a node running the given number of pods.
+func largeResponse(pods int) []byte {
+	var sb strings.Builder
+	families := []struct {
+		name  string
+		value string
+	}{
+		{name: "container_cpu_usage_seconds_total", value: "4.710169"},
+		{name: "container_memory_working_set_bytes", value: "1.253376e+06"},
+		{name: "container_start_time_seconds", value: "1.6332538006e+09"},
+	}
+	sb.WriteString("# HELP node_cpu_usage_seconds_total [ALPHA] Cumulative cpu time consumed by the node in core-seconds\n")
+	sb.WriteString("# TYPE node_cpu_usage_seconds_total counter\n")
+	sb.WriteString("node_cpu_usage_seconds_total 357.35491 1633253809720\n")
+	sb.WriteString("# HELP node_memory_working_set_bytes [ALPHA] Current working set of the node in bytes\n")
+	sb.WriteString("# TYPE node_memory_working_set_bytes gauge\n")
+	sb.WriteString("node_memory_working_set_bytes 1.616273408e+09 1633253809720\n")
+	for _, family := range families {
+		fmt.Fprintf(&sb, "# HELP %s [ALPHA] Synthetic series\n# TYPE %s gauge\n", family.name, family.name)
+		for i := 0; i < pods; i++ {
+			for _, container := range []string{"app", "sidecar"} {
+				fmt.Fprintf(&sb, "%s{container=%q,namespace=\"default\",pod=\"pod-%d\"} %s 1633253809720\n", family.name, container, i, family.value)
+			}
+		}
+	}
+	return []byte(sb.String())
+}
+
 func Fuzz_decodeBatchPrometheusFormat(f *testing.F) {
 	testSeedsFloat64 := []float64{0, -10000, 10000, 0.5, -0.000000001, 1e100, -1e100}
 	testSeedsInt64 := []int64{0, -10000, 10000, 5, -1, -0}
@@ -268,7 +1466,7 @@ container_memory_working_set_bytes{container="coredns",namespace="kube-system",p
 # TYPE container_start_time_seconds gauge
 container_start_time_seconds{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} %E %d`,
 			cpuValue, timeStamp, memValue, timeStamp, startTimeValue, timeStamp)
-		_, err := decodeBatch([]byte(input), defaultTime, "node1")
+		_, err := decodeBatch([]byte(input), "", defaultTime, "node1", decodeOptions{})
 		if err != nil && timeStamp >= 0 {
 			t.Errorf("Unexpect error: %v\nmetrics: %s\n", err, input)
 		}
@@ -285,10 +1483,60 @@ func Fuzz_decodeBatchRandom(f *testing.F) {
 	}
 	testFunc := func(t *testing.T, defaultTimeValue int64, randomInput string, nodeName string) {
 		defaultTime := time.Unix(0, defaultTimeValue)
-		_, err := decodeBatch([]byte(randomInput), defaultTime, nodeName)
+		_, err := decodeBatch([]byte(randomInput), "", defaultTime, nodeName, decodeOptions{})
 		if err != nil && randomInput == "" {
 			t.Errorf("Unexpect error: %v\nmetrics: %s\n", err, randomInput)
 		}
 	}
 	f.Fuzz(testFunc)
 }
+
+func TestDecodeStream(t *testing.T) {
+	defer func(size int) { streamDecodeMinBuffer = size }(streamDecodeMinBuffer)
+	streamDecodeMinBuffer = 256
+
+	expectMetrics, err := decodeBatch([]byte(resourceResponse), "", time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Reader returning response in parts not aligned to lines
+	r := iotest.HalfReader(strings.NewReader(resourceResponse))
+	ms, size, buf, err := decodeStream(r, nil, time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if size != len(resourceResponse) {
+		t.Errorf("Unexpected size, want: %d, got: %d", len(resourceResponse), size)
+	}
+	if cap(buf) >= len(resourceResponse) {
+		t.Errorf("Response was fully buffered, buffer size: %d, response size: %d", cap(buf), len(resourceResponse))
+	}
+	if diff := cmp.Diff(expectMetrics, ms); diff != "" {
+		t.Errorf(`Metrics diff: %s`, diff)
+	}
+}
+
+func TestDecodeStream_LongLine(t *testing.T) {
+	defer func(size int) { streamDecodeMinBuffer = size }(streamDecodeMinBuffer)
+	streamDecodeMinBuffer = 16
+
+	input := `container_cpu_usage_seconds_total{container="container1",namespace="ns1",pod="pod1"} 1 1633253812125
+container_memory_working_set_bytes{container="container1",namespace="ns1",pod="pod1"} 1000 1633253812125`
+	ms, _, buf, err := decodeStream(strings.NewReader(input), nil, time.Time{}, "node1", decodeOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cap(buf) <= streamDecodeMinBuffer {
+		t.Errorf("Expected buffer to grow to fit the line, got size: %d", cap(buf))
+	}
+	timestamp := time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC)
+	expectPod := storage.PodMetricsPoint{
+		Node: "node1",
+		Containers: map[string]storage.MetricsPoint{
+			"container1": {Timestamp: timestamp, CumulativeCpuUsed: 1e9, MemoryUsage: 1000},
+		},
+	}
+	if diff := cmp.Diff(expectPod, ms.Pods[apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}]); diff != "" {
+		t.Errorf(`Pod diff: %s`, diff)
+	}
+}
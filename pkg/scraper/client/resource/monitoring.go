@@ -0,0 +1,215 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"k8s.io/component-base/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+var (
+	// definedPrefix is the prefix metrics were last defined with.
+	definedPrefix          utils.MetricsPrefix
+	nodeFilesystemUsage    *metrics.GaugeVec
+	droppedContainers      *metrics.CounterVec
+	nodeContainerOOMKills  *metrics.GaugeVec
+	duplicateSeries        *metrics.CounterVec
+	podsDroppedPartial     *metrics.CounterVec
+	nodeContainerDropRatio *metrics.GaugeVec
+	unhealthyBatches       *metrics.CounterVec
+	nodeAddressUnresolved  *metrics.CounterVec
+	scrapeErrors           *metrics.CounterVec
+	scrapeTimeSkew         *metrics.HistogramVec
+	batchResourceTypes     *metrics.GaugeVec
+)
+
+func init() {
+	defineMetrics(utils.MetricsPrefix{})
+}
+
+// defineMetrics defines metrics of the package with names prefixed with prefix.
+func defineMetrics(prefix utils.MetricsPrefix) {
+	definedPrefix = prefix
+	nodeFilesystemUsage = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("node"),
+			Name:      "filesystem_usage_bytes",
+			Help:      "Filesystem usage of the node in bytes, if exposed by Kubelet.",
+		},
+		[]string{"node"},
+	)
+	droppedContainers = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("kubelet"),
+			Name:      "dropped_containers_total",
+			Help:      "Number of container metrics dropped while decoding Kubelet responses",
+		},
+		[]string{"reason"},
+	)
+	nodeContainerOOMKills = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("node"),
+			Name:      "container_oom_kills",
+			Help:      "Number of OOM kills of containers running on the node, if exposed by Kubelet.",
+		},
+		[]string{"node"},
+	)
+	duplicateSeries = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("kubelet"),
+			Name:      "duplicate_series_total",
+			Help:      "Number of container series repeated within a single Kubelet response by metric name",
+		},
+		[]string{"metric"},
+	)
+	podsDroppedPartial = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "pods_dropped_partial_total",
+			Help:      "Number of pods dropped while decoding Kubelet responses due to incomplete container metrics by reason: missing_cpu, missing_memory or missing_container.",
+		},
+		[]string{"reason"},
+	)
+	nodeContainerDropRatio = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("node"),
+			Name:      "container_drop_ratio",
+			Help:      "Fraction of containers running on the node dropped while decoding the last Kubelet response.",
+		},
+		[]string{"node"},
+	)
+	unhealthyBatches = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("kubelet"),
+			Name:      "unhealthy_responses_total",
+			Help:      "Number of Kubelet responses skipped as their health series indicated Kubelet is unhealthy.",
+		},
+		[]string{"node"},
+	)
+	nodeAddressUnresolved = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("node"),
+			Name:      "address_unresolved_total",
+			Help:      "Number of scrapes skipped as node had no address matching preferred address types.",
+		},
+		[]string{"node"},
+	)
+	scrapeErrors = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "scrape_error_total",
+			Help:      "Number of failed requests to Kubelet resource metrics endpoint by reason: connection, http_status, decode or timeout.",
+		},
+		[]string{"reason"},
+	)
+	scrapeTimeSkew = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "scrape_time_skew_seconds",
+			Help:      "Difference between the time of scraping the node and timestamp of its metrics point in seconds. Negative or large values indicate clock skew of the node.",
+			Buckets:   []float64{-60, -10, -1, 0, 1, 5, 10, 15, 30, 60, 120},
+		},
+		[]string{"node"},
+	)
+	batchResourceTypes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "batch_resource_types",
+			Help:      "Number of node and container metrics points carrying each resource type in the last decoded response of the node's Kubelet: cpu, memory, filesystem or swap.",
+		},
+		[]string{"node", "type"},
+	)
+}
+
+const (
+	resourceTypeCpu        = "cpu"
+	resourceTypeMemory     = "memory"
+	resourceTypeFilesystem = "filesystem"
+	resourceTypeSwap       = "swap"
+)
+
+// resourceTypes are resource types reported by batchResourceTypes.
+var resourceTypes = []string{resourceTypeCpu, resourceTypeMemory, resourceTypeFilesystem, resourceTypeSwap}
+
+const (
+	partialDataMissingCpu       = "missing_cpu"
+	partialDataMissingMemory    = "missing_memory"
+	partialDataMissingContainer = "missing_container"
+)
+
+const (
+	droppedContainerLimit = "container_limit"
+	droppedIncompletePod  = "incomplete_pod"
+)
+
+const (
+	scrapeErrorConnection = "connection"
+	scrapeErrorHTTPStatus = "http_status"
+	scrapeErrorDecode     = "decode"
+	scrapeErrorTimeout    = "timeout"
+)
+
+// RegisterClientMetrics registers metrics about data decoded from Kubelet
+// resource metrics endpoint and errors getting it.
+func RegisterClientMetrics(registrationFunc func(metrics.Registerable) error, prefix utils.MetricsPrefix) error {
+	if prefix != definedPrefix {
+		defineMetrics(prefix)
+	}
+	for _, metric := range []metrics.Registerable{
+		nodeFilesystemUsage,
+		droppedContainers,
+		nodeContainerOOMKills,
+		nodeContainerDropRatio,
+		duplicateSeries,
+		podsDroppedPartial,
+		unhealthyBatches,
+		nodeAddressUnresolved,
+		scrapeErrors,
+		scrapeTimeSkew,
+		batchResourceTypes,
+	} {
+		err := registrationFunc(metric)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteNodeMetrics drops series of the node from metrics labeled by node.
+func deleteNodeMetrics(nodeName string) {
+	labels := map[string]string{"node": nodeName}
+	nodeFilesystemUsage.Delete(labels)
+	nodeContainerOOMKills.Delete(labels)
+	nodeContainerDropRatio.Delete(labels)
+	unhealthyBatches.Delete(labels)
+	nodeAddressUnresolved.Delete(labels)
+	scrapeTimeSkew.Delete(labels)
+	for _, resourceType := range resourceTypes {
+		batchResourceTypes.Delete(map[string]string{"node": nodeName, "type": resourceType})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// nodeCAClients provides clients verifying Kubelet serving certificates against CA bundle of each node,
+// read from file named after the node in a directory. Bundles are re-read when their modification time
+// changes, so rotated CAs are picked up without restart. Nil nodeCAClients is valid and provides no clients.
+type nodeCAClients struct {
+	dir       string
+	newClient func(caData []byte) (*http.Client, error)
+
+	mu sync.Mutex
+	// clients by node name, with nil client for nodes without CA bundle.
+	clients map[string]nodeCAClient
+}
+
+// nodeCAClient is a client built from CA bundle of a node, with modification time of the bundle read.
+type nodeCAClient struct {
+	client  *http.Client
+	modTime time.Time
+}
+
+func newNodeCAClients(dir string, newClient func(caData []byte) (*http.Client, error)) *nodeCAClients {
+	return &nodeCAClients{
+		dir:       dir,
+		newClient: newClient,
+		clients:   make(map[string]nodeCAClient),
+	}
+}
+
+// nodeCAFile returns path of the CA bundle of the node.
+func (n *nodeCAClients) nodeCAFile(nodeName string) string {
+	return filepath.Join(n.dir, nodeName+".crt")
+}
+
+// clientFor returns client verifying Kubelet with CA bundle of the node, or nil if the node has no CA bundle.
+func (n *nodeCAClients) clientFor(nodeName string) (*http.Client, error) {
+	if n == nil {
+		return nil, nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	cached, found := n.clients[nodeName]
+	path := n.nodeCAFile(nodeName)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if !found || cached.client != nil {
+			klog.V(2).InfoS("Node has no CA bundle, verifying its Kubelet with cluster CA", "node", klog.KRef("", nodeName), "path", path)
+			n.clients[nodeName] = nodeCAClient{}
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading CA bundle of node %q: %w", nodeName, err)
+	}
+	if found && cached.client != nil && cached.modTime.Equal(info.ModTime()) {
+		return cached.client, nil
+	}
+	caData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading CA bundle of node %q: %w", nodeName, err)
+	}
+	c, err := n.newClient(caData)
+	if err != nil {
+		return nil, fmt.Errorf("failed constructing client with CA bundle of node %q: %w", nodeName, err)
+	}
+	if found && cached.client != nil {
+		klog.V(2).InfoS("Reloaded modified CA bundle of node", "node", klog.KRef("", nodeName), "path", path)
+	}
+	n.clients[nodeName] = nodeCAClient{client: c, modTime: info.ModTime()}
+	return c, nil
+}
+
+// forget drops client of the node, called once the node is no longer scraped.
+func (n *nodeCAClients) forget(nodeName string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.clients, nodeName)
+}
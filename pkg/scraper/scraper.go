@@ -17,18 +17,23 @@ package scraper
 import (
 	"context"
 	"errors"
+	"math"
 	"math/rand"
+	"sort"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	apitypes "k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	v1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/component-base/metrics"
 	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 const (
@@ -37,20 +42,46 @@ const (
 )
 
 var (
+	// definedPrefix is the prefix metrics were last defined with.
+	definedPrefix       utils.MetricsPrefix
+	requestDuration     *metrics.HistogramVec
+	lastRequestDuration *metrics.GaugeVec
+	requestTotal        *metrics.CounterVec
+	lastRequestTime     *metrics.GaugeVec
+	oldestNodeAge       *metrics.Gauge
+	queueDepth          *metrics.Gauge
+)
+
+func init() {
+	defineMetrics(utils.MetricsPrefix{})
+}
+
+// defineMetrics defines metrics of the package with names prefixed with prefix.
+func defineMetrics(prefix utils.MetricsPrefix) {
+	definedPrefix = prefix
 	requestDuration = metrics.NewHistogramVec(
 		&metrics.HistogramOpts{
-			Namespace: "metrics_server",
-			Subsystem: "kubelet",
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("kubelet"),
 			Name:      "request_duration_seconds",
 			Help:      "Duration of requests to Kubelet API in seconds",
 			Buckets:   metrics.DefBuckets,
 		},
 		[]string{"node"},
 	)
+	lastRequestDuration = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("kubelet"),
+			Name:      "last_request_duration_seconds",
+			Help:      "Duration of last request to Kubelet API in seconds",
+		},
+		[]string{"node"},
+	)
 	requestTotal = metrics.NewCounterVec(
 		&metrics.CounterOpts{
-			Namespace: "metrics_server",
-			Subsystem: "kubelet",
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("kubelet"),
 			Name:      "request_total",
 			Help:      "Number of requests sent to Kubelet API",
 		},
@@ -58,22 +89,44 @@ var (
 	)
 	lastRequestTime = metrics.NewGaugeVec(
 		&metrics.GaugeOpts{
-			Namespace: "metrics_server",
-			Subsystem: "kubelet",
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("kubelet"),
 			Name:      "last_request_time_seconds",
 			Help:      "Time of last request performed to Kubelet API since unix epoch in seconds",
 		},
 		[]string{"node"},
 	)
-)
+	oldestNodeAge = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("scraper"),
+			Name:      "oldest_node_age_seconds",
+			Help:      "Longest time since any node in the round-robin scrape rotation was scraped, in seconds",
+		},
+	)
+	queueDepth = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("scraper"),
+			Name:      "queue_depth",
+			Help:      "Number of nodes waiting for a free slot to be scraped, when concurrent scrapes are limited",
+		},
+	)
+}
 
-// RegisterScraperMetrics registers rate, errors, and duration metrics on
+// RegisterScraperMetrics registers rate, errors, duration and scrape rotation metrics on
 // Kubelet API scrapes.
-func RegisterScraperMetrics(registrationFunc func(metrics.Registerable) error) error {
+func RegisterScraperMetrics(registrationFunc func(metrics.Registerable) error, prefix utils.MetricsPrefix) error {
+	if prefix != definedPrefix {
+		defineMetrics(prefix)
+	}
 	for _, metric := range []metrics.Registerable{
 		requestDuration,
+		lastRequestDuration,
 		requestTotal,
 		lastRequestTime,
+		oldestNodeAge,
+		queueDepth,
 	} {
 		err := registrationFunc(metric)
 		if err != nil {
@@ -83,17 +136,82 @@ func RegisterScraperMetrics(registrationFunc func(metrics.Registerable) error) e
 	return nil
 }
 
-func NewScraper(nodeLister v1listers.NodeLister, client client.KubeletMetricsGetter, scrapeTimeout time.Duration, labelRequirement []labels.Requirement) *scraper {
+// Option configures optional scraper behavior.
+type Option func(*scraper)
+
+// WithClusterName tags every scraped batch with the given cluster name.
+func WithClusterName(name string) Option {
+	return func(s *scraper) {
+		s.clusterName = name
+	}
+}
+
+// WithNodeRelist periodically lists nodes directly from API server and merges them
+// with nodes from the informer, as a safety net for informer lagging behind.
+func WithNodeRelist(nodeClient corev1client.NodeInterface, interval time.Duration) Option {
+	return func(s *scraper) {
+		s.nodeClient = nodeClient
+		s.nodeRelistInterval = interval
+	}
+}
+
+// WithPodNodeSelector restricts scraping to nodes hosting at least one pod
+// matching the given selector, as assigned in the pod lister.
+func WithPodNodeSelector(podLister v1listers.PodLister, selector labels.Selector) Option {
+	return func(s *scraper) {
+		s.podLister = podLister
+		s.podSelector = selector
+	}
+}
+
+// WithMaxNodesPerCycle limits the number of nodes scraped in a single cycle, scraping nodes
+// round-robin across cycles. Nodes not scraped in a cycle are reported with their last scraped metrics.
+func WithMaxNodesPerCycle(max int) Option {
+	return func(s *scraper) {
+		s.maxNodesPerCycle = max
+	}
+}
+
+// WithMaxConcurrentScrapes limits the number of nodes scraped at the same time, queueing the others.
+func WithMaxConcurrentScrapes(max int) Option {
+	return func(s *scraper) {
+		s.scrapeSlots = make(chan struct{}, max)
+	}
+}
+
+// WithScrapeWorkers scrapes nodes using a fixed number of worker goroutines pulling nodes from a queue,
+// instead of spawning a goroutine per node in each cycle.
+func WithScrapeWorkers(workers int) Option {
+	return func(s *scraper) {
+		s.scrapeWorkers = workers
+	}
+}
+
+// WithScrapeBudget computes scrape timeout from the number of nodes scraped in a cycle as base plus perNode
+// for each node, up to max, instead of using a fixed timeout. The budget is re-evaluated when the number of
+// nodes changes by more than budgetNodeChange.
+func WithScrapeBudget(base, perNode, max time.Duration) Option {
+	return func(s *scraper) {
+		s.budget = &scrapeBudget{base: base, perNode: perNode, max: max}
+		s.budgetNodes = -1
+	}
+}
+
+func NewScraper(nodeLister v1listers.NodeLister, client client.KubeletMetricsGetter, scrapeTimeout time.Duration, labelRequirement []labels.Requirement, opts ...Option) *scraper {
 	labelSelector := labels.Everything()
 	if labelRequirement != nil {
 		labelSelector = labelSelector.Add(labelRequirement...)
 	}
-	return &scraper{
+	s := &scraper{
 		nodeLister:    nodeLister,
 		kubeletClient: client,
 		scrapeTimeout: scrapeTimeout,
 		labelSelector: labelSelector,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 type scraper struct {
@@ -101,6 +219,75 @@ type scraper struct {
 	kubeletClient client.KubeletMetricsGetter
 	scrapeTimeout time.Duration
 	labelSelector labels.Selector
+	clusterName   string
+
+	// nodeClient is used to list nodes directly, if set.
+	nodeClient         corev1client.NodeInterface
+	nodeRelistInterval time.Duration
+	// relistedNodes and lastNodeRelist are only accessed from Scrape, which is not called concurrently.
+	relistedNodes  []*corev1.Node
+	lastNodeRelist time.Time
+
+	// podLister is used to skip nodes not hosting pods matching podSelector, if set.
+	podLister   v1listers.PodLister
+	podSelector labels.Selector
+
+	// maxNodesPerCycle limits the number of nodes scraped in a single cycle, zero means unlimited.
+	maxNodesPerCycle int
+	// nextNode and nodeBatches are only accessed from Scrape, which is not called concurrently.
+	// nextNode is the index of the first node to scrape in the next cycle, within nodes sorted by name.
+	nextNode int
+	// nodeBatches stores last scraped metrics per node, reported in cycles the node is not scraped.
+	nodeBatches map[string]*storage.MetricsBatch
+	// nodeScrapeTimes stores the time each node was last scraped, or first seen if not scraped yet.
+	nodeScrapeTimes map[string]time.Time
+
+	// scrapedNodes are names of nodes in the scrape set of the previous cycle, only accessed from Scrape.
+	scrapedNodes map[string]struct{}
+
+	// scrapeSlots limits concurrent node scrapes to its capacity, if set.
+	scrapeSlots chan struct{}
+	// scrapeWorkers is the number of goroutines scraping nodes in a cycle, zero means a goroutine per node.
+	scrapeWorkers int
+
+	// budget computes scrape timeout from the number of nodes, if set. scrapeTimeout is used otherwise.
+	budget *scrapeBudget
+	// budgetNodes and budgetTimeout are only accessed from Scrape, which is not called concurrently.
+	// budgetTimeout is the scrape timeout last computed for budgetNodes nodes, budgetNodes is negative until then.
+	budgetNodes   int
+	budgetTimeout time.Duration
+}
+
+// budgetNodeChange is the relative change of the number of nodes re-evaluating scrape budget.
+const budgetNodeChange = 0.1
+
+type scrapeBudget struct {
+	base    time.Duration
+	perNode time.Duration
+	max     time.Duration
+}
+
+// timeout returns scrape timeout for the given number of nodes.
+func (b scrapeBudget) timeout(nodes int) time.Duration {
+	timeout := b.base + time.Duration(nodes)*b.perNode
+	if timeout > b.max {
+		return b.max
+	}
+	return timeout
+}
+
+// cycleTimeout returns scrape timeout of a cycle scraping the given number of nodes.
+func (c *scraper) cycleTimeout(nodes int) time.Duration {
+	if c.budget == nil {
+		return c.scrapeTimeout
+	}
+	change := float64(nodes - c.budgetNodes)
+	if c.budgetNodes < 0 || math.Abs(change) > budgetNodeChange*float64(c.budgetNodes) {
+		c.budgetNodes = nodes
+		c.budgetTimeout = c.budget.timeout(nodes)
+		klog.InfoS("Computed scrape budget", "nodeCount", nodes, "timeout", c.budgetTimeout)
+	}
+	return c.budgetTimeout
 }
 
 var _ Scraper = (*scraper)(nil)
@@ -118,12 +305,26 @@ func (c *scraper) Scrape(baseCtx context.Context) *storage.MetricsBatch {
 		// report the error and continue on in case of partial results
 		klog.ErrorS(err, "Failed to list nodes")
 	}
+	if c.nodeClient != nil {
+		nodes = c.mergeRelistedNodes(baseCtx, nodes)
+	}
+	if c.podLister != nil {
+		nodes = c.filterNodesHostingPods(nodes)
+	}
+	if err == nil {
+		c.forgetRemovedNodes(nodes)
+	}
+	var cached []*storage.MetricsBatch
+	if c.maxNodesPerCycle > 0 {
+		nodes, cached = c.nodesInCycle(nodes)
+	}
 	klog.V(1).InfoS("Scraping metrics from nodes", "nodes", klog.KObjSlice(nodes), "nodeCount", len(nodes), "nodeSelector", c.labelSelector)
 
-	responseChannel := make(chan *storage.MetricsBatch, len(nodes))
+	responseChannel := make(chan nodeBatch, len(nodes))
 	defer close(responseChannel)
 
 	startTime := myClock.Now()
+	timeout := c.cycleTimeout(len(nodes))
 
 	// TODO(serathius): re-evaluate this code -- do we really need to stagger fetches like this?
 	delayMs := delayPerSourceMs * len(nodes)
@@ -131,35 +332,58 @@ func (c *scraper) Scrape(baseCtx context.Context) *storage.MetricsBatch {
 		delayMs = maxDelayMs
 	}
 
-	for _, node := range nodes {
-		go func(node *corev1.Node) {
-			// Prevents network congestion.
-			sleepDuration := time.Duration(rand.Intn(delayMs)) * time.Millisecond
-			time.Sleep(sleepDuration)
-			// make the timeout a bit shorter to account for staggering, so we still preserve
-			// the overall timeout
-			ctx, cancelTimeout := context.WithTimeout(baseCtx, c.scrapeTimeout)
-			defer cancelTimeout()
-			klog.V(2).InfoS("Scraping node", "node", klog.KObj(node))
-			m, err := c.collectNode(ctx, node)
-			if err != nil {
-				if errors.Is(err, context.DeadlineExceeded) {
-					klog.ErrorS(err, "Failed to scrape node, timeout to access kubelet", "node", klog.KObj(node), "timeout", c.scrapeTimeout)
-				} else {
-					klog.ErrorS(err, "Failed to scrape node", "node", klog.KObj(node))
+	if c.scrapeWorkers > 0 {
+		nodeChannel := make(chan *corev1.Node, len(nodes))
+		for _, node := range nodes {
+			nodeChannel <- node
+		}
+		close(nodeChannel)
+		for i := 0; i < min(c.scrapeWorkers, len(nodes)); i++ {
+			go func() {
+				// Prevents network congestion. Workers are staggered once, as they scrape nodes one after another.
+				time.Sleep(time.Duration(rand.Intn(delayMs)) * time.Millisecond)
+				for node := range nodeChannel {
+					responseChannel <- c.scrapeCycleNode(baseCtx, node, timeout)
 				}
-			}
-			responseChannel <- m
-		}(node)
+			}()
+		}
+	} else {
+		for _, node := range nodes {
+			go func(node *corev1.Node) {
+				// Prevents network congestion.
+				sleepDuration := time.Duration(rand.Intn(delayMs)) * time.Millisecond
+				time.Sleep(sleepDuration)
+				responseChannel <- c.scrapeCycleNode(baseCtx, node, timeout)
+			}(node)
+		}
 	}
 
 	res := &storage.MetricsBatch{
-		Nodes: map[string]storage.MetricsPoint{},
-		Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+		ClusterName: c.clusterName,
+		Nodes:       map[string]storage.MetricsPoint{},
+		Pods:        map[apitypes.NamespacedName]storage.PodMetricsPoint{},
 	}
 
+	batches := cached
 	for range nodes {
-		srcBatch := <-responseChannel
+		response := <-responseChannel
+		if c.maxNodesPerCycle > 0 {
+			c.nodeBatches[response.node] = response.batch
+		}
+		batches = append(batches, response.batch)
+	}
+	for _, srcBatch := range cached {
+		if srcBatch == nil {
+			continue
+		}
+		for nodeName := range srcBatch.Nodes {
+			res.AddReusedNode(nodeName)
+		}
+		for _, pod := range srcBatch.Pods {
+			res.AddReusedNode(pod.Node)
+		}
+	}
+	for _, srcBatch := range batches {
 		if srcBatch == nil {
 			continue
 		}
@@ -177,16 +401,195 @@ func (c *scraper) Scrape(baseCtx context.Context) *storage.MetricsBatch {
 			}
 			res.Pods[podRef] = podMetricsPoint
 		}
+		for podRef, containers := range srcBatch.DroppedContainers {
+			for containerName, reason := range containers {
+				res.AddDroppedContainer(podRef, containerName, reason)
+			}
+		}
 	}
 
 	klog.V(1).InfoS("Scrape finished", "duration", myClock.Since(startTime), "nodeCount", len(res.Nodes), "podCount", len(res.Pods))
 	return res
 }
 
+// scrapeCycleNode scrapes metrics of a single node within a scrape cycle, waiting for a free scrape slot if limited.
+func (c *scraper) scrapeCycleNode(baseCtx context.Context, node *corev1.Node, timeout time.Duration) nodeBatch {
+	if c.scrapeSlots != nil {
+		if !c.acquireScrapeSlot(baseCtx) {
+			klog.ErrorS(baseCtx.Err(), "Failed to scrape node, no free scrape slot before cycle ended", "node", klog.KObj(node))
+			return nodeBatch{node: node.Name}
+		}
+		defer func() { <-c.scrapeSlots }()
+	}
+	// make the timeout a bit shorter to account for staggering, so we still preserve
+	// the overall timeout
+	ctx, cancelTimeout := context.WithTimeout(baseCtx, timeout)
+	defer cancelTimeout()
+	klog.V(2).InfoS("Scraping node", "node", klog.KObj(node))
+	m, err := c.collectNode(ctx, node)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			klog.ErrorS(err, "Failed to scrape node, timeout to access kubelet", "node", klog.KObj(node), "timeout", timeout)
+		} else {
+			klog.ErrorS(err, "Failed to scrape node", "node", klog.KObj(node))
+		}
+	}
+	return nodeBatch{node: node.Name, batch: m}
+}
+
+// ScrapeNode scrapes metrics of a single node outside of scrape cycles, e.g. to refresh its stale metrics.
+func (c *scraper) ScrapeNode(ctx context.Context, node *corev1.Node) (*storage.MetricsBatch, error) {
+	ctx, cancelTimeout := context.WithTimeout(ctx, c.scrapeTimeout)
+	defer cancelTimeout()
+	return c.collectNode(ctx, node)
+}
+
+// acquireScrapeSlot waits for a free scrape slot, counting the node in queue depth meanwhile.
+// Returns false if the context is done first.
+func (c *scraper) acquireScrapeSlot(ctx context.Context) bool {
+	queueDepth.Inc()
+	defer queueDepth.Dec()
+	select {
+	case c.scrapeSlots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// nodeBatch is a result of scraping a single node.
+type nodeBatch struct {
+	node  string
+	batch *storage.MetricsBatch
+}
+
+// forgetRemovedNodes drops per-node metrics of nodes that left the scrape set since the previous cycle,
+// so series of deleted nodes are not exposed forever.
+func (c *scraper) forgetRemovedNodes(nodes []*corev1.Node) {
+	scraped := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		scraped[node.Name] = struct{}{}
+	}
+	for name := range c.scrapedNodes {
+		if _, found := scraped[name]; found {
+			continue
+		}
+		labels := map[string]string{"node": name}
+		requestDuration.Delete(labels)
+		lastRequestDuration.Delete(labels)
+		lastRequestTime.Delete(labels)
+		if f, ok := c.kubeletClient.(client.NodeForgetter); ok {
+			f.ForgetNode(name)
+		}
+	}
+	c.scrapedNodes = scraped
+}
+
+// nodesInCycle returns up to maxNodesPerCycle nodes to scrape in this cycle, continuing round-robin
+// from the previous cycle, and last scraped metrics of the remaining nodes.
+func (c *scraper) nodesInCycle(nodes []*corev1.Node) ([]*corev1.Node, []*storage.MetricsBatch) {
+	if len(nodes) <= c.maxNodesPerCycle {
+		c.nextNode = 0
+		c.nodeBatches = make(map[string]*storage.MetricsBatch, len(nodes))
+		c.nodeScrapeTimes = nil
+		oldestNodeAge.Set(0)
+		return nodes, nil
+	}
+	sorted := make([]*corev1.Node, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	start := c.nextNode % len(sorted)
+	c.nextNode = (start + c.maxNodesPerCycle) % len(sorted)
+
+	selected := make([]*corev1.Node, 0, c.maxNodesPerCycle)
+	for i := 0; i < c.maxNodesPerCycle; i++ {
+		selected = append(selected, sorted[(start+i)%len(sorted)])
+	}
+	now := myClock.Now()
+	scrapeTimes := make(map[string]time.Time, len(sorted))
+	for _, node := range selected {
+		scrapeTimes[node.Name] = now
+	}
+	// Only keep last metrics of nodes that still exist.
+	batches := make(map[string]*storage.MetricsBatch, len(sorted))
+	var cached []*storage.MetricsBatch
+	var oldestAge time.Duration
+	for i := c.maxNodesPerCycle; i < len(sorted); i++ {
+		name := sorted[(start+i)%len(sorted)].Name
+		if batch, found := c.nodeBatches[name]; found {
+			batches[name] = batch
+			cached = append(cached, batch)
+		}
+		scrapeTime, found := c.nodeScrapeTimes[name]
+		if !found {
+			scrapeTime = now
+		}
+		scrapeTimes[name] = scrapeTime
+		oldestAge = max(oldestAge, now.Sub(scrapeTime))
+	}
+	c.nodeBatches = batches
+	c.nodeScrapeTimes = scrapeTimes
+	oldestNodeAge.Set(oldestAge.Seconds())
+	return selected, cached
+}
+
+// mergeRelistedNodes adds nodes listed directly from API server that are missing in the informer.
+func (c *scraper) mergeRelistedNodes(ctx context.Context, nodes []*corev1.Node) []*corev1.Node {
+	if c.lastNodeRelist.IsZero() || myClock.Since(c.lastNodeRelist) >= c.nodeRelistInterval {
+		list, err := c.nodeClient.List(ctx, metav1.ListOptions{LabelSelector: c.labelSelector.String()})
+		if err != nil {
+			klog.ErrorS(err, "Failed to list nodes directly")
+		} else {
+			c.relistedNodes = make([]*corev1.Node, 0, len(list.Items))
+			for i := range list.Items {
+				c.relistedNodes = append(c.relistedNodes, &list.Items[i])
+			}
+			c.lastNodeRelist = myClock.Now()
+		}
+	}
+	known := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		known[node.Name] = struct{}{}
+	}
+	for _, node := range c.relistedNodes {
+		if _, found := known[node.Name]; !found {
+			klog.V(1).InfoS("Adding node missing in informer", "node", klog.KObj(node))
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// filterNodesHostingPods returns nodes hosting at least one pod matching podSelector.
+func (c *scraper) filterNodesHostingPods(nodes []*corev1.Node) []*corev1.Node {
+	pods, err := c.podLister.List(c.podSelector)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list pods, scraping all nodes", "podSelector", c.podSelector)
+		return nodes
+	}
+	hosting := make(map[string]struct{}, len(pods))
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" {
+			hosting[pod.Spec.NodeName] = struct{}{}
+		}
+	}
+	filtered := make([]*corev1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if _, found := hosting[node.Name]; found {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
+}
+
 func (c *scraper) collectNode(ctx context.Context, node *corev1.Node) (*storage.MetricsBatch, error) {
 	startTime := myClock.Now()
 	defer func() {
-		requestDuration.WithLabelValues(node.Name).Observe(float64(myClock.Since(startTime)) / float64(time.Second))
+		duration := float64(myClock.Since(startTime)) / float64(time.Second)
+		requestDuration.WithLabelValues(node.Name).Observe(duration)
+		lastRequestDuration.WithLabelValues(node.Name).Set(duration)
 		lastRequestTime.WithLabelValues(node.Name).Set(float64(myClock.Now().Unix()))
 	}()
 	ms, err := c.kubeletClient.GetMetrics(ctx, node)
@@ -0,0 +1,89 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+func BenchmarkScrape(b *testing.B) {
+	nodes := generateNodes(1000)
+	for _, workers := range []int{0, 10, 100} {
+		b.Run(fmt.Sprintf("Workers=%d", workers), func(b *testing.B) {
+			client := &goroutineCountingClient{delay: time.Millisecond}
+			scraper := NewScraper(&fakeNodeLister{nodes: nodes}, client, 10*time.Second, nil, WithScrapeWorkers(workers))
+			baseline := runtime.NumGoroutine()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				batch := scraper.Scrape(context.Background())
+				if len(batch.Nodes) != len(nodes) {
+					b.Fatalf("Expected %d nodes, got %d", len(nodes), len(batch.Nodes))
+				}
+			}
+			b.StopTimer()
+			spawned := client.peak() - baseline
+			b.ReportMetric(float64(spawned), "goroutines")
+			// Allow slack for timers and runtime goroutines started meanwhile.
+			if workers > 0 && spawned > workers+10 {
+				b.Errorf("Expected goroutines bounded by %d workers, got %d", workers, spawned)
+			}
+		})
+	}
+}
+
+// generateNodes returns ready nodes with distinct names and addresses.
+func generateNodes(count int) []*corev1.Node {
+	nodes := make([]*corev1.Node, 0, count)
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("node-%d", i)
+		nodes = append(nodes, makeNode(name, name, fmt.Sprintf("10.0.%d.%d", i/256, i%256), true))
+	}
+	return nodes
+}
+
+// goroutineCountingClient returns a node point after delay, recording the peak number of goroutines meanwhile.
+type goroutineCountingClient struct {
+	delay time.Duration
+
+	mu         sync.Mutex
+	goroutines int
+}
+
+func (c *goroutineCountingClient) GetMetrics(_ context.Context, node *corev1.Node) (*storage.MetricsBatch, error) {
+	c.mu.Lock()
+	c.goroutines = max(c.goroutines, runtime.NumGoroutine())
+	c.mu.Unlock()
+	time.Sleep(c.delay)
+	return &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{
+			node.Name: {Timestamp: time.Now(), CumulativeCpuUsed: 1, MemoryUsage: 1},
+		},
+	}, nil
+}
+
+func (c *goroutineCountingClient) peak() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.goroutines
+}
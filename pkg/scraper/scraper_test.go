@@ -28,10 +28,14 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/testutil"
 
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 const timeDrift = 50 * time.Millisecond
@@ -155,9 +159,11 @@ var _ = Describe("Scraper", func() {
 
 	It("should properly calculates metrics", func() {
 		requestDuration.Create(nil)
+		lastRequestDuration.Create(nil)
 		requestTotal.Create(nil)
 		lastRequestTime.Create(nil)
 		requestDuration.Reset()
+		lastRequestDuration.Reset()
 		requestTotal.Reset()
 		lastRequestTime.Reset()
 
@@ -191,6 +197,13 @@ var _ = Describe("Scraper", func() {
 		`), "metrics_server_kubelet_request_duration_seconds")
 		Expect(err).NotTo(HaveOccurred())
 
+		err = testutil.CollectAndCompare(lastRequestDuration, strings.NewReader(`
+		# HELP metrics_server_kubelet_last_request_duration_seconds [ALPHA] Duration of last request to Kubelet API in seconds
+		# TYPE metrics_server_kubelet_last_request_duration_seconds gauge
+		metrics_server_kubelet_last_request_duration_seconds{node="node1"} 1
+		`), "metrics_server_kubelet_last_request_duration_seconds")
+		Expect(err).NotTo(HaveOccurred())
+
 		err = testutil.CollectAndCompare(requestTotal, strings.NewReader(`
 		# HELP metrics_server_kubelet_request_total [ALPHA] Number of requests sent to Kubelet API
 		# TYPE metrics_server_kubelet_request_total counter
@@ -206,6 +219,38 @@ var _ = Describe("Scraper", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("should drop per-node metrics of nodes leaving the scrape set", func() {
+		requestDuration.Create(nil)
+		lastRequestDuration.Create(nil)
+		lastRequestTime.Create(nil)
+		requestDuration.Reset()
+		lastRequestDuration.Reset()
+		lastRequestTime.Reset()
+		myClock = mockClock{}
+		defer func() { myClock = &realClock{} }()
+		nodes := fakeNodeLister{nodes: []*corev1.Node{node1, node4}}
+		scraper := NewScraper(&nodes, &client, 3*time.Second, labelRequirement)
+
+		By("scraping both nodes")
+		scraper.Scrape(context.Background())
+		Expect(client.forgotten).To(BeEmpty())
+		Expect(nodeLabelValues()).To(Equal(map[string][]string{
+			"metrics_server_kubelet_request_duration_seconds":      {"node1", "node4"},
+			"metrics_server_kubelet_last_request_duration_seconds": {"node1", "node4"},
+			"metrics_server_kubelet_last_request_time_seconds":     {"node1", "node4"},
+		}))
+
+		By("scraping after node4 was deleted")
+		nodes.nodes = []*corev1.Node{node1}
+		scraper.Scrape(context.Background())
+		Expect(client.forgotten).To(Equal([]string{"node4"}))
+		Expect(nodeLabelValues()).To(Equal(map[string][]string{
+			"metrics_server_kubelet_request_duration_seconds":      {"node1"},
+			"metrics_server_kubelet_last_request_duration_seconds": {"node1"},
+			"metrics_server_kubelet_last_request_time_seconds":     {"node1"},
+		}))
+	})
+
 	It("should continue on error fetching node information for a particular node", func() {
 		By("deleting node")
 		nodeLister.nodes[0].Status.Addresses = nil
@@ -218,6 +263,164 @@ var _ = Describe("Scraper", func() {
 		By("ensuring that all other node were scraped")
 		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node4", "node-no-host", "node3"}))
 	})
+	It("should tag scraped batch with cluster name", func() {
+		By("running the scraper with a cluster name")
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement, WithClusterName("cluster1"))
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that cluster name is passed with the batch")
+		Expect(dataBatch.ClusterName).To(Equal("cluster1"))
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+	})
+	It("should scrape nodes missed by informer when listing nodes directly", func() {
+		By("setting up informer missing node4")
+		informerNodes := fakeNodeLister{nodes: []*corev1.Node{node1, node2, node3}}
+		nodeClient := fake.NewSimpleClientset(node1, node2, node3, node4).CoreV1().Nodes()
+		scraper := NewScraper(&informerNodes, &client, 5*time.Second, labelRequirement, WithNodeRelist(nodeClient, time.Minute))
+
+		By("running the scraper")
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that node missed by informer was scraped")
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+	})
+	It("should only scrape nodes hosting pods matching the pod selector", func() {
+		By("setting up pods with and without matching labels")
+		podLister := fakePodLister{pods: []*corev1.Pod{
+			makePod("ns1", "pod1", node1.Name, map[string]string{"app": "scoped"}),
+			makePod("ns1", "pod2", node1.Name, map[string]string{"app": "other"}),
+			makePod("ns2", "pod1", node3.Name, map[string]string{"app": "other"}),
+			makePod("ns3", "pod1", node4.Name, map[string]string{"app": "scoped"}),
+		}}
+		selector := labels.SelectorFromSet(labels.Set{"app": "scoped"})
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement, WithPodNodeSelector(&podLister, selector))
+
+		By("running the scraper")
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that only nodes hosting matching pods were scraped")
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node4"}))
+	})
+	It("should scrape nodes round-robin when limiting nodes per cycle", func() {
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement, WithMaxNodesPerCycle(2))
+
+		By("scraping first nodes ordered by name in first cycle")
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node-no-host", "node1"}))
+
+		By("scraping remaining nodes in second cycle, reporting other nodes with last metrics")
+		client.metrics[node1] = &storage.MetricsBatch{Nodes: map[string]storage.MetricsPoint{node1.Name: metricPoint(200, 300, scrapeTime.Add(time.Minute))}}
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node-no-host", "node1", "node3", "node4"}))
+		Expect(dataBatch.Nodes[node1.Name]).To(Equal(metricPoint(100, 200, scrapeTime)))
+		Expect(dataBatch.Pods).To(HaveLen(4))
+
+		By("wrapping around to first nodes in third cycle")
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node-no-host", "node1", "node3", "node4"}))
+		Expect(dataBatch.Nodes[node1.Name]).To(Equal(metricPoint(200, 300, scrapeTime.Add(time.Minute))))
+	})
+	It("should not count points of nodes reused with round-robin as repeated when stored", func() {
+		registry := metrics.NewKubeRegistry()
+		Expect(storage.RegisterStorageMetrics(registry.Register, utils.MetricsPrefix{})).To(Succeed())
+		store := storage.NewStorage(time.Minute)
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement, WithMaxNodesPerCycle(2))
+
+		By("storing first nodes scraped in first cycle")
+		store.Store(scraper.Scrape(context.Background()))
+
+		By("storing remaining nodes scraped in second cycle, with first nodes reused")
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(dataBatch.ReusedNodes).To(HaveKey(node1.Name))
+		store.Store(dataBatch)
+
+		families, err := registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+		for _, family := range families {
+			Expect(family.GetName()).NotTo(Equal("metrics_server_repeated_point_total"))
+		}
+	})
+	It("should compute scrape budget from node count up to the maximum", func() {
+		budget := scrapeBudget{base: 2 * time.Second, perNode: 100 * time.Millisecond, max: 10 * time.Second}
+		Expect(budget.timeout(0)).To(Equal(2 * time.Second))
+		Expect(budget.timeout(10)).To(Equal(3 * time.Second))
+		Expect(budget.timeout(50)).To(Equal(7 * time.Second))
+		Expect(budget.timeout(1000)).To(Equal(10 * time.Second))
+	})
+	It("should re-evaluate scrape budget only on significant node count changes", func() {
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement, WithScrapeBudget(2*time.Second, 100*time.Millisecond, 20*time.Second))
+		Expect(scraper.cycleTimeout(100)).To(Equal(12 * time.Second))
+		Expect(scraper.cycleTimeout(105)).To(Equal(12 * time.Second))
+		Expect(scraper.cycleTimeout(120)).To(Equal(14 * time.Second))
+		Expect(scraper.cycleTimeout(111)).To(Equal(14 * time.Second))
+		Expect(scraper.cycleTimeout(100)).To(Equal(12 * time.Second))
+	})
+	It("should use scrape budget as timeout of scraping nodes", func() {
+		By("setting up one source to take 4 seconds, and another to take 2")
+		client.delay[node1] = 4 * time.Second
+		client.defaultDelay = 2 * time.Second
+
+		By("running the scraper with a budget of 3 seconds for 4 nodes")
+		start := time.Now()
+		scraper := NewScraper(&nodeLister, &client, time.Second, labelRequirement, WithScrapeBudget(time.Second, 500*time.Millisecond, 10*time.Second))
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that scraping took around 3 seconds")
+		Expect(time.Since(start)).To(BeNumerically("~", 3*time.Second, timeDrift))
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node-no-host", "node3", "node4"}))
+	})
+	It("should expose age of the oldest node in scrape rotation", func() {
+		oldestNodeAge.Create(nil)
+		oldestNodeAge.Set(0)
+		defer func() { myClock = &realClock{} }()
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement, WithMaxNodesPerCycle(2))
+
+		By("scraping first nodes, with remaining nodes first seen now")
+		myClock = mockClock{now: scrapeTime}
+		scraper.Scrape(context.Background())
+		expectOldestNodeAge(0)
+
+		By("scraping remaining nodes 10 seconds later")
+		myClock = mockClock{now: scrapeTime.Add(10 * time.Second)}
+		scraper.Scrape(context.Background())
+		expectOldestNodeAge(10)
+
+		By("scraping first nodes again 25 seconds after start")
+		myClock = mockClock{now: scrapeTime.Add(25 * time.Second)}
+		scraper.Scrape(context.Background())
+		expectOldestNodeAge(15)
+	})
+	It("should scrape all nodes using a fixed number of workers", func() {
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement, WithScrapeWorkers(2), WithMaxConcurrentScrapes(1))
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node-no-host", "node1", "node3", "node4"}))
+	})
+	It("should expose nodes waiting for a free slot when limiting concurrent scrapes", func() {
+		queueDepth.Create(nil)
+		queueDepth.Set(0)
+		client.defaultDelay = 100 * time.Millisecond
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement, WithMaxConcurrentScrapes(1))
+
+		By("running the scraper in background")
+		done := make(chan *storage.MetricsBatch)
+		go func() {
+			done <- scraper.Scrape(context.Background())
+		}()
+
+		By("ensuring nodes are queued while one is scraped")
+		Eventually(func() float64 {
+			value, err := testutil.GetGaugeMetricValue(queueDepth)
+			Expect(err).NotTo(HaveOccurred())
+			return value
+		}, 2*time.Second, 5*time.Millisecond).Should(BeNumerically(">", 0))
+
+		By("ensuring all nodes are scraped and queue is drained")
+		dataBatch := <-done
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node-no-host", "node1", "node3", "node4"}))
+		value, err := testutil.GetGaugeMetricValue(queueDepth)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(BeZero())
+	})
 	It("should gracefully handle list errors", func() {
 		By("setting a fake error from the lister")
 		nodeLister.listErr = fmt.Errorf("something went wrong, expectedly")
@@ -228,6 +431,15 @@ var _ = Describe("Scraper", func() {
 	})
 })
 
+func expectOldestNodeAge(seconds int) {
+	err := testutil.CollectAndCompare(oldestNodeAge, strings.NewReader(fmt.Sprintf(`
+		# HELP metrics_server_scraper_oldest_node_age_seconds [ALPHA] Longest time since any node in the round-robin scrape rotation was scraped, in seconds
+		# TYPE metrics_server_scraper_oldest_node_age_seconds gauge
+		metrics_server_scraper_oldest_node_age_seconds %d
+		`, seconds)), "metrics_server_scraper_oldest_node_age_seconds")
+	Expect(err).NotTo(HaveOccurred())
+}
+
 func metricPoint(cpu, memory uint64, time time.Time) storage.MetricsPoint {
 	return storage.MetricsPoint{
 		Timestamp:         time,
@@ -236,13 +448,39 @@ func metricPoint(cpu, memory uint64, time time.Time) storage.MetricsPoint {
 	}
 }
 
+// nodeLabelValues returns values of node label of per-node scraper metrics, by metric name.
+func nodeLabelValues() map[string][]string {
+	registry := metrics.NewKubeRegistry()
+	registry.MustRegister(requestDuration, lastRequestDuration, lastRequestTime)
+	families, err := registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+	values := map[string][]string{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "node" {
+					values[family.GetName()] = append(values[family.GetName()], label.GetValue())
+				}
+			}
+		}
+	}
+	return values
+}
+
 type fakeKubeletClient struct {
 	delay        map[*corev1.Node]time.Duration
 	metrics      map[*corev1.Node]*storage.MetricsBatch
 	defaultDelay time.Duration
+	// forgotten are names of nodes passed to ForgetNode.
+	forgotten []string
 }
 
 var _ client.KubeletMetricsGetter = (*fakeKubeletClient)(nil)
+var _ client.NodeForgetter = (*fakeKubeletClient)(nil)
+
+func (c *fakeKubeletClient) ForgetNode(nodeName string) {
+	c.forgotten = append(c.forgotten, nodeName)
+}
 
 func (c *fakeKubeletClient) GetMetrics(ctx context.Context, node *corev1.Node) (*storage.MetricsBatch, error) {
 	delay, ok := c.delay[node]
@@ -250,6 +488,14 @@ func (c *fakeKubeletClient) GetMetrics(ctx context.Context, node *corev1.Node) (
 		delay = c.defaultDelay
 	}
 	metrics, ok := c.metrics[node]
+	if !ok {
+		// nodes listed directly from API server are copies, so fallback to matching by name
+		for n, m := range c.metrics {
+			if n.Name == node.Name {
+				metrics, ok = m, true
+			}
+		}
+	}
 	if !ok {
 		return nil, fmt.Errorf("Unknown node %q", node.Name)
 	}
@@ -284,6 +530,27 @@ func (l *fakeNodeLister) Get(name string) (*corev1.Node, error) {
 	return nil, fmt.Errorf("no such node %q", name)
 }
 
+type fakePodLister struct {
+	v1listers.PodLister
+	pods []*corev1.Pod
+}
+
+func (l *fakePodLister) List(selector labels.Selector) (ret []*corev1.Pod, err error) {
+	for _, pod := range l.pods {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			ret = append(ret, pod)
+		}
+	}
+	return ret, nil
+}
+
+func makePod(namespace, name, nodeName string, podLabels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: podLabels},
+		Spec:       corev1.PodSpec{NodeName: nodeName},
+	}
+}
+
 func makeNode(name, hostName, addr string, ready bool) *corev1.Node {
 	res := &corev1.Node{
 		ObjectMeta: metav1.ObjectMeta{Name: name},
@@ -0,0 +1,67 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// gzipHandler compresses responses of the handler with the given gzip level for clients accepting gzip encoding.
+func gzipHandler(level int, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(req) {
+			h.ServeHTTP(w, req)
+			return
+		}
+		gw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			klog.ErrorS(err, "Failed creating gzip writer, responding uncompressed", "level", level)
+			h.ServeHTTP(w, req)
+			return
+		}
+		defer gw.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		h.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, writer: gw}, req)
+	})
+}
+
+func acceptsGzip(req *http.Request) bool {
+	for _, encoding := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writer *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	// Length of compressed body differs from the one set by handler.
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	return w.writer.Write(b)
+}
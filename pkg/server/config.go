@@ -15,7 +15,9 @@ package server
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,7 +25,11 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	apimetrics "k8s.io/apiserver/pkg/endpoints/metrics"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/kubernetes"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/pkg/version"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/legacyregistry"
 	_ "k8s.io/component-base/metrics/prometheus/restclient" // for client-go metrics registration
@@ -36,12 +42,56 @@ import (
 )
 
 type Config struct {
-	Apiserver        *genericapiserver.Config
-	Rest             *rest.Config
-	Kubelet          *client.KubeletClientConfig
-	MetricResolution time.Duration
-	ScrapeTimeout    time.Duration
-	NodeSelector     string
+	Apiserver                *genericapiserver.Config
+	Rest                     *rest.Config
+	Kubelet                  *client.KubeletClientConfig
+	MetricResolution         time.Duration
+	ScrapeTimeout            time.Duration
+	NodeSelector             string
+	ClusterName              string
+	NodePodSumDiff           bool
+	ListCacheTTL             time.Duration
+	ExplainMissingPodMetrics bool
+	ExcludeInitContainers    bool
+	ExcludeEphemeral         bool
+	PendingPodsAsZero        bool
+	CPURequestUtilization    bool
+	MetricsNamespace         string
+	MetricsSubsystemPrefix   string
+	PodEvictionTTL           time.Duration
+	TopPort                  int
+	ResponseCompressionLevel int
+	CPUEWMAAlpha             float64
+	PodUIDAnnotation         bool
+	ScrapePodSelector        string
+	WarmupPolicy             storage.WarmupPolicy
+	NodeMetricsLabels        []string
+	MaxNodesPerCycle         int
+	PodNodeNameSelector      bool
+	PodSkipAnnotation        string
+	StaleAfter               time.Duration
+	VersionAnnotation        bool
+	NodeAgeAnnotation        bool
+	PodsMissingInInformer    bool
+	ListParallelism          int
+	MaxConcurrentScrapes     int
+	ScrapeWorkers            int
+	ScrapeBudgetBase         time.Duration
+	ScrapeBudgetPerNode      time.Duration
+	RefreshStaleNodesAfter   time.Duration
+	NodeRelistInterval       time.Duration
+	EnableStorageReset       bool
+	EnableLatestPoints       bool
+	EnablePodContainers      bool
+	ReadinessGracePeriod     time.Duration
+	DefaultWindow            time.Duration
+
+	// Storage is an optional alternate storage backend, e.g. shared between replicas. Defaults to in-memory storage,
+	// configured by options above. Storage reset and node reboot handling require backend to implement them.
+	Storage storage.Storage
+	// Sinks are optional consumers receiving each scraped batch in addition to storage, e.g. forwarding metrics
+	// elsewhere. Errors returned by sinks are logged without affecting serving.
+	Sinks []storage.Sink
 }
 
 func (c Config) Complete() (*server, error) {
@@ -68,7 +118,59 @@ func (c Config) Complete() (*server, error) {
 			return nil, err
 		}
 	}
-	scrape := scraper.NewScraper(nodes.Lister(), kubeletClient, c.ScrapeTimeout, labelRequirement)
+	var podStatusInformer cache.SharedIndexInformer
+	var podStatusLister v1listers.PodLister
+	scrapePodSelector := strings.TrimSpace(c.ScrapePodSelector)
+	if c.ExplainMissingPodMetrics || c.ExcludeInitContainers || c.ExcludeEphemeral || c.CPURequestUtilization || c.PodNodeNameSelector || scrapePodSelector != "" {
+		podInformerFactory, err := podPhaseInformer(c.Rest, corev1.PodRunning)
+		if err != nil {
+			return nil, err
+		}
+		pods := podInformerFactory.Core().V1().Pods()
+		podStatusInformer = pods.Informer()
+		podStatusLister = pods.Lister()
+	}
+	// pending pods are excluded from the informers above, which only watch running pods
+	var pendingPodInformer cache.SharedIndexInformer
+	var pendingPodLister v1listers.PodLister
+	if c.PendingPodsAsZero {
+		pendingInformerFactory, err := podPhaseInformer(c.Rest, corev1.PodPending)
+		if err != nil {
+			return nil, err
+		}
+		pods := pendingInformerFactory.Core().V1().Pods()
+		pendingPodInformer = pods.Informer()
+		pendingPodLister = pods.Lister()
+	}
+	scraperOpts := []scraper.Option{scraper.WithClusterName(c.ClusterName)}
+	if c.MaxNodesPerCycle > 0 {
+		scraperOpts = append(scraperOpts, scraper.WithMaxNodesPerCycle(c.MaxNodesPerCycle))
+	}
+	if c.MaxConcurrentScrapes > 0 {
+		scraperOpts = append(scraperOpts, scraper.WithMaxConcurrentScrapes(c.MaxConcurrentScrapes))
+	}
+	if c.ScrapeWorkers > 0 {
+		scraperOpts = append(scraperOpts, scraper.WithScrapeWorkers(c.ScrapeWorkers))
+	}
+	if c.ScrapeBudgetPerNode > 0 {
+		scraperOpts = append(scraperOpts, scraper.WithScrapeBudget(c.ScrapeBudgetBase, c.ScrapeBudgetPerNode, c.MetricResolution))
+	}
+	if scrapePodSelector != "" {
+		podSelector, err := labels.Parse(scrapePodSelector)
+		if err != nil {
+			return nil, err
+		}
+		scraperOpts = append(scraperOpts, scraper.WithPodNodeSelector(podStatusLister, podSelector))
+	}
+	if c.NodeRelistInterval > 0 {
+		client, err := kubernetes.NewForConfig(c.Rest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to construct node client: %v", err)
+		}
+		scraperOpts = append(scraperOpts, scraper.WithNodeRelist(client.CoreV1().Nodes(), c.NodeRelistInterval))
+	}
+	sources := map[string]client.KubeletMetricsGetter{client.ScrapeSourceResource: kubeletClient}
+	scrape := scraper.NewScraper(nodes.Lister(), client.NewSourceDispatcher(client.ScrapeSourceResource, sources), c.ScrapeTimeout, labelRequirement, scraperOpts...)
 
 	// Disable default metrics handler and create custom one
 	c.Apiserver.EnableMetrics = false
@@ -76,14 +178,83 @@ func (c Config) Complete() (*server, error) {
 	if err != nil {
 		return nil, err
 	}
+	if buildHandlerChain := c.Apiserver.BuildHandlerChainFunc; buildHandlerChain != nil {
+		c.Apiserver.BuildHandlerChainFunc = func(h http.Handler, conf *genericapiserver.Config) http.Handler {
+			return buildHandlerChain(api.RequestedResourcesHandler(h), conf)
+		}
+	}
 	genericServer, err := c.Apiserver.Complete(nil).New("metrics-server", genericapiserver.NewEmptyDelegate())
 	if err != nil {
 		return nil, err
 	}
 	genericServer.Handler.NonGoRestfulMux.HandleFunc("/metrics", metricsHandler)
 
-	store := storage.NewStorage(c.MetricResolution)
-	if err := api.Install(store, podInformer.Lister(), nodes.Lister(), genericServer, labelRequirement); err != nil {
+	store := c.newStorage()
+	if resetter, ok := store.(storageResetter); ok && c.EnableStorageReset {
+		genericServer.Handler.NonGoRestfulMux.HandleFunc(storageResetPath, storageResetHandler(resetter))
+	}
+	if getter, ok := store.(latestBatchGetter); ok && c.EnableLatestPoints {
+		genericServer.Handler.NonGoRestfulMux.HandleFunc(latestPointsPath, latestPointsHandler(getter))
+	}
+	var apiOpts []api.Option
+	if c.ListCacheTTL > 0 {
+		apiOpts = append(apiOpts, api.WithListCache(c.ListCacheTTL))
+	}
+	if len(c.NodeMetricsLabels) > 0 {
+		apiOpts = append(apiOpts, api.WithNodeLabels(c.NodeMetricsLabels))
+	}
+	if c.PodUIDAnnotation {
+		apiOpts = append(apiOpts, api.WithPodUIDAnnotation())
+	}
+	if c.StaleAfter > 0 {
+		apiOpts = append(apiOpts, api.WithStaleAnnotation(c.StaleAfter))
+	}
+	if c.ListParallelism > 1 {
+		apiOpts = append(apiOpts, api.WithListParallelism(c.ListParallelism))
+	}
+	if c.VersionAnnotation {
+		apiOpts = append(apiOpts, api.WithVersionAnnotation(version.Get().GitVersion))
+	}
+	if c.NodeAgeAnnotation {
+		apiOpts = append(apiOpts, api.WithNodeAgeAnnotation())
+	}
+	if c.PodsMissingInInformer {
+		apiOpts = append(apiOpts, api.WithPodsMissingInInformer())
+	}
+	if c.PodSkipAnnotation != "" {
+		apiOpts = append(apiOpts, api.WithPodSkipAnnotation(c.PodSkipAnnotation))
+	}
+	if pendingPodLister != nil {
+		apiOpts = append(apiOpts, api.WithPendingPodsAsZero(pendingPodLister))
+	}
+	if podStatusLister != nil {
+		if c.ExplainMissingPodMetrics {
+			apiOpts = append(apiOpts, api.WithPodStatusLister(podStatusLister))
+		}
+		if c.ExcludeInitContainers {
+			apiOpts = append(apiOpts, api.WithoutInitContainers(podStatusLister))
+		}
+		if c.ExcludeEphemeral {
+			apiOpts = append(apiOpts, api.WithoutEphemeralContainers(podStatusLister))
+		}
+		if c.CPURequestUtilization {
+			apiOpts = append(apiOpts, api.WithCPURequestUtilization(podStatusLister))
+		}
+		if c.PodNodeNameSelector {
+			apiOpts = append(apiOpts, api.WithPodNodeNameSelector(podStatusLister))
+		}
+	}
+	var refresher *nodeRefresher
+	if c.RefreshStaleNodesAfter > 0 {
+		refresher = newNodeRefresher(scrape, nodes.Lister(), c.RefreshStaleNodesAfter)
+		apiOpts = append(apiOpts, api.WithStaleNodeRefresh(c.RefreshStaleNodesAfter, refresher.Refresh))
+	}
+	if forgetter, ok := store.(nodeForgetter); ok {
+		if _, err := nodes.Informer().AddEventHandler(nodeReadyHandler(forgetter)); err != nil {
+			return nil, err
+		}
+	}
+	if err := api.Install(store, podInformer.Lister(), nodes.Lister(), genericServer, labelRequirement, apiOpts...); err != nil {
 		return nil, err
 	}
 
@@ -95,6 +266,29 @@ func (c Config) Complete() (*server, error) {
 		scrape,
 		c.MetricResolution,
 	)
+	s.podStatus = podStatusInformer
+	s.pendingPods = pendingPodInformer
+	if getter, ok := store.(latestBatchGetter); ok && c.EnablePodContainers {
+		genericServer.Handler.NonGoRestfulMux.HandleFunc(podContainersPath, podContainersHandler(getter, s.droppedContainers))
+	}
+	if refresher != nil {
+		refresher.store = s.storeNodeBatch
+	}
+	if len(c.Sinks) > 0 {
+		s.sink = append(storage.MultiSink{storage.StorageSink(store)}, c.Sinks...)
+	}
+	if c.TopPort > 0 {
+		var handler http.Handler = topHandler(store, podInformer.Lister(), nodes.Lister())
+		if c.ResponseCompressionLevel != 0 {
+			handler = gzipHandler(c.ResponseCompressionLevel, handler)
+		}
+		s.top = &http.Server{
+			Addr:              net.JoinHostPort("", strconv.Itoa(c.TopPort)),
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+	s.readinessGracePeriod = c.ReadinessGracePeriod
 	err = s.RegisterProbes(podInformerFactory)
 	if err != nil {
 		return nil, err
@@ -102,10 +296,34 @@ func (c Config) Complete() (*server, error) {
 	return s, nil
 }
 
+// newStorage returns the configured storage backend, defaulting to in-memory storage.
+func (c Config) newStorage() storage.Storage {
+	if c.Storage != nil {
+		return c.Storage
+	}
+	var storageOpts []storage.Option
+	if c.NodePodSumDiff {
+		storageOpts = append(storageOpts, storage.WithNodePodSumDiff())
+	}
+	if c.DefaultWindow > 0 {
+		storageOpts = append(storageOpts, storage.WithDefaultWindow(c.DefaultWindow))
+	}
+	if c.PodEvictionTTL > 0 {
+		storageOpts = append(storageOpts, storage.WithPodEvictionTTL(c.PodEvictionTTL))
+	}
+	if c.CPUEWMAAlpha > 0 {
+		storageOpts = append(storageOpts, storage.WithCPUEWMA(c.CPUEWMAAlpha))
+	}
+	if c.WarmupPolicy != (storage.WarmupPolicy{}) {
+		storageOpts = append(storageOpts, storage.WithWarmupPolicy(c.WarmupPolicy))
+	}
+	return storage.NewStorage(c.MetricResolution, storageOpts...)
+}
+
 func (c Config) metricsHandler() (http.HandlerFunc, error) {
 	// Create registry for Metrics Server metrics
 	registry := metrics.NewKubeRegistry()
-	err := RegisterMetrics(registry, c.MetricResolution)
+	err := RegisterMetrics(registry, c.MetricResolution, c.ScrapeTimeout, c.MetricsNamespace, c.MetricsSubsystemPrefix)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,173 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+const (
+	storageResetPath  = "/debug/storage/reset"
+	latestPointsPath  = "/debug/storage/latest"
+	podContainersPath = "/debug/pods/containers"
+)
+
+type storageResetter interface {
+	Reset()
+}
+
+// storageResetHandler drops all stored metrics on POST request, to help reproducing issues without restart.
+func storageResetHandler(store storageResetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		klog.InfoS("Resetting metrics storage on request")
+		store.Reset()
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+type latestBatchGetter interface {
+	LatestBatch() *storage.MetricsBatch
+}
+
+// latestPoint is the latest stored point of a node or container, passing through values scraped from Kubelet.
+type latestPoint struct {
+	Node      string    `json:"node,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Container string    `json:"container,omitempty"`
+	StartTime time.Time `json:"startTime"`
+	Timestamp time.Time `json:"timestamp"`
+	// CumulativeCpuUsed is the cumulative CPU usage since start time, in core nanoseconds.
+	CumulativeCpuUsed uint64 `json:"cumulativeCpuUsageCoreNanoseconds"`
+	// MemoryUsage is the memory working set, in bytes.
+	MemoryUsage uint64 `json:"memoryWorkingSetBytes"`
+}
+
+type latestPoints struct {
+	Nodes      []latestPoint `json:"nodes"`
+	Containers []latestPoint `json:"containers"`
+}
+
+// latestPointsHandler serves the latest stored points as JSON, without computing rates, for consumers doing their own rate math.
+func latestPointsHandler(store latestBatchGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowGet(w, req) {
+			return
+		}
+		batch := store.LatestBatch()
+		points := latestPoints{
+			Nodes:      make([]latestPoint, 0, len(batch.Nodes)),
+			Containers: make([]latestPoint, 0, len(batch.Pods)),
+		}
+		for name, point := range batch.Nodes {
+			points.Nodes = append(points.Nodes, latestPoint{
+				Node:              name,
+				StartTime:         point.StartTime,
+				Timestamp:         point.Timestamp,
+				CumulativeCpuUsed: point.CumulativeCpuUsed,
+				MemoryUsage:       point.MemoryUsage,
+			})
+		}
+		for ref, pod := range batch.Pods {
+			for name, point := range pod.Containers {
+				points.Containers = append(points.Containers, latestPoint{
+					Node:              pod.Node,
+					Namespace:         ref.Namespace,
+					Pod:               ref.Name,
+					Container:         name,
+					StartTime:         point.StartTime,
+					Timestamp:         point.Timestamp,
+					CumulativeCpuUsed: point.CumulativeCpuUsed,
+					MemoryUsage:       point.MemoryUsage,
+				})
+			}
+		}
+		sort.Slice(points.Nodes, func(i, j int) bool { return points.Nodes[i].Node < points.Nodes[j].Node })
+		sort.Slice(points.Containers, func(i, j int) bool {
+			a, b := points.Containers[i], points.Containers[j]
+			if a.Namespace != b.Namespace {
+				return a.Namespace < b.Namespace
+			}
+			if a.Pod != b.Pod {
+				return a.Pod < b.Pod
+			}
+			return a.Container < b.Container
+		})
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(points); err != nil {
+			klog.ErrorS(err, "Failed writing latest points")
+		}
+	}
+}
+
+// podContainer tells whether storage has a point for the container, and why its metrics were dropped otherwise.
+type podContainer struct {
+	Name       string `json:"name"`
+	HasMetrics bool   `json:"hasMetrics"`
+	DropReason string `json:"dropReason,omitempty"`
+}
+
+type podContainers struct {
+	Namespace  string         `json:"namespace"`
+	Pod        string         `json:"pod"`
+	Containers []podContainer `json:"containers"`
+}
+
+// podContainersHandler serves containers of the pod given by namespace and pod query parameters, with the reason
+// of dropping their metrics during the last scrape, to help debugging missing pod metrics.
+func podContainersHandler(store latestBatchGetter, droppedContainers func(apitypes.NamespacedName) map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !allowGet(w, req) {
+			return
+		}
+		ref := apitypes.NamespacedName{Namespace: req.URL.Query().Get("namespace"), Name: req.URL.Query().Get("pod")}
+		if ref.Namespace == "" || ref.Name == "" {
+			http.Error(w, "namespace and pod query parameters are required", http.StatusBadRequest)
+			return
+		}
+		containers := map[string]*podContainer{}
+		for name := range store.LatestBatch().Pods[ref].Containers {
+			containers[name] = &podContainer{Name: name, HasMetrics: true}
+		}
+		for name, reason := range droppedContainers(ref) {
+			if _, found := containers[name]; !found {
+				containers[name] = &podContainer{Name: name}
+			}
+			containers[name].DropReason = reason
+		}
+		resp := podContainers{Namespace: ref.Namespace, Pod: ref.Name, Containers: make([]podContainer, 0, len(containers))}
+		for _, c := range containers {
+			resp.Containers = append(resp.Containers, *c)
+		}
+		sort.Slice(resp.Containers, func(i, j int) bool { return resp.Containers[i].Name < resp.Containers[j].Name })
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			klog.ErrorS(err, "Failed writing pod containers")
+		}
+	}
+}
@@ -50,3 +50,14 @@ func runningPodMetadataInformer(rest *rest.Config) (metadatainformer.SharedInfor
 		options.FieldSelector = "status.phase=Running"
 	}), nil
 }
+
+// podPhaseInformer returns informer factory of full pod objects in the given phase.
+func podPhaseInformer(rest *rest.Config, phase corev1.PodPhase) (informers.SharedInformerFactory, error) {
+	client, err := kubernetes.NewForConfig(rest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct lister client: %v", err)
+	}
+	return informers.NewSharedInformerFactoryWithOptions(client, defaultResync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.FieldSelector = "status.phase=" + string(phase)
+	})), nil
+}
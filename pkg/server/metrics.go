@@ -22,25 +22,43 @@ import (
 
 	"sigs.k8s.io/metrics-server/pkg/api"
 	"sigs.k8s.io/metrics-server/pkg/scraper"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/resource"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
-// RegisterMetrics registers
-func RegisterMetrics(r metrics.KubeRegistry, metricResolution time.Duration) error {
+// RegisterMetrics registers metrics server components metrics. Non-empty namespace
+// replaces the default metrics namespace and non-empty subsystemPrefix is prepended
+// to metrics subsystem. Metrics are defined again when registered with a different prefix.
+func RegisterMetrics(r metrics.KubeRegistry, metricResolution, scrapeTimeout time.Duration, namespace, subsystemPrefix string) error {
+	prefix := utils.NewMetricsPrefix(namespace, subsystemPrefix)
 	// register metrics server components metrics
-	err := RegisterServerMetrics(r.Register, metricResolution)
+	err := RegisterServerMetrics(r.Register, metricResolution, prefix)
 	if err != nil {
 		return fmt.Errorf("unable to register server metrics: %v", err)
 	}
-	err = scraper.RegisterScraperMetrics(r.Register)
+	err = RegisterConfigMetrics(r.Register, metricResolution, scrapeTimeout, prefix)
+	if err != nil {
+		return fmt.Errorf("unable to register config metrics: %v", err)
+	}
+	err = scraper.RegisterScraperMetrics(r.Register, prefix)
 	if err != nil {
 		return fmt.Errorf("unable to register scraper metrics: %v", err)
 	}
-	err = api.RegisterAPIMetrics(r.Register)
+	err = client.RegisterSourceMetrics(r.Register, prefix)
+	if err != nil {
+		return fmt.Errorf("unable to register scrape source metrics: %v", err)
+	}
+	err = resource.RegisterClientMetrics(r.Register, prefix)
+	if err != nil {
+		return fmt.Errorf("unable to register kubelet client metrics: %v", err)
+	}
+	err = api.RegisterAPIMetrics(r.Register, prefix)
 	if err != nil {
 		return fmt.Errorf("unable to register API metrics: %v", err)
 	}
-	err = storage.RegisterStorageMetrics(r.Register)
+	err = storage.RegisterStorageMetrics(r.Register, prefix)
 	if err != nil {
 		return fmt.Errorf("unable to register storage metrics: %v", err)
 	}
@@ -0,0 +1,144 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+type nodeScraper interface {
+	ScrapeNode(ctx context.Context, node *corev1.Node) (*storage.MetricsBatch, error)
+}
+
+// nodeRefresher re-scrapes nodes with stale metrics in background, at most once per interval for each node
+// to avoid storms of scrapes when stale metrics are requested repeatedly.
+type nodeRefresher struct {
+	scraper    nodeScraper
+	nodeLister v1listers.NodeLister
+	interval   time.Duration
+	// store receives metrics of the refreshed node.
+	store func(node string, batch *storage.MetricsBatch)
+
+	mu          sync.Mutex
+	lastRefresh map[string]time.Time
+}
+
+func newNodeRefresher(scraper nodeScraper, nodeLister v1listers.NodeLister, interval time.Duration) *nodeRefresher {
+	return &nodeRefresher{
+		scraper:     scraper,
+		nodeLister:  nodeLister,
+		interval:    interval,
+		lastRefresh: make(map[string]time.Time),
+	}
+}
+
+// Refresh starts re-scraping the node, unless it was refreshed within the interval.
+func (r *nodeRefresher) Refresh(name string) {
+	r.mu.Lock()
+	now := time.Now()
+	if last, found := r.lastRefresh[name]; found && now.Sub(last) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastRefresh[name] = now
+	r.mu.Unlock()
+	go r.refresh(name)
+}
+
+func (r *nodeRefresher) refresh(name string) {
+	node, err := r.nodeLister.Get(name)
+	if err != nil {
+		klog.ErrorS(err, "Failed to refresh stale node metrics", "node", klog.KRef("", name))
+		return
+	}
+	klog.V(2).InfoS("Refreshing stale node metrics", "node", klog.KObj(node))
+	batch, err := r.scraper.ScrapeNode(context.Background(), node)
+	if err != nil {
+		klog.ErrorS(err, "Failed to refresh stale node metrics", "node", klog.KObj(node))
+		return
+	}
+	r.store(name, batch)
+}
+
+// storeNodeBatch replaces metrics of the node and its pods in the last stored batch with the given batch,
+// storing the result. Batches received before first scrape cycle completes are dropped.
+func (s *server) storeNodeBatch(node string, batch *storage.MetricsBatch) {
+	s.batchMux.Lock()
+	defer s.batchMux.Unlock()
+	if s.lastBatch == nil || batch == nil {
+		return
+	}
+	merged := &storage.MetricsBatch{
+		ClusterName: s.lastBatch.ClusterName,
+		Nodes:       make(map[string]storage.MetricsPoint, len(s.lastBatch.Nodes)),
+		Pods:        make(map[apitypes.NamespacedName]storage.PodMetricsPoint, len(s.lastBatch.Pods)),
+	}
+	// points of other nodes are stored again unchanged, so they are marked as reused
+	for name, point := range s.lastBatch.Nodes {
+		if name != node {
+			merged.Nodes[name] = point
+			merged.AddReusedNode(name)
+		}
+	}
+	for ref, pod := range s.lastBatch.Pods {
+		if pod.Node != node {
+			merged.Pods[ref] = pod
+			merged.AddReusedNode(pod.Node)
+		}
+	}
+	for name, point := range batch.Nodes {
+		merged.Nodes[name] = point
+	}
+	for ref, pod := range batch.Pods {
+		merged.Pods[ref] = pod
+	}
+	for ref, containers := range s.lastBatch.DroppedContainers {
+		if _, found := batch.Pods[ref]; found {
+			continue
+		}
+		if _, found := batch.DroppedContainers[ref]; found {
+			continue
+		}
+		for name, reason := range containers {
+			merged.AddDroppedContainer(ref, name, reason)
+		}
+	}
+	for ref, containers := range batch.DroppedContainers {
+		for name, reason := range containers {
+			merged.AddDroppedContainer(ref, name, reason)
+		}
+	}
+	s.lastBatch = merged
+	s.store(merged)
+}
+
+// droppedContainers returns reasons of dropping container metrics of the pod in the last stored batch.
+func (s *server) droppedContainers(pod apitypes.NamespacedName) map[string]string {
+	s.batchMux.Lock()
+	defer s.batchMux.Unlock()
+	if s.lastBatch == nil {
+		return nil
+	}
+	return s.lastBatch.DroppedContainers[pod]
+}
@@ -38,21 +38,69 @@ var (
 	// (acts as a no-op by default), but we can't just register it in the constructor,
 	// since it could be called multiple times during setup.
 	tickDuration = metrics.NewHistogram(&metrics.HistogramOpts{})
+
+	// definedPrefix is the prefix metrics were last defined with.
+	definedPrefix utils.MetricsPrefix
+	cycleOverlap  *metrics.CounterVec
 )
 
+func init() {
+	defineMetrics(utils.MetricsPrefix{})
+}
+
+// defineMetrics defines metrics of the package with names prefixed with prefix.
+func defineMetrics(prefix utils.MetricsPrefix) {
+	definedPrefix = prefix
+	cycleOverlap = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("scraper"),
+			Name:      "cycle_overlap_total",
+			Help:      "Number of scrape cycles due to start before the previous cycle completed, e.g. as it took longer than metric resolution.",
+		},
+		[]string{},
+	)
+}
+
 // RegisterServerMetrics creates and registers a histogram metric for
 // scrape duration.
-func RegisterServerMetrics(registrationFunc func(metrics.Registerable) error, resolution time.Duration) error {
+func RegisterServerMetrics(registrationFunc func(metrics.Registerable) error, resolution time.Duration, prefix utils.MetricsPrefix) error {
+	if prefix != definedPrefix {
+		defineMetrics(prefix)
+	}
 	tickDuration = metrics.NewHistogram(
 		&metrics.HistogramOpts{
-			Namespace: "metrics_server",
-			Subsystem: "manager",
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("manager"),
 			Name:      "tick_duration_seconds",
 			Help:      "The total time spent collecting and storing metrics in seconds.",
 			Buckets:   utils.BucketsForScrapeDuration(resolution),
 		},
 	)
-	return registrationFunc(tickDuration)
+	if err := registrationFunc(tickDuration); err != nil {
+		return err
+	}
+	return registrationFunc(cycleOverlap)
+}
+
+// RegisterConfigMetrics creates and registers an info metric exposing the
+// running scrape configuration.
+func RegisterConfigMetrics(registrationFunc func(metrics.Registerable) error, resolution, scrapeTimeout time.Duration, prefix utils.MetricsPrefix) error {
+	configInfo := metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "config_info",
+			Help:      "Running configuration of metrics server, value is always 1.",
+		},
+		[]string{"resolution", "scrape_timeout"},
+	)
+	err := registrationFunc(configInfo)
+	if err != nil {
+		return err
+	}
+	configInfo.WithLabelValues(resolution.String(), scrapeTimeout.String()).Set(1)
+	return nil
 }
 
 func NewServer(
@@ -76,15 +124,36 @@ type server struct {
 
 	pods  cache.Controller
 	nodes cache.Controller
+	// podStatus is an optional informer providing full pod objects
+	podStatus cache.Controller
+	// pendingPods is an optional informer providing full objects of pending pods
+	pendingPods cache.Controller
+	// top is an optional unauthenticated server exposing read-only usage views
+	top *http.Server
 
 	storage    storage.Storage
 	scraper    scraper.Scraper
 	resolution time.Duration
+	// sink optionally receives scraped batches instead of storage, fanning them out to storage and other sinks
+	sink storage.Sink
+	// batchMux serializes storing batches, which stale node refreshes do outside of scrape cycles
+	batchMux sync.Mutex
+	// lastBatch is the last stored batch, which refreshed node metrics are merged into
+	lastBatch *storage.MetricsBatch
 
 	// tickStatusMux protects tick fields
 	tickStatusMux sync.RWMutex
 	// tickLastStart is equal to start time of last unfinished tick
 	tickLastStart time.Time
+
+	// readinessGracePeriod is the time failures are tolerated before readiness probes fail
+	readinessGracePeriod time.Duration
+	// storageStatusMux protects storage status fields
+	storageStatusMux sync.Mutex
+	// storageWasReady is true if storage was ready at least once
+	storageWasReady bool
+	// storageNotReadySince is equal to time storage was first found not ready after being ready
+	storageNotReadySince time.Time
 }
 
 // RunUntil starts background scraping goroutine and runs apiserver serving metrics.
@@ -105,21 +174,53 @@ func (s *server) RunUntil(stopCh <-chan struct{}) error {
 	if !ok {
 		return nil
 	}
+	for _, informer := range []cache.Controller{s.podStatus, s.pendingPods} {
+		if informer == nil {
+			continue
+		}
+		go informer.Run(stopCh)
+		ok = cache.WaitForCacheSync(stopCh, informer.HasSynced)
+		if !ok {
+			return nil
+		}
+	}
+
+	if s.top != nil {
+		go s.runTop(stopCh)
+	}
 
 	// Start serving API and scrape loop
 	go s.runScrape(ctx)
 	return s.GenericAPIServer.PrepareRun().RunWithContext(wait.ContextForChannel(stopCh))
 }
 
+func (s *server) runTop(stopCh <-chan struct{}) {
+	go func() {
+		<-stopCh
+		s.top.Close()
+	}()
+	klog.InfoS("Serving read-only top view without authentication", "address", s.top.Addr)
+	if err := s.top.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.ErrorS(err, "Failed serving top view")
+	}
+}
+
 func (s *server) runScrape(ctx context.Context) {
 	ticker := time.NewTicker(s.resolution)
 	defer ticker.Stop()
 	s.tick(ctx, time.Now())
+	lastEnd := time.Now()
 
 	for {
 		select {
 		case startTime := <-ticker.C:
+			// Ticker keeps a tick due while previous cycle was still running
+			if startTime.Before(lastEnd) {
+				cycleOverlap.WithLabelValues().Inc()
+				klog.V(1).InfoS("Scrape cycle started after previous cycle overran", "due", startTime, "previousEnd", lastEnd)
+			}
 			s.tick(ctx, startTime)
+			lastEnd = time.Now()
 		case <-ctx.Done():
 			return
 		}
@@ -138,13 +239,27 @@ func (s *server) tick(ctx context.Context, startTime time.Time) {
 	data := s.scraper.Scrape(ctx)
 
 	klog.V(6).InfoS("Storing metrics")
-	s.storage.Store(data)
+	s.batchMux.Lock()
+	s.lastBatch = data
+	s.store(data)
+	s.batchMux.Unlock()
 
 	collectTime := time.Since(startTime)
 	tickDuration.Observe(float64(collectTime) / float64(time.Second))
 	klog.V(6).InfoS("Scraping cycle complete")
 }
 
+// store sends the batch to sinks if configured, or to storage.
+func (s *server) store(data *storage.MetricsBatch) {
+	if s.sink != nil {
+		if err := s.sink.Receive(data); err != nil {
+			klog.ErrorS(err, "Failed sending metrics to sinks")
+		}
+	} else {
+		s.storage.Store(data)
+	}
+}
+
 func (s *server) RegisterProbes(waiter cacheSyncWaiter) error {
 	err := s.AddReadyzChecks(s.probeMetricStorageReady("metric-storage-ready"))
 	if err != nil {
@@ -187,27 +302,47 @@ func (s *server) probeMetricCollectionTimely(name string) healthz.HealthChecker
 // Check if MS is ready by checking if last tick was ok
 func (s *server) probeMetricStorageReady(name string) healthz.HealthChecker {
 	return healthz.NamedCheck(name, func(r *http.Request) error {
-		if !s.storage.Ready() {
-			err := fmt.Errorf("no metrics to serve")
-			klog.InfoS("Failed probe", "probe", name, "err", err)
-			return err
+		s.storageStatusMux.Lock()
+		defer s.storageStatusMux.Unlock()
+		if s.storage.Ready() {
+			s.storageWasReady = true
+			s.storageNotReadySince = time.Time{}
+			return nil
 		}
-		return nil
+		if s.storageWasReady {
+			if s.storageNotReadySince.IsZero() {
+				s.storageNotReadySince = time.Now()
+			}
+			if notReady := time.Since(s.storageNotReadySince); notReady <= s.readinessGracePeriod {
+				klog.V(1).InfoS("Tolerating no metrics to serve within grace period", "probe", name, "duration", notReady, "gracePeriod", s.readinessGracePeriod)
+				return nil
+			}
+		}
+		err := fmt.Errorf("no metrics to serve")
+		klog.InfoS("Failed probe", "probe", name, "err", err)
+		return err
 	})
 }
 
-// Check if MS is ready by checking if cache has synced
+// Check if MS is ready by checking if caches of all informers have synced.
+// Metrics are not served before that, as pods and nodes missing in the caches would be reported as not found.
 func (s *server) probeMetricCacheHasSynced(name string) healthz.HealthChecker {
 	return healthz.NamedCheck(name, func(r *http.Request) error {
-		if !s.nodes.HasSynced() {
-			err := fmt.Errorf("cache for node informer has not synced")
-			klog.InfoS("Failed probe", "probe", name, "err", err)
-			return err
+		informers := []struct {
+			name     string
+			informer cache.Controller
+		}{
+			{"node", s.nodes},
+			{"pod", s.pods},
+			{"pod status", s.podStatus},
+			{"pending pod", s.pendingPods},
 		}
-		if !s.pods.HasSynced() {
-			err := fmt.Errorf("cache for pod informer has not synced")
-			klog.InfoS("Failed probe", "probe", name, "err", err)
-			return err
+		for _, i := range informers {
+			if i.informer != nil && !i.informer.HasSynced() {
+				err := fmt.Errorf("cache for %s informer has not synced", i.name)
+				klog.InfoS("Failed probe", "probe", name, "err", err)
+				return err
+			}
 		}
 		return nil
 	})
@@ -15,8 +15,15 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -25,10 +32,17 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	k8smetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/metrics/pkg/apis/metrics"
 
 	"sigs.k8s.io/metrics-server/pkg/scraper"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 func TestServer(t *testing.T) {
@@ -36,6 +50,407 @@ func TestServer(t *testing.T) {
 	RunSpecs(t, "Server Suite")
 }
 
+var _ = Describe("Config metrics", func() {
+	It("should expose configured resolution and scrape timeout", func() {
+		registry := k8smetrics.NewKubeRegistry()
+		Expect(RegisterConfigMetrics(registry.Register, 60*time.Second, 10*time.Second, utils.MetricsPrefix{})).To(Succeed())
+
+		err := testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP metrics_server_config_info [ALPHA] Running configuration of metrics server, value is always 1.
+		# TYPE metrics_server_config_info gauge
+		metrics_server_config_info{resolution="1m0s",scrape_timeout="10s"} 1
+		`), "metrics_server_config_info")
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("Metrics prefix", func() {
+	It("should expose storage points gauge with custom namespace and subsystem prefix", func() {
+		registry := k8smetrics.NewKubeRegistry()
+		Expect(RegisterMetrics(registry, 60*time.Second, 10*time.Second, "tenant", "team")).To(Succeed())
+		storage.NewStorage(60 * time.Second).Store(&storage.MetricsBatch{})
+
+		err := testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP tenant_team_storage_points [ALPHA] Number of metrics points stored.
+		# TYPE tenant_team_storage_points gauge
+		tenant_team_storage_points{type="container"} 0
+		tenant_team_storage_points{type="node"} 0
+		`), "tenant_team_storage_points")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should expose the same metrics in registries registered with the same prefix", func() {
+		registry := k8smetrics.NewKubeRegistry()
+		Expect(RegisterMetrics(registry, 60*time.Second, 10*time.Second, "tenant", "team")).To(Succeed())
+		otherRegistry := k8smetrics.NewKubeRegistry()
+		Expect(RegisterMetrics(otherRegistry, 60*time.Second, 10*time.Second, "tenant", "team")).To(Succeed())
+		storage.NewStorage(60 * time.Second).Store(&storage.MetricsBatch{})
+
+		for _, r := range []k8smetrics.KubeRegistry{registry, otherRegistry} {
+			err := testutil.GatherAndCompare(r, strings.NewReader(`
+			# HELP tenant_team_storage_points [ALPHA] Number of metrics points stored.
+			# TYPE tenant_team_storage_points gauge
+			tenant_team_storage_points{type="container"} 0
+			tenant_team_storage_points{type="node"} 0
+			`), "tenant_team_storage_points")
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+})
+
+var _ = Describe("Informer sync probe", func() {
+	It("should fail until caches of all informers have synced", func() {
+		nodes, pods, podStatus := &fakeController{}, &fakeController{}, &fakeController{}
+		s := NewServer(nodes, pods, nil, nil, nil, 60*time.Second)
+		s.podStatus = podStatus
+		probe := s.probeMetricCacheHasSynced("metric-informer-sync")
+
+		By("failing with unsynced node informer")
+		Expect(probe.Check(nil)).To(MatchError("cache for node informer has not synced"))
+
+		By("failing with unsynced pod informer")
+		nodes.synced = true
+		Expect(probe.Check(nil)).To(MatchError("cache for pod informer has not synced"))
+
+		By("failing with unsynced pod status informer")
+		pods.synced = true
+		Expect(probe.Check(nil)).To(MatchError("cache for pod status informer has not synced"))
+
+		By("passing once all informers have synced")
+		podStatus.synced = true
+		Expect(probe.Check(nil)).To(Succeed())
+	})
+})
+
+var _ = Describe("Pod informers", func() {
+	It("should provide pending pods only through pending pod informer", func() {
+		running := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "ns1"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+		pending := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "ns1"}, Status: corev1.PodStatus{Phase: corev1.PodPending}}
+		stopCh := make(chan struct{})
+		apiserver := httptest.NewServer(fakePodsAPIServer(stopCh, running, pending))
+		defer apiserver.Close()
+		defer close(stopCh)
+
+		By("building informers the same way as the server does")
+		metadataFactory, err := runningPodMetadataInformer(&rest.Config{Host: apiserver.URL})
+		Expect(err).NotTo(HaveOccurred())
+		metadataInformer := metadataFactory.ForResource(corev1.SchemeGroupVersion.WithResource("pods"))
+		runningFactory, err := podPhaseInformer(&rest.Config{Host: apiserver.URL}, corev1.PodRunning)
+		Expect(err).NotTo(HaveOccurred())
+		runningPods := runningFactory.Core().V1().Pods()
+		pendingFactory, err := podPhaseInformer(&rest.Config{Host: apiserver.URL}, corev1.PodPending)
+		Expect(err).NotTo(HaveOccurred())
+		pendingPods := pendingFactory.Core().V1().Pods()
+		for _, informer := range []cache.SharedIndexInformer{metadataInformer.Informer(), runningPods.Informer(), pendingPods.Informer()} {
+			go informer.Run(stopCh)
+			Expect(cache.WaitForCacheSync(stopCh, informer.HasSynced)).To(BeTrue())
+		}
+
+		By("missing pending pod in informers watching running pods")
+		_, err = metadataInformer.Lister().ByNamespace("ns1").Get("pending")
+		Expect(err).To(HaveOccurred())
+		_, err = runningPods.Lister().Pods("ns1").Get("pending")
+		Expect(err).To(HaveOccurred())
+
+		By("finding pending pod in pending pod informer")
+		pod, err := pendingPods.Lister().Pods("ns1").Get("pending")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Status.Phase).To(Equal(corev1.PodPending))
+		_, err = pendingPods.Lister().Pods("ns1").Get("running")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// fakePodsAPIServer serves pods filtered by status.phase field selector as full objects or metadata,
+// and blocks watches until stopCh is closed.
+func fakePodsAPIServer(stopCh <-chan struct{}, pods ...corev1.Pod) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/pods" {
+			http.NotFound(w, req)
+			return
+		}
+		if req.URL.Query().Get("watch") == "true" {
+			select {
+			case <-req.Context().Done():
+			case <-stopCh:
+			}
+			return
+		}
+		list := corev1.PodList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"}, ListMeta: metav1.ListMeta{ResourceVersion: "1"}}
+		metadataList := metav1.PartialObjectMetadataList{TypeMeta: metav1.TypeMeta{APIVersion: "meta.k8s.io/v1", Kind: "PartialObjectMetadataList"}, ListMeta: list.ListMeta}
+		for _, pod := range pods {
+			if selector := req.URL.Query().Get("fieldSelector"); selector != "" && selector != "status.phase="+string(pod.Status.Phase) {
+				continue
+			}
+			list.Items = append(list.Items, pod)
+			metadataList.Items = append(metadataList.Items, metav1.PartialObjectMetadata{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"}, ObjectMeta: pod.ObjectMeta})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var err error
+		if strings.Contains(req.Header.Get("Accept"), "as=PartialObjectMetadataList") {
+			err = json.NewEncoder(w).Encode(metadataList)
+		} else {
+			err = json.NewEncoder(w).Encode(list)
+		}
+		Expect(err).NotTo(HaveOccurred())
+	}
+}
+
+type fakeController struct {
+	cache.Controller
+	synced bool
+}
+
+func (c *fakeController) HasSynced() bool { return c.synced }
+
+var _ = Describe("Node ready handler", func() {
+	It("should drop stored node points when node becomes ready", func() {
+		store := storage.NewStorage(60 * time.Second)
+		start := time.Now()
+		nodePoint := func(i int) *storage.MetricsBatch {
+			return &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {StartTime: start, Timestamp: start.Add(time.Duration(i) * 10 * time.Second), CumulativeCpuUsed: uint64(i) * 1e9, MemoryUsage: 1024},
+				},
+			}
+		}
+		store.Store(nodePoint(1))
+		store.Store(nodePoint(2))
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+		Expect(store.GetNodeMetrics(node)).To(HaveLen(1))
+		notReady := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionFalse},
+			}},
+		}
+		ready := notReady.DeepCopy()
+		ready.Status.Conditions[0].Status = corev1.ConditionTrue
+		handler := nodeReadyHandler(store)
+
+		By("keeping points when node stays ready")
+		handler.OnUpdate(ready, ready)
+		Expect(store.GetNodeMetrics(node)).To(HaveLen(1))
+
+		By("dropping points on NotReady to Ready transition")
+		handler.OnUpdate(notReady, ready)
+		Expect(store.GetNodeMetrics(node)).To(BeEmpty())
+
+		By("not using points from before transition as previous point")
+		store.Store(nodePoint(3))
+		Expect(store.GetNodeMetrics(node)).To(BeEmpty())
+		store.Store(nodePoint(4))
+		Expect(store.GetNodeMetrics(node)).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("Top handler", func() {
+	It("should serve pods and nodes usage as JSON", func() {
+		store := storage.NewStorage(60 * time.Second)
+		start := time.Now().Add(-time.Hour)
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		for i := 1; i <= 2; i++ {
+			timestamp := start.Add(time.Duration(i) * 10 * time.Second)
+			store.Store(&storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {StartTime: start, Timestamp: timestamp, CumulativeCpuUsed: uint64(i) * 10e9, MemoryUsage: 1024},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					podRef: {Containers: map[string]storage.MetricsPoint{
+						"container1": {StartTime: start, Timestamp: timestamp, CumulativeCpuUsed: uint64(i) * 1e9, MemoryUsage: 1024},
+						"container2": {StartTime: start, Timestamp: timestamp, CumulativeCpuUsed: uint64(i) * 1e9, MemoryUsage: 2048},
+					}},
+				},
+			})
+		}
+		podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		Expect(podIndexer.Add(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})).To(Succeed())
+		nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		Expect(nodeIndexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})).To(Succeed())
+		s := httptest.NewServer(topHandler(store, cache.NewGenericLister(podIndexer, corev1.Resource("pods")), v1listers.NewNodeLister(nodeIndexer)))
+		defer s.Close()
+
+		By("serving pods usage")
+		var pods []topUsage
+		getJSON(s.URL+topPodsPath, &pods)
+		Expect(pods).To(HaveLen(1))
+		Expect(pods[0].Namespace).To(Equal("ns1"))
+		Expect(pods[0].Name).To(Equal("pod1"))
+		Expect(pods[0].CPU.String()).To(Equal("200m"))
+		Expect(pods[0].Memory.String()).To(Equal("3Ki"))
+
+		By("serving nodes usage")
+		var nodes []topUsage
+		getJSON(s.URL+topNodesPath, &nodes)
+		Expect(nodes).To(HaveLen(1))
+		Expect(nodes[0].Name).To(Equal("node1"))
+		Expect(nodes[0].CPU.String()).To(Equal("1"))
+		Expect(nodes[0].Memory.String()).To(Equal("1Ki"))
+
+		By("rejecting requests other than GET")
+		resp, err := http.Post(s.URL+topNodesPath, "application/json", nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
+
+func getJSON(url string, into interface{}) {
+	resp, err := http.Get(url)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	Expect(json.NewDecoder(resp.Body).Decode(into)).To(Succeed())
+}
+
+var _ = Describe("Response compression", func() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"usage":"1"}`))
+	})
+	get := func(url string, acceptEncoding string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		// Disabling transparent decompression exposes compressed body.
+		client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, body
+	}
+	It("should compress responses with the configured level", func() {
+		// Gzip header extra flags byte marks the fastest and best compression levels.
+		for level, extraFlags := range map[int]byte{gzip.BestSpeed: 4, gzip.BestCompression: 2} {
+			s := httptest.NewServer(gzipHandler(level, handler))
+			resp, body := get(s.URL, "deflate, gzip;q=0.8")
+			s.Close()
+
+			Expect(resp.Header.Get("Content-Encoding")).To(Equal("gzip"))
+			Expect(len(body)).To(BeNumerically(">", 8))
+			Expect(body[8]).To(Equal(extraFlags), "level %d", level)
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			decompressed, err := io.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(decompressed)).To(Equal(`{"usage":"1"}`))
+		}
+	})
+	It("should not compress responses for clients not accepting gzip", func() {
+		s := httptest.NewServer(gzipHandler(gzip.BestCompression, handler))
+		defer s.Close()
+
+		resp, body := get(s.URL, "")
+		Expect(resp.Header.Get("Content-Encoding")).To(BeEmpty())
+		Expect(string(body)).To(Equal(`{"usage":"1"}`))
+	})
+})
+
+var _ = Describe("Storage reset handler", func() {
+	It("should drop stored metrics on POST", func() {
+		store := storage.NewStorage(60 * time.Second)
+		start := time.Now()
+		for i := 1; i <= 2; i++ {
+			store.Store(&storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {StartTime: start, Timestamp: start.Add(time.Duration(i) * 10 * time.Second), CumulativeCpuUsed: uint64(i) * 1e9, MemoryUsage: 1024},
+				},
+			})
+		}
+		Expect(store.Ready()).To(BeTrue())
+		handler := storageResetHandler(store)
+
+		By("rejecting requests other than POST")
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, storageResetPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(store.Ready()).To(BeTrue())
+
+		By("resetting storage on POST")
+		rec = httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, storageResetPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(store.Ready()).To(BeFalse())
+		ms, err := store.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Latest points handler", func() {
+	It("should pass through the latest stored points", func() {
+		store := storage.NewStorage(60 * time.Second)
+		start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		for i := 1; i <= 2; i++ {
+			timestamp := start.Add(time.Duration(i) * 10 * time.Second)
+			store.Store(&storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {StartTime: start, Timestamp: timestamp, CumulativeCpuUsed: uint64(i) * 1e9, MemoryUsage: uint64(i) * 1024},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					podRef: {Node: "node1", Containers: map[string]storage.MetricsPoint{
+						"container1": {StartTime: start, Timestamp: timestamp, CumulativeCpuUsed: uint64(i) * 5e8, MemoryUsage: uint64(i) * 512},
+					}},
+				},
+			})
+		}
+		s := httptest.NewServer(latestPointsHandler(store))
+		defer s.Close()
+
+		var points latestPoints
+		getJSON(s.URL+latestPointsPath, &points)
+		Expect(points).To(Equal(latestPoints{
+			Nodes:      []latestPoint{{Node: "node1", StartTime: start, Timestamp: start.Add(20 * time.Second), CumulativeCpuUsed: 2e9, MemoryUsage: 2048}},
+			Containers: []latestPoint{{Node: "node1", Namespace: "ns1", Pod: "pod1", Container: "container1", StartTime: start, Timestamp: start.Add(20 * time.Second), CumulativeCpuUsed: 1e9, MemoryUsage: 1024}},
+		}))
+	})
+})
+
+var _ = Describe("Pod containers handler", func() {
+	It("should list containers with stored points and drop reasons", func() {
+		store := storage.NewStorage(60 * time.Second)
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		store.Store(&storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{},
+			Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				podRef: {Node: "node1", Containers: map[string]storage.MetricsPoint{
+					"container1": {Timestamp: time.Now(), CumulativeCpuUsed: 1e9, MemoryUsage: 1024},
+				}},
+			},
+		})
+		dropped := func(ref apitypes.NamespacedName) map[string]string {
+			Expect(ref).To(Equal(podRef))
+			return map[string]string{"container2": "missing_memory"}
+		}
+		s := httptest.NewServer(podContainersHandler(store, dropped))
+		defer s.Close()
+
+		var containers podContainers
+		getJSON(s.URL+podContainersPath+"?namespace=ns1&pod=pod1", &containers)
+		Expect(containers).To(Equal(podContainers{
+			Namespace: "ns1",
+			Pod:       "pod1",
+			Containers: []podContainer{
+				{Name: "container1", HasMetrics: true},
+				{Name: "container2", DropReason: "missing_memory"},
+			},
+		}))
+	})
+	It("should require pod query parameters", func() {
+		s := httptest.NewServer(podContainersHandler(storage.NewStorage(60*time.Second), nil))
+		defer s.Close()
+
+		resp, err := http.Get(s.URL + podContainersPath + "?namespace=ns1")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
+
 var _ = Describe("Server", func() {
 	var (
 		resolution time.Duration
@@ -90,16 +505,231 @@ var _ = Describe("Server", func() {
 		check := server.probeMetricStorageReady("")
 		Expect(check.Check(nil)).To(Succeed())
 	})
+	It("metric-collection-timely probe should not apply readiness grace period", func() {
+		server.readinessGracePeriod = time.Minute
+		server.tick(context.Background(), time.Now().Add(-2*resolution))
+		check := server.probeMetricCollectionTimely("")
+		Expect(check.Check(nil)).NotTo(Succeed())
+	})
+	It("metric-storage-ready probe should tolerate store not ready within grace period", func() {
+		server.readinessGracePeriod = time.Minute
+		check := server.probeMetricStorageReady("")
+
+		By("failing if store was never ready")
+		Expect(check.Check(nil)).NotTo(Succeed())
+
+		By("passing when store becomes ready")
+		store.ready = true
+		Expect(check.Check(nil)).To(Succeed())
+
+		By("passing when store is not ready within grace period")
+		store.ready = false
+		Expect(check.Check(nil)).To(Succeed())
+
+		By("failing when store is not ready beyond grace period")
+		server.storageNotReadySince = time.Now().Add(-2 * time.Minute)
+		Expect(check.Check(nil)).NotTo(Succeed())
+	})
 })
 
+var _ = Describe("Storage backend", func() {
+	It("should default to in-memory storage", func() {
+		Expect(Config{MetricResolution: 60 * time.Second}.newStorage()).To(BeAssignableToTypeOf(storage.NewStorage(60 * time.Second)))
+	})
+	It("should store scraped metrics in injected backend", func() {
+		backend := &fakeBackend{}
+		store := Config{MetricResolution: 60 * time.Second, Storage: backend}.newStorage()
+		Expect(store).To(BeIdenticalTo(backend))
+		batch := &storage.MetricsBatch{Nodes: map[string]storage.MetricsPoint{"node1": {Timestamp: time.Now()}}}
+		s := NewServer(nil, nil, nil, store, &scraperMock{result: batch}, 60*time.Second)
+
+		s.tick(context.Background(), time.Now())
+		Expect(backend.batches).To(Equal([]*storage.MetricsBatch{batch}))
+		Expect(s.probeMetricStorageReady("").Check(nil)).To(Succeed())
+	})
+})
+
+var _ = Describe("Sinks", func() {
+	It("should send scraped metrics to storage and sinks despite sink errors", func() {
+		backend := &fakeBackend{}
+		failing := &fakeSink{err: fmt.Errorf("remote unavailable")}
+		other := &fakeSink{}
+		batch := &storage.MetricsBatch{Nodes: map[string]storage.MetricsPoint{"node1": {Timestamp: time.Now()}}}
+		s := NewServer(nil, nil, nil, backend, &scraperMock{result: batch}, 60*time.Second)
+		s.sink = storage.MultiSink{storage.StorageSink(backend), failing, other}
+
+		s.tick(context.Background(), time.Now())
+		Expect(backend.batches).To(Equal([]*storage.MetricsBatch{batch}))
+		Expect(failing.batches).To(Equal([]*storage.MetricsBatch{batch}))
+		Expect(other.batches).To(Equal([]*storage.MetricsBatch{batch}))
+	})
+})
+
+var _ = Describe("Scrape cycle overlap", func() {
+	It("should count cycles started before the previous one completed", func() {
+		cycleOverlap.Create(nil)
+		cycleOverlap.Reset()
+		s := NewServer(nil, nil, nil, &storageMock{}, &scraperMock{result: &storage.MetricsBatch{}, delay: 150 * time.Millisecond}, 100*time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			s.runScrape(ctx)
+			close(done)
+		}()
+		Eventually(func() float64 {
+			value, err := testutil.GetCounterMetricValue(cycleOverlap.WithLabelValues())
+			Expect(err).NotTo(HaveOccurred())
+			return value
+		}, 2*time.Second, 10*time.Millisecond).Should(BeNumerically(">=", 1))
+		cancel()
+		<-done
+	})
+	It("should not count cycles completing within resolution", func() {
+		cycleOverlap.Create(nil)
+		cycleOverlap.Reset()
+		s := NewServer(nil, nil, nil, &storageMock{}, &scraperMock{result: &storage.MetricsBatch{}}, 50*time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		s.runScrape(ctx)
+		value, err := testutil.GetCounterMetricValue(cycleOverlap.WithLabelValues())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(BeZero())
+	})
+})
+
+var _ = Describe("Stale node refresh", func() {
+	It("should re-scrape stale node at most once per interval and merge its metrics into last batch", func() {
+		now := time.Now()
+		node1Pod := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		node2Pod := apitypes.NamespacedName{Name: "pod2", Namespace: "ns1"}
+		backend := &fakeBackend{}
+		s := NewServer(nil, nil, nil, backend, &scraperMock{result: &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{"node1": {Timestamp: now}, "node2": {Timestamp: now}},
+			Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				node1Pod: {Node: "node1"},
+				node2Pod: {Node: "node2"},
+			},
+		}}, 60*time.Second)
+		s.tick(context.Background(), now)
+
+		nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		Expect(nodeIndexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})).To(Succeed())
+		fresh := &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{"node1": {Timestamp: now.Add(time.Minute)}},
+			Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+		}
+		scraper := &fakeNodeScraper{result: fresh, scraped: make(chan string, 10)}
+		refresher := newNodeRefresher(scraper, v1listers.NewNodeLister(nodeIndexer), time.Minute)
+		refresher.store = s.storeNodeBatch
+
+		By("refreshing node on first stale read")
+		refresher.Refresh("node1")
+		Eventually(scraper.scraped).Should(Receive(Equal("node1")))
+		Eventually(func() int {
+			s.batchMux.Lock()
+			defer s.batchMux.Unlock()
+			return len(backend.batches)
+		}).Should(Equal(2))
+		Expect(backend.batches[1]).To(Equal(&storage.MetricsBatch{
+			Nodes:       map[string]storage.MetricsPoint{"node1": {Timestamp: now.Add(time.Minute)}, "node2": {Timestamp: now}},
+			Pods:        map[apitypes.NamespacedName]storage.PodMetricsPoint{node2Pod: {Node: "node2"}},
+			ReusedNodes: map[string]struct{}{"node2": {}},
+		}))
+
+		By("skipping repeated stale reads within interval")
+		refresher.Refresh("node1")
+		Consistently(scraper.scraped, 100*time.Millisecond).ShouldNot(Receive())
+	})
+	It("should not count points of nodes not refreshed as repeated when stored", func() {
+		registry := k8smetrics.NewKubeRegistry()
+		Expect(storage.RegisterStorageMetrics(registry.Register, utils.MetricsPrefix{})).To(Succeed())
+		now := time.Now()
+		start := now.Add(-time.Hour)
+		podRef := apitypes.NamespacedName{Name: "pod2", Namespace: "ns1"}
+		store := storage.NewStorage(60 * time.Second)
+		s := NewServer(nil, nil, nil, store, &scraperMock{result: &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{
+				"node1": {StartTime: start, Timestamp: now, CumulativeCpuUsed: 1, MemoryUsage: 1},
+				"node2": {StartTime: start, Timestamp: now, CumulativeCpuUsed: 1, MemoryUsage: 1},
+			},
+			Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				podRef: {Node: "node2", Containers: map[string]storage.MetricsPoint{
+					"container1": {StartTime: start, Timestamp: now, CumulativeCpuUsed: 1, MemoryUsage: 1},
+				}},
+			},
+		}}, 60*time.Second)
+		s.tick(context.Background(), now)
+
+		s.storeNodeBatch("node1", &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{"node1": {StartTime: start, Timestamp: now.Add(time.Minute), CumulativeCpuUsed: 2, MemoryUsage: 1}},
+			Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+		})
+
+		families, err := registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+		for _, family := range families {
+			Expect(family.GetName()).NotTo(Equal("metrics_server_repeated_point_total"))
+		}
+	})
+})
+
+// fakeNodeScraper reports scraped node names, returning the configured batch.
+type fakeNodeScraper struct {
+	result  *storage.MetricsBatch
+	scraped chan string
+}
+
+func (s *fakeNodeScraper) ScrapeNode(ctx context.Context, node *corev1.Node) (*storage.MetricsBatch, error) {
+	s.scraped <- node.Name
+	return s.result, nil
+}
+
+// fakeSink records received batches, returning the configured error.
+type fakeSink struct {
+	batches []*storage.MetricsBatch
+	err     error
+}
+
+func (s *fakeSink) Receive(batch *storage.MetricsBatch) error {
+	s.batches = append(s.batches, batch)
+	return s.err
+}
+
+// fakeBackend is an alternate storage backend, only recording stored batches.
+type fakeBackend struct {
+	batches []*storage.MetricsBatch
+}
+
+var _ storage.Storage = (*fakeBackend)(nil)
+
+func (b *fakeBackend) Store(batch *storage.MetricsBatch) {
+	b.batches = append(b.batches, batch)
+}
+
+func (b *fakeBackend) GetPodMetrics(pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
+	return nil, nil
+}
+
+func (b *fakeBackend) GetNodeMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
+	return nil, nil
+}
+
+func (b *fakeBackend) Ready() bool {
+	return len(b.batches) != 0
+}
+
 type scraperMock struct {
 	result *storage.MetricsBatch
 	err    error
+	delay  time.Duration
 }
 
 var _ scraper.Scraper = (*scraperMock)(nil)
 
 func (s *scraperMock) Scrape(ctx context.Context) *storage.MetricsBatch {
+	time.Sleep(s.delay)
 	return s.result
 }
 
@@ -0,0 +1,126 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
+)
+
+const (
+	topPodsPath  = "/top/pods"
+	topNodesPath = "/top/nodes"
+)
+
+// topUsage is a summarized usage of a pod or node, as shown by kubectl top.
+type topUsage struct {
+	Namespace string            `json:"namespace,omitempty"`
+	Name      string            `json:"name"`
+	CPU       resource.Quantity `json:"cpu"`
+	Memory    resource.Quantity `json:"memory"`
+}
+
+// topHandler serves read-only JSON views of pod and node usage. It's meant to be
+// exposed on a separate port without authentication, so it only serves GET requests.
+func topHandler(metrics api.MetricsGetter, podLister cache.GenericLister, nodeLister v1listers.NodeLister) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(topPodsPath, func(w http.ResponseWriter, req *http.Request) {
+		if !allowGet(w, req) {
+			return
+		}
+		objs, err := podLister.List(labels.Everything())
+		if err != nil {
+			klog.ErrorS(err, "Failed listing pods for top view")
+			http.Error(w, "failed listing pods", http.StatusInternalServerError)
+			return
+		}
+		pods := make([]*metav1.PartialObjectMetadata, 0, len(objs))
+		for _, obj := range objs {
+			pods = append(pods, obj.(*metav1.PartialObjectMetadata))
+		}
+		ms, err := metrics.GetPodMetrics(pods...)
+		if err != nil {
+			klog.ErrorS(err, "Failed reading pods metrics for top view")
+			http.Error(w, "failed reading pods metrics", http.StatusInternalServerError)
+			return
+		}
+		usages := make([]topUsage, 0, len(ms))
+		for _, m := range ms {
+			usage := topUsage{Namespace: m.Namespace, Name: m.Name}
+			for _, c := range m.Containers {
+				usage.CPU.Add(c.Usage[corev1.ResourceCPU])
+				usage.Memory.Add(c.Usage[corev1.ResourceMemory])
+			}
+			usages = append(usages, usage)
+		}
+		writeTopUsages(w, usages)
+	})
+	mux.HandleFunc(topNodesPath, func(w http.ResponseWriter, req *http.Request) {
+		if !allowGet(w, req) {
+			return
+		}
+		nodes, err := nodeLister.List(labels.Everything())
+		if err != nil {
+			klog.ErrorS(err, "Failed listing nodes for top view")
+			http.Error(w, "failed listing nodes", http.StatusInternalServerError)
+			return
+		}
+		ms, err := metrics.GetNodeMetrics(nodes...)
+		if err != nil {
+			klog.ErrorS(err, "Failed reading nodes metrics for top view")
+			http.Error(w, "failed reading nodes metrics", http.StatusInternalServerError)
+			return
+		}
+		usages := make([]topUsage, 0, len(ms))
+		for _, m := range ms {
+			usages = append(usages, topUsage{Name: m.Name, CPU: m.Usage[corev1.ResourceCPU], Memory: m.Usage[corev1.ResourceMemory]})
+		}
+		writeTopUsages(w, usages)
+	})
+	return mux
+}
+
+func allowGet(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeTopUsages(w http.ResponseWriter, usages []topUsage) {
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Namespace != usages[j].Namespace {
+			return usages[i].Namespace < usages[j].Namespace
+		}
+		return usages[i].Name < usages[j].Name
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(usages); err != nil {
+		klog.ErrorS(err, "Failed writing top view")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// cpuEWMA is an exponentially weighted moving average of CPU usage rate.
+type cpuEWMA struct {
+	// rate is the smoothed usage. Unit: nano cores.
+	rate float64
+	// timestamp is the timestamp of the last point included in the average.
+	timestamp time.Time
+	// start is the timestamp of the first point included in the average.
+	start time.Time
+}
+
+type containerRef struct {
+	pod       apitypes.NamespacedName
+	container string
+}
+
+// updateCpuEWMA includes usage rate between prev and last in the average. State is dropped if rate
+// cannot be calculated, e.g. due to restart, so average is not affected by usage before it.
+func updateCpuEWMA(state cpuEWMA, found bool, alpha float64, last, prev MetricsPoint) (cpuEWMA, bool) {
+	usage, ti, err := resourceUsage(last, prev)
+	if err != nil {
+		return cpuEWMA{}, false
+	}
+	if found && state.timestamp.Equal(ti.Timestamp) {
+		return state, true
+	}
+	rate := float64(usage.Cpu().ScaledValue(resource.Nano))
+	if !found || !state.timestamp.Equal(prev.Timestamp) {
+		return cpuEWMA{rate: rate, timestamp: ti.Timestamp, start: prev.Timestamp}, true
+	}
+	return cpuEWMA{
+		rate:      alpha*rate + (1-alpha)*state.rate,
+		timestamp: ti.Timestamp,
+		start:     state.start,
+	}, true
+}
+
+// window returns effective lookback of the average, which is the raw window
+// scaled by 1/alpha and limited by the time the average was collected for.
+func (e cpuEWMA) window(alpha float64, raw time.Duration) time.Duration {
+	return min(time.Duration(float64(raw)/alpha), e.timestamp.Sub(e.start))
+}
+
+// updateCpuEWMA updates smoothed CPU usage of stored nodes and containers.
+func (s *storage) updateCpuEWMA() {
+	nodeStates := make(map[string]cpuEWMA, len(s.nodes.last))
+	for name, last := range s.nodes.last {
+		prev, found := s.nodes.prev[name]
+		if !found {
+			continue
+		}
+		state, found := s.nodeCpuEWMA[name]
+		if state, ok := updateCpuEWMA(state, found, s.cpuEWMAAlpha, last, prev); ok {
+			nodeStates[name] = state
+		}
+	}
+	s.nodeCpuEWMA = nodeStates
+
+	containerStates := make(map[containerRef]cpuEWMA, len(s.containerCpuEWMA))
+	for podRef, lastPod := range s.pods.last {
+		prevPod, found := s.pods.prev[podRef]
+		if !found {
+			continue
+		}
+		for container, last := range lastPod.Containers {
+			prev, found := prevPod.Containers[container]
+			if !found {
+				continue
+			}
+			ref := containerRef{pod: podRef, container: container}
+			state, found := s.containerCpuEWMA[ref]
+			if state, ok := updateCpuEWMA(state, found, s.cpuEWMAAlpha, last, prev); ok {
+				containerStates[ref] = state
+			}
+		}
+	}
+	s.containerCpuEWMA = containerStates
+}
+
+// applyNodeCpuEWMA replaces node CPU usage with the smoothed one.
+func (s *storage) applyNodeCpuEWMA(m *metrics.NodeMetrics) {
+	state, found := s.nodeCpuEWMA[m.Name]
+	if !found {
+		return
+	}
+	m.Usage[corev1.ResourceCPU] = uint64Quantity(uint64(state.rate), resource.DecimalSI, -9)
+	m.Window.Duration = state.window(s.cpuEWMAAlpha, m.Window.Duration)
+}
+
+// applyPodCpuEWMA replaces containers CPU usage with the smoothed one. Pod window is
+// the longest effective lookback of its containers.
+func (s *storage) applyPodCpuEWMA(m *metrics.PodMetrics) {
+	podRef := apitypes.NamespacedName{Name: m.Name, Namespace: m.Namespace}
+	raw := m.Window.Duration
+	for i, c := range m.Containers {
+		state, found := s.containerCpuEWMA[containerRef{pod: podRef, container: c.Name}]
+		if !found {
+			continue
+		}
+		m.Containers[i].Usage[corev1.ResourceCPU] = uint64Quantity(uint64(state.rate), resource.DecimalSI, -9)
+		if window := state.window(s.cpuEWMAAlpha, raw); window > m.Window.Duration {
+			m.Window.Duration = window
+		}
+	}
+}
@@ -16,22 +16,112 @@ package storage
 
 import (
 	"k8s.io/component-base/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 var (
+	// definedPrefix is the prefix metrics were last defined with.
+	definedPrefix   utils.MetricsPrefix
+	pointsStored    *metrics.GaugeVec
+	nodePodSumDiff  *metrics.GaugeVec
+	podsWithMetrics *metrics.GaugeVec
+	repeatedPoints  *metrics.CounterVec
+	evictedPods     *metrics.Counter
+	negativeWindows *metrics.CounterVec
+	prevWithoutLast *metrics.CounterVec
+)
+
+func init() {
+	defineMetrics(utils.MetricsPrefix{})
+}
+
+// defineMetrics defines metrics of the package with names prefixed with prefix.
+func defineMetrics(prefix utils.MetricsPrefix) {
+	definedPrefix = prefix
 	pointsStored = metrics.NewGaugeVec(
 		&metrics.GaugeOpts{
-			Namespace: "metrics_server",
-			Subsystem: "storage",
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("storage"),
 			Name:      "points",
 			Help:      "Number of metrics points stored.",
 		},
 		[]string{"type"},
 	)
-)
+	nodePodSumDiff = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "node_pod_sum_diff",
+			Help:      "Difference between node usage and the sum of usage of pods on the node. CPU in cores, memory in bytes.",
+		},
+		[]string{"node", "resource"},
+	)
+	podsWithMetrics = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "pods_with_metrics",
+			Help:      "Number of pods with metrics that can be served, per namespace.",
+		},
+		[]string{"namespace"},
+	)
+	repeatedPoints = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "repeated_point_total",
+			Help:      "Number of metrics points with the same timestamp as the stored ones, which can indicate a frozen Kubelet.",
+		},
+		[]string{"node"},
+	)
+	evictedPods = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "evicted_pods_total",
+			Help:      "Number of pods whose metrics points were evicted, as they were not read.",
+		},
+	)
+	negativeWindows = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem(""),
+			Name:      "negative_window_total",
+			Help:      "Number of reads finding previous metrics point newer than the last one, whose usage was not served.",
+		},
+		[]string{"type"},
+	)
+	prevWithoutLast = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: prefix.Namespace(),
+			Subsystem: prefix.Subsystem("storage"),
+			Name:      "prev_without_last_total",
+			Help:      "Number of reads finding previous metrics point without the last one, which indicates inconsistent storage state.",
+		},
+		[]string{"type"},
+	)
+}
 
-// RegisterStorageMetrics registers a gauge metric for the number of metrics
-// points stored.
-func RegisterStorageMetrics(registrationFunc func(metrics.Registerable) error) error {
-	return registrationFunc(pointsStored)
+// RegisterStorageMetrics registers metrics for the number of metrics points
+// and pods stored, repeated metrics points, evicted pods, inconsistent reads, negative windows and the node and pods usage difference.
+func RegisterStorageMetrics(registrationFunc func(metrics.Registerable) error, prefix utils.MetricsPrefix) error {
+	if prefix != definedPrefix {
+		defineMetrics(prefix)
+	}
+	for _, metric := range []metrics.Registerable{
+		pointsStored,
+		nodePodSumDiff,
+		podsWithMetrics,
+		repeatedPoints,
+		evictedPods,
+		prevWithoutLast,
+		negativeWindows,
+	} {
+		err := registrationFunc(metric)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
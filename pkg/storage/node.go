@@ -22,6 +22,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 	"k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
 )
 
 // nodeStorage stores last two node metric batches and calculates cpu & memory usage
@@ -35,18 +37,31 @@ type nodeStorage struct {
 	// prev stores node metric points from scrape preceding the last one.
 	// Points timestamp should proceed the corresponding points from last.
 	prev map[string]MetricsPoint
+	// policy governs when start time is used as previous point of nodes seen for the first time.
+	policy WarmupPolicy
 }
 
 func (s *nodeStorage) GetMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
 	results := make([]metrics.NodeMetrics, 0, len(nodes))
 	for _, node := range nodes {
-		last, found := s.last[node.Name]
-		if !found {
+		last, lastFound := s.last[node.Name]
+		prev, prevFound := s.prev[node.Name]
+		if !lastFound {
+			if prevFound {
+				// Store never keeps previous point without the last one.
+				prevWithoutLast.WithLabelValues("node").Inc()
+			}
 			continue
 		}
-
-		prev, found := s.prev[node.Name]
-		if !found {
+		if !prevFound {
+			if last.CpuUsage == 0 {
+				// Unlike fresh containers, nodes are only served after two scrapes unless warmup policy requires a single one.
+				continue
+			}
+			// Node reporting CPU usage as gauge is served after a single scrape, with zero window.
+			prev = last
+		}
+		if negativeWindow(last, prev, "node") {
 			continue
 		}
 		rl, ti, err := resourceUsage(last, prev)
@@ -54,10 +69,15 @@ func (s *nodeStorage) GetMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics,
 			klog.ErrorS(err, "Skipping node usage metric", "node", node)
 			continue
 		}
+		var annotations map[string]string
+		if last.MemoryApproximate {
+			annotations = map[string]string{api.AnnotationApproximateMemory: "true"}
+		}
 		results = append(results, metrics.NodeMetrics{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:              node.Name,
 				Labels:            node.Labels,
+				Annotations:       annotations,
 				CreationTimestamp: metav1.NewTime(time.Now()),
 			},
 			Timestamp: metav1.NewTime(ti.Timestamp),
@@ -78,7 +98,15 @@ func (s *nodeStorage) Store(batch *MetricsBatch) {
 		}
 		lastNodes[nodeName] = newPoint
 
-		if lastNode, found := s.last[nodeName]; found {
+		lastNode, found := s.last[nodeName]
+		if !found && s.policy.singleSample() && s.policy.startTimeUsable(newPoint) {
+			// Cumulative CPU usage is zero at start time, allowing to calculate usage from a single point.
+			prevNodes[nodeName] = startTimePoint(newPoint)
+		}
+		if found {
+			if newPoint.Timestamp.Equal(lastNode.Timestamp) && !batch.Reused(nodeName) {
+				repeatedPoints.WithLabelValues(nodeName).Inc()
+			}
 			// If new point is different then one already stored
 			if newPoint.Timestamp.After(lastNode.Timestamp) {
 				// Move stored point to previous
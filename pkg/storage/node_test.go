@@ -25,6 +25,8 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/component-base/metrics/testutil"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
 )
 
 var _ = Describe("Node storage", func() {
@@ -208,7 +210,128 @@ var _ = Describe("Node storage", func() {
 			},
 		))
 	})
+	It("should use start time to return metric in one cycle with single cycle warmup", func() {
+		s := NewStorage(60*time.Second, WithWarmupPolicy(WarmupPolicy{MinStartTimeAge: 10 * time.Second, StartTimeWindows: true, RequiredSamples: 1}))
+		nodeStart := time.Now()
+
+		By("storing first batch with node1 metrics")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(200*time.Second), 100*CoreSecond, 2*MiByte)}))
+
+		By("becoming ready and returning metric for node1 averaged since start")
+		Expect(s.Ready()).To(BeTrue())
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Timestamp.Time).Should(BeEquivalentTo(nodeStart.Add(200 * time.Second)))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(200 * time.Second))
+		Expect(ms[0].Usage).Should(BeEquivalentTo(
+			corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(CoreSecond/2, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(2*MiByte, resource.BinarySI),
+			},
+		))
+
+		By("using window between scrapes once second batch is stored")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(210*time.Second), 110*CoreSecond, 2*MiByte)}))
+		ms, err = s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(10 * time.Second))
+	})
+	It("should serve node reporting CPU usage as gauge after a single scrape", func() {
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+		point := newMetricsPoint(nodeStart, nodeStart.Add(200*time.Second), 0, 2*MiByte)
+		point.CpuUsage = CoreSecond / 2
+
+		By("storing first batch with node1 metrics")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", point}))
+
+		By("becoming ready and returning reported usage with zero window")
+		Expect(s.Ready()).To(BeTrue())
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(0))
+		Expect(ms[0].Usage).Should(BeEquivalentTo(
+			corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(CoreSecond/2, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(2*MiByte, resource.BinarySI),
+			},
+		))
+
+		By("returning reported usage with window between scrapes once second batch is stored")
+		point.Timestamp = nodeStart.Add(210 * time.Second)
+		point.CpuUsage = CoreSecond
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", point}))
+		ms, err = s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(10 * time.Second))
+		Expect(ms[0].Usage.Cpu().Equal(*resource.NewScaledQuantity(CoreSecond, -9))).To(BeTrue())
+	})
+	It("should annotate node with approximate memory usage", func() {
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+		approximate := newMetricsPoint(nodeStart, nodeStart.Add(210*time.Second), 110*CoreSecond, 2*MiByte)
+		approximate.MemoryApproximate = true
+
+		By("storing batches with node1 memory approximated in the last one")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(200*time.Second), 100*CoreSecond, 2*MiByte)}))
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", approximate}))
 
+		By("returning metrics annotated as approximate")
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{api.AnnotationApproximateMemory: "true"}))
+	})
+	It("should return empty for node with only last point", func() {
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+		s.nodes.last = map[string]MetricsPoint{
+			"node1": newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 10*CoreSecond, 2*MiByte),
+		}
+
+		checkNodeResponseEmpty(s, "node1")
+	})
+	It("should return empty and meter node with negative window", func() {
+		negativeWindows.Create(nil)
+		negativeWindows.Reset()
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+		s.nodes.prev = map[string]MetricsPoint{
+			"node1": newMetricsPoint(nodeStart, nodeStart.Add(30*time.Second), 10*CoreSecond, 2*MiByte),
+		}
+		s.nodes.last = map[string]MetricsPoint{
+			"node1": newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 13*CoreSecond, 3*MiByte),
+		}
+
+		checkNodeResponseEmpty(s, "node1")
+		err := testutil.CollectAndCompare(negativeWindows, strings.NewReader(`
+		# HELP metrics_server_negative_window_total [ALPHA] Number of reads finding previous metrics point newer than the last one, whose usage was not served.
+		# TYPE metrics_server_negative_window_total counter
+		metrics_server_negative_window_total{type="node"} 1
+		`), "metrics_server_negative_window_total")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should return empty and meter node with only prev point", func() {
+		prevWithoutLast.Create(nil)
+		prevWithoutLast.Reset()
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+		s.nodes.prev = map[string]MetricsPoint{
+			"node1": newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 10*CoreSecond, 2*MiByte),
+		}
+
+		checkNodeResponseEmpty(s, "node1")
+		err := testutil.CollectAndCompare(prevWithoutLast, strings.NewReader(`
+		# HELP metrics_server_storage_prev_without_last_total [ALPHA] Number of reads finding previous metrics point without the last one, which indicates inconsistent storage state.
+		# TYPE metrics_server_storage_prev_without_last_total counter
+		metrics_server_storage_prev_without_last_total{type="node"} 1
+		`), "metrics_server_storage_prev_without_last_total")
+		Expect(err).NotTo(HaveOccurred())
+	})
 })
 
 func checkNodeResponseEmpty(s *storage, names ...string) {
@@ -16,8 +16,11 @@
 package storage
 
 import (
+	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
@@ -26,10 +29,6 @@ import (
 	"sigs.k8s.io/metrics-server/pkg/api"
 )
 
-// fresh new container's minimum allowable time duration between start time and timestamp.
-// if time duration less than 10s, can produce inaccurate data
-const freshContainerMinMetricsResolution = 10 * time.Second
-
 // podStorage stores last two pod metric batches and calculates cpu & memory usage.
 //
 // This implementation only stores metric points if they are newer than the
@@ -43,18 +42,76 @@ type podStorage struct {
 	prev map[apitypes.NamespacedName]PodMetricsPoint
 	// scrape period of metrics server
 	metricResolution time.Duration
+	// defaultWindow is the window reported for fresh containers, zero means time since container start.
+	defaultWindow time.Duration
+	// policy governs when start time is used as previous point of containers.
+	policy WarmupPolicy
+	// evictionTTL is the time after which pods not read are dropped, zero disables eviction.
+	evictionTTL time.Duration
+	// now returns current time, defaults to time.Now
+	now func() time.Time
+
+	// accessMu protects accessed and evicted, as they are updated when serving metrics under read lock
+	accessMu sync.Mutex
+	// accessed stores the time pods were last read or first stored, only tracked when eviction is enabled
+	accessed map[apitypes.NamespacedName]time.Time
+	// evicted stores pods dropped by eviction, which are not stored again until read
+	evicted map[apitypes.NamespacedName]struct{}
+}
+
+func (s *podStorage) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// markAccessed records the pod as read or first stored, keeping it from being evicted.
+func (s *podStorage) markAccessed(podRef apitypes.NamespacedName) {
+	if s.evictionTTL == 0 {
+		return
+	}
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+	if s.accessed == nil {
+		s.accessed = make(map[apitypes.NamespacedName]time.Time)
+	}
+	s.accessed[podRef] = s.clock()
+	delete(s.evicted, podRef)
+}
+
+// isEvicted returns true if the pod was evicted and was not read since.
+func (s *podStorage) isEvicted(podRef apitypes.NamespacedName) bool {
+	if s.evictionTTL == 0 {
+		return false
+	}
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+	_, found := s.evicted[podRef]
+	return found
+}
+
+// hasContainer returns true if the last stored batch has point of the container.
+func (s *podStorage) hasContainer(podRef apitypes.NamespacedName, containerName string) bool {
+	_, found := s.last[podRef].Containers[containerName]
+	return found
 }
 
 func (s *podStorage) GetMetrics(pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
 	results := make([]metrics.PodMetrics, 0, len(pods))
 	for _, pod := range pods {
-		lastPod, found := s.last[apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}]
-		if !found {
+		lastPod, lastFound := s.last[apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}]
+		prevPod, prevFound := s.prev[apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}]
+		if !lastFound {
+			if prevFound {
+				// Store never keeps previous points without the last ones.
+				prevWithoutLast.WithLabelValues("pod").Inc()
+			}
+			// Evicted pod is stored again by the next Store, as it's read.
+			s.markAccessed(apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace})
 			continue
 		}
-
-		prevPod, found := s.prev[apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}]
-		if !found {
+		if !prevFound && len(lastPod.Containers) == 0 {
 			continue
 		}
 
@@ -66,6 +123,12 @@ func (s *podStorage) GetMetrics(pods ...*metav1.PartialObjectMetadata) ([]metric
 		for container, lastContainer := range lastPod.Containers {
 			prevContainer, found := prevPod.Containers[container]
 			if !found {
+				// Container that started within metric resolution is served with window since its start.
+				if found = s.policy.freshStartTime(lastContainer, s.metricResolution); found {
+					prevContainer = startTimePoint(lastContainer)
+				}
+			}
+			if !found || negativeWindow(lastContainer, prevContainer, "pod") {
 				allContainersPresent = false
 				break
 			}
@@ -82,7 +145,11 @@ func (s *podStorage) GetMetrics(pods ...*metav1.PartialObjectMetadata) ([]metric
 				earliestTimeInfo = ti
 			}
 		}
+		if overhead, found := podOverhead(lastPod, prevPod, cms); found && allContainersPresent {
+			cms = append(cms, metrics.ContainerMetrics{Name: PodOverheadContainer, Usage: overhead})
+		}
 		if allContainersPresent {
+			s.markAccessed(apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace})
 			results = append(results, metrics.PodMetrics{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:              pod.Name,
@@ -99,6 +166,44 @@ func (s *podStorage) GetMetrics(pods ...*metav1.PartialObjectMetadata) ([]metric
 	return results, nil
 }
 
+// PodOverheadContainer is the name of the pseudo container serving pod usage not attributed to its containers,
+// when pod-level usage is reported by Kubelet. Upper case is not valid in container names, so it can't collide.
+const PodOverheadContainer = "POD"
+
+// podOverhead returns pod-level usage of the pod minus the usage of its containers, if pod-level usage
+// was reported. Usage of containers is served when pod-level usage is missing, e.g. after pod restart.
+func podOverhead(last, prev PodMetricsPoint, containers []metrics.ContainerMetrics) (corev1.ResourceList, bool) {
+	var cpu, memory int64
+	cpuFound := last.CumulativeCpuUsed != 0 && prev.CumulativeCpuUsed != 0 && prev.Timestamp.Before(last.Timestamp)
+	if cpuFound {
+		podUsage, _, err := resourceUsage(
+			MetricsPoint{Timestamp: last.Timestamp, CumulativeCpuUsed: last.CumulativeCpuUsed},
+			MetricsPoint{Timestamp: prev.Timestamp, CumulativeCpuUsed: prev.CumulativeCpuUsed},
+		)
+		cpuFound = err == nil
+		cpu = podUsage.Cpu().ScaledValue(resource.Nano)
+	}
+	memoryFound := last.MemoryUsage != 0
+	if memoryFound {
+		memory = int64(last.MemoryUsage)
+	}
+	if !cpuFound && !memoryFound {
+		return nil, false
+	}
+	for _, c := range containers {
+		if cpuFound {
+			cpu -= c.Usage.Cpu().ScaledValue(resource.Nano)
+		}
+		if memoryFound {
+			memory -= c.Usage.Memory().Value()
+		}
+	}
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    uint64Quantity(uint64(max(cpu, 0)), resource.DecimalSI, -9),
+		corev1.ResourceMemory: uint64Quantity(uint64(max(memory, 0)), resource.BinarySI, 0),
+	}, true
+}
+
 func (s *podStorage) Store(newPods *MetricsBatch) {
 	lastPods := make(map[apitypes.NamespacedName]PodMetricsPoint, len(newPods.Pods))
 	prevPods := make(map[apitypes.NamespacedName]PodMetricsPoint, len(newPods.Pods))
@@ -110,22 +215,48 @@ func (s *podStorage) Store(newPods *MetricsBatch) {
 			continue
 		}
 
-		newLastPod := PodMetricsPoint{Containers: make(map[string]MetricsPoint, len(newPod.Containers))}
-		newPrevPod := PodMetricsPoint{Containers: make(map[string]MetricsPoint, len(newPod.Containers))}
+		if s.isEvicted(podRef) {
+			continue
+		}
+		if _, found := s.last[podRef]; !found {
+			s.markAccessed(podRef)
+		}
+		newLastPod := PodMetricsPoint{
+			Node:              newPod.Node,
+			Containers:        make(map[string]MetricsPoint, len(newPod.Containers)),
+			CumulativeCpuUsed: newPod.CumulativeCpuUsed,
+			Timestamp:         newPod.Timestamp,
+			MemoryUsage:       newPod.MemoryUsage,
+		}
+		newPrevPod := PodMetricsPoint{Node: newPod.Node, Containers: make(map[string]MetricsPoint, len(newPod.Containers))}
+		if newPod.CumulativeCpuUsed != 0 {
+			// Keep previous pod-level point, like previous container points.
+			if lastPod, found := s.last[podRef]; found && lastPod.CumulativeCpuUsed != 0 && newPod.Timestamp.After(lastPod.Timestamp) {
+				newPrevPod.CumulativeCpuUsed, newPrevPod.Timestamp = lastPod.CumulativeCpuUsed, lastPod.Timestamp
+			} else if prevPod, found := s.prev[podRef]; found && prevPod.CumulativeCpuUsed != 0 && prevPod.Timestamp.Before(newPod.Timestamp) {
+				newPrevPod.CumulativeCpuUsed, newPrevPod.Timestamp = prevPod.CumulativeCpuUsed, prevPod.Timestamp
+			}
+		}
 		for containerName, newPoint := range newPod.Containers {
 			if _, exists := newLastPod.Containers[containerName]; exists {
 				klog.ErrorS(nil, "Got duplicate Container point", "container", containerName, "pod", klog.KRef(podRef.Namespace, podRef.Name))
 				continue
 			}
 			newLastPod.Containers[containerName] = newPoint
-			if newPoint.StartTime.Before(newPoint.Timestamp) && newPoint.Timestamp.Sub(newPoint.StartTime) < s.metricResolution && newPoint.Timestamp.Sub(newPoint.StartTime) >= freshContainerMinMetricsResolution {
-				copied := newPoint
-				copied.Timestamp = newPoint.StartTime
-				copied.CumulativeCpuUsed = 0
+			if s.policy.freshStartTime(newPoint, s.metricResolution) || s.policy.singleSample() && s.policy.startTimeUsable(newPoint) && !s.hasContainer(podRef, containerName) {
+				copied := startTimePoint(newPoint)
+				if age := newPoint.Timestamp.Sub(newPoint.StartTime); s.defaultWindow > 0 && s.defaultWindow < age {
+					// Interpolate previous point to report default window, preserving usage rate since container start.
+					copied.Timestamp = newPoint.Timestamp.Add(-s.defaultWindow)
+					copied.CumulativeCpuUsed = newPoint.CumulativeCpuUsed - uint64(float64(newPoint.CumulativeCpuUsed)*float64(s.defaultWindow)/float64(age))
+				}
 				newPrevPod.Containers[containerName] = copied
 			} else if lastPod, found := s.last[podRef]; found {
 				// Keep previous metric point if newPoint has not restarted (new metric start time < stored timestamp)
 				if lastContainer, found := lastPod.Containers[containerName]; found && newPoint.StartTime.Before(lastContainer.Timestamp) {
+					if newPoint.Timestamp.Equal(lastContainer.Timestamp) && !newPods.Reused(newPod.Node) {
+						repeatedPoints.WithLabelValues(newPod.Node).Inc()
+					}
 					// If new point is different then one already stored
 					if newPoint.Timestamp.After(lastContainer.Timestamp) {
 						// Move stored point to previous
@@ -154,8 +285,56 @@ func (s *podStorage) Store(newPods *MetricsBatch) {
 		// Only count containers for which metrics can be returned.
 		containerCount += containerPoints
 	}
+	containerCount -= s.evict(newPods.Pods, lastPods, prevPods)
 	s.last = lastPods
 	s.prev = prevPods
 
 	pointsStored.WithLabelValues("container").Set(float64(containerCount))
+
+	// Only count pods for which metrics can be returned.
+	namespacePods := make(map[string]int)
+	for podRef := range prevPods {
+		namespacePods[podRef.Namespace]++
+	}
+	podsWithMetrics.Reset()
+	for namespace, count := range namespacePods {
+		podsWithMetrics.WithLabelValues(namespace).Set(float64(count))
+	}
+}
+
+// evict drops pods not read within evictionTTL, returning number of dropped container points.
+// Evicted pods are remembered while they are present in stored batches.
+func (s *podStorage) evict(newPods, lastPods, prevPods map[apitypes.NamespacedName]PodMetricsPoint) int {
+	if s.evictionTTL == 0 {
+		return 0
+	}
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+	now := s.clock()
+	var droppedContainers int
+	for podRef := range lastPods {
+		if now.Sub(s.accessed[podRef]) <= s.evictionTTL {
+			continue
+		}
+		klog.V(2).InfoS("Evicting metrics of pod not read", "pod", klog.KRef(podRef.Namespace, podRef.Name), "ttl", s.evictionTTL)
+		droppedContainers += len(prevPods[podRef].Containers)
+		delete(lastPods, podRef)
+		delete(prevPods, podRef)
+		if s.evicted == nil {
+			s.evicted = make(map[apitypes.NamespacedName]struct{})
+		}
+		s.evicted[podRef] = struct{}{}
+		evictedPods.Inc()
+	}
+	for podRef := range s.accessed {
+		if _, found := lastPods[podRef]; !found {
+			delete(s.accessed, podRef)
+		}
+	}
+	for podRef := range s.evicted {
+		if _, found := newPods[podRef]; !found {
+			delete(s.evicted, podRef)
+		}
+	}
+	return droppedContainers
 }
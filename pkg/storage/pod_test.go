@@ -69,6 +69,64 @@ var _ = Describe("Pod storage", func() {
 		checkPodResponseEmpty(s, podRef)
 
 	})
+	It("serves pod overhead from pod-level usage", func() {
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		withPodCpu := func(pod podMetricsPoint, ts time.Time, cpu uint64) podMetricsPoint {
+			pod.CumulativeCpuUsed = cpu
+			pod.Timestamp = ts
+			return pod
+		}
+
+		By("storing two batches with pod-level cpu usage higher than usage of containers")
+		s.Store(podMetricsBatch(withPodCpu(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 1*CoreSecond, 4*MiByte)}), containerStart.Add(120*time.Second), 2*CoreSecond)))
+		s.Store(podMetricsBatch(withPodCpu(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(125*time.Second), 6*CoreSecond, 5*MiByte)}), containerStart.Add(125*time.Second), 9*CoreSecond)))
+
+		By("returning difference as usage of pod overhead")
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Containers).Should(BeEquivalentTo([]metrics.ContainerMetrics{
+			{
+				Name: "container1",
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewScaledQuantity(1*CoreSecond, -9),
+					corev1.ResourceMemory: *resource.NewQuantity(5*MiByte, resource.BinarySI),
+				},
+			},
+			{
+				Name: PodOverheadContainer,
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewScaledQuantity(CoreSecond*2/5, -9),
+					corev1.ResourceMemory: *resource.NewQuantity(0, resource.BinarySI),
+				},
+			},
+		}))
+
+		By("returning difference of pod-level memory usage as usage of pod overhead")
+		s.Store(podMetricsBatch(podMetricsPoint{NamespacedName: podRef, PodMetricsPoint: PodMetricsPoint{
+			Containers:  map[string]MetricsPoint{"container1": newMetricsPoint(containerStart, containerStart.Add(130*time.Second), 11*CoreSecond, 5*MiByte)},
+			MemoryUsage: 7 * MiByte,
+		}}))
+		ms, err = s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Containers).To(ContainElement(metrics.ContainerMetrics{
+			Name: PodOverheadContainer,
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(0, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(2*MiByte, resource.BinarySI),
+			},
+		}))
+
+		By("falling back to usage of containers without pod-level usage")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(135*time.Second), 16*CoreSecond, 5*MiByte)})))
+		ms, err = s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Containers).To(HaveLen(1))
+	})
 	It("returns timestamp of earliest container of pod", func() {
 		s := NewStorage(60 * time.Second)
 		containerStart := time.Now()
@@ -109,6 +167,36 @@ var _ = Describe("Pod storage", func() {
 		Expect(s.Ready()).NotTo(BeTrue())
 		checkPodResponseEmpty(s, podRef)
 	})
+	It("distinguishes pods with the same name in different namespaces", func() {
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		pod1 := apitypes.NamespacedName{Name: "pod", Namespace: "ns1"}
+		pod2 := apitypes.NamespacedName{Name: "pod", Namespace: "ns2"}
+
+		By("storing two batches with same-named pods")
+		s.Store(podMetricsBatch(
+			podMetrics(pod1, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(110*time.Second), 1*CoreSecond, 4*MiByte)}),
+			podMetrics(pod2, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(110*time.Second), 1*CoreSecond, 8*MiByte)}),
+		))
+		s.Store(podMetricsBatch(
+			podMetrics(pod1, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 2*CoreSecond, 4*MiByte)}),
+			podMetrics(pod2, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 3*CoreSecond, 8*MiByte)}),
+		))
+		Expect(s.pods.last).To(HaveLen(2))
+		Expect(s.pods.prev).To(HaveLen(2))
+
+		By("returning metrics of both pods")
+		ms, err := s.GetPodMetrics(
+			&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: pod1.Name, Namespace: pod1.Namespace}},
+			&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: pod2.Name, Namespace: pod2.Namespace}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(2))
+		Expect(ms[0].Namespace).To(Equal("ns1"))
+		Expect(ms[0].Containers[0].Usage).To(HaveKeyWithValue(corev1.ResourceMemory, *resource.NewQuantity(4*MiByte, resource.BinarySI)))
+		Expect(ms[1].Namespace).To(Equal("ns2"))
+		Expect(ms[1].Containers[0].Usage).To(HaveKeyWithValue(corev1.ResourceMemory, *resource.NewQuantity(8*MiByte, resource.BinarySI)))
+	})
 	It("exposes correct pod metrics", func() {
 		pointsStored.Create(nil)
 		pointsStored.Reset()
@@ -148,6 +236,41 @@ var _ = Describe("Pod storage", func() {
 		`), "metrics_server_storage_points")
 		Expect(err).NotTo(HaveOccurred())
 	})
+	It("exposes number of pods with metrics per namespace", func() {
+		podsWithMetrics.Create(nil)
+		podsWithMetrics.Reset()
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		pod1 := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		pod2 := apitypes.NamespacedName{Name: "pod2", Namespace: "ns1"}
+		pod3 := apitypes.NamespacedName{Name: "pod3", Namespace: "ns2"}
+
+		By("store first batch")
+		s.Store(podMetricsBatch(
+			podMetrics(pod1, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(110*time.Second), 1*CoreSecond, 4*MiByte)}),
+			podMetrics(pod2, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(110*time.Second), 1*CoreSecond, 4*MiByte)}),
+			podMetrics(pod3, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(110*time.Second), 1*CoreSecond, 4*MiByte)}),
+		))
+
+		err := testutil.CollectAndCompare(podsWithMetrics, strings.NewReader(`
+		`), "metrics_server_pods_with_metrics")
+		Expect(err.Error()).To(Equal("expected metric name(s) not found: [metrics_server_pods_with_metrics]"))
+
+		By("store second batch")
+		s.Store(podMetricsBatch(
+			podMetrics(pod1, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 2*CoreSecond, 4*MiByte)}),
+			podMetrics(pod2, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 2*CoreSecond, 4*MiByte)}),
+			podMetrics(pod3, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 2*CoreSecond, 4*MiByte)}),
+		))
+
+		err = testutil.CollectAndCompare(podsWithMetrics, strings.NewReader(`
+		# HELP metrics_server_pods_with_metrics [ALPHA] Number of pods with metrics that can be served, per namespace.
+		# TYPE metrics_server_pods_with_metrics gauge
+		metrics_server_pods_with_metrics{namespace="ns1"} 2
+		metrics_server_pods_with_metrics{namespace="ns2"} 1
+		`), "metrics_server_pods_with_metrics")
+		Expect(err).NotTo(HaveOccurred())
+	})
 	It("should detect container restart and return results based on window from start time", func() {
 		s := NewStorage(60 * time.Second)
 		containerStart := time.Now()
@@ -245,6 +368,35 @@ var _ = Describe("Pod storage", func() {
 		Expect(s.Ready()).NotTo(BeTrue())
 		checkPodResponseEmpty(s, podRef)
 	})
+	It("should use start time to return metric in one cycle for long running container with single cycle warmup", func() {
+		s := NewStorage(60*time.Second, WithWarmupPolicy(WarmupPolicy{MinStartTimeAge: 10 * time.Second, StartTimeWindows: true, RequiredSamples: 1}))
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing first batch with pod1 metrics")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 60*CoreSecond, 4*MiByte)})))
+		Expect(s.Ready()).To(BeTrue())
+
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Timestamp.Time).Should(BeEquivalentTo(containerStart.Add(120 * time.Second)))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(120 * time.Second))
+		Expect(ms[0].Containers).Should(BeEquivalentTo([]metrics.ContainerMetrics{{
+			Name: "container1",
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(CoreSecond/2, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(4*MiByte, resource.BinarySI),
+			},
+		}}))
+
+		By("using window between scrapes once second batch is stored")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(130*time.Second), 70*CoreSecond, 4*MiByte)})))
+		ms, err = s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(10 * time.Second))
+	})
 	It("should use start time to return metric in one cycle for fresh new container", func() {
 		s := NewStorage(60 * time.Second)
 		containerStart := time.Now()
@@ -267,6 +419,104 @@ var _ = Describe("Pod storage", func() {
 			},
 		}}))
 	})
+	It("should use default window to return metric in one cycle for fresh new container", func() {
+		s := NewStorage(60*time.Second, WithDefaultWindow(15*time.Second))
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing first batch with pod1 metrics")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(40*time.Second), 20*CoreSecond, 4*MiByte)})))
+		Expect(s.Ready()).To(BeTrue())
+
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Timestamp.Time).Should(BeEquivalentTo(containerStart.Add(40 * time.Second)))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(15 * time.Second))
+		Expect(ms[0].Containers).Should(BeEquivalentTo([]metrics.ContainerMetrics{{
+			Name: "container1",
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(CoreSecond/2, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(4*MiByte, resource.BinarySI),
+			},
+		}}))
+	})
+	It("should use time since start as window if fresh new container is younger than default window", func() {
+		s := NewStorage(60*time.Second, WithDefaultWindow(2*time.Minute))
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing first batch with pod1 metrics")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(10*time.Second), 10*CoreSecond, 4*MiByte)})))
+
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(10 * time.Second))
+	})
+	It("should evict pods not read within eviction TTL until they are read again", func() {
+		evictedPods.Create(nil)
+		evictedPods.Reset()
+		s := NewStorage(60*time.Second, WithPodEvictionTTL(5*time.Minute))
+		now := time.Now()
+		s.pods.now = func() time.Time { return now }
+		containerStart := now.Add(-time.Hour)
+		readPod := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		stalePod := apitypes.NamespacedName{Name: "pod2", Namespace: "ns1"}
+		batch := podMetricsBatch(
+			podMetrics(readPod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-20*time.Second), 1*CoreSecond, 4*MiByte)}),
+			podMetrics(stalePod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-20*time.Second), 1*CoreSecond, 4*MiByte)}),
+		)
+
+		By("storing two batches")
+		s.Store(batch)
+		s.Store(podMetricsBatch(
+			podMetrics(readPod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-10*time.Second), 2*CoreSecond, 4*MiByte)}),
+			podMetrics(stalePod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-10*time.Second), 2*CoreSecond, 4*MiByte)}),
+		))
+		Expect(s.pods.prev).To(HaveLen(2))
+
+		By("reading pod1 and storing newer points after eviction TTL")
+		now = now.Add(4 * time.Minute)
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: readPod.Name, Namespace: readPod.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		now = now.Add(2 * time.Minute)
+		s.Store(podMetricsBatch(
+			podMetrics(readPod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-10*time.Second), 3*CoreSecond, 4*MiByte)}),
+			podMetrics(stalePod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-10*time.Second), 3*CoreSecond, 4*MiByte)}),
+		))
+
+		By("evicting unread pod2 only, even though it was updated")
+		Expect(s.pods.last).To(HaveKey(readPod))
+		Expect(s.pods.last).NotTo(HaveKey(stalePod))
+		Expect(s.pods.prev).NotTo(HaveKey(stalePod))
+		err = testutil.CollectAndCompare(evictedPods, strings.NewReader(`
+		# HELP metrics_server_evicted_pods_total [ALPHA] Number of pods whose metrics points were evicted, as they were not read.
+		# TYPE metrics_server_evicted_pods_total counter
+		metrics_server_evicted_pods_total 1
+		`), "metrics_server_evicted_pods_total")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("not storing evicted pod2 again until it's read")
+		now = now.Add(10 * time.Second)
+		s.Store(podMetricsBatch(
+			podMetrics(readPod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-10*time.Second), 4*CoreSecond, 4*MiByte)}),
+			podMetrics(stalePod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-10*time.Second), 4*CoreSecond, 4*MiByte)}),
+		))
+		Expect(s.pods.last).NotTo(HaveKey(stalePod))
+
+		By("storing pod2 again after it's read")
+		ms, err = s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: stalePod.Name, Namespace: stalePod.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(BeEmpty())
+		now = now.Add(10 * time.Second)
+		s.Store(podMetricsBatch(
+			podMetrics(readPod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-10*time.Second), 5*CoreSecond, 4*MiByte)}),
+			podMetrics(stalePod, containerMetricsPoint{"container1", newMetricsPoint(containerStart, now.Add(-10*time.Second), 5*CoreSecond, 4*MiByte)}),
+		))
+		Expect(s.pods.last).To(HaveKey(stalePod))
+	})
 	It("should get empty metrics in one cycle for fresh new container's start time after timestamp", func() {
 		s := NewStorage(60 * time.Second)
 		containerStart := time.Now()
@@ -340,6 +590,71 @@ var _ = Describe("Pod storage", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(ms).To(HaveLen(0))
 	})
+	It("should use start time window for fresh containers of pod with only last point", func() {
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		freshPod := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		oldPod := apitypes.NamespacedName{Name: "pod2", Namespace: "ns1"}
+		s.pods.last = map[apitypes.NamespacedName]PodMetricsPoint{
+			freshPod: {Containers: map[string]MetricsPoint{"container1": newMetricsPoint(containerStart, containerStart.Add(20*time.Second), 10*CoreSecond, 4*MiByte)}},
+			oldPod:   {Containers: map[string]MetricsPoint{"container1": newMetricsPoint(containerStart, containerStart.Add(200*time.Second), 10*CoreSecond, 4*MiByte)}},
+		}
+
+		By("returning metric for pod1 with fresh container averaged since start")
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: freshPod.Name, Namespace: freshPod.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(20 * time.Second))
+		Expect(ms[0].Containers).Should(BeEquivalentTo([]metrics.ContainerMetrics{{
+			Name: "container1",
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(CoreSecond/2, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(4*MiByte, resource.BinarySI),
+			},
+		}}))
+
+		By("returning empty for pod2 with container running longer than metric resolution")
+		checkPodResponseEmpty(s, oldPod)
+	})
+	It("should return empty and meter pod with negative window", func() {
+		negativeWindows.Create(nil)
+		negativeWindows.Reset()
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		s.pods.prev = map[apitypes.NamespacedName]PodMetricsPoint{
+			podRef: {Containers: map[string]MetricsPoint{"container1": newMetricsPoint(containerStart, containerStart.Add(130*time.Second), 10*CoreSecond, 4*MiByte)}},
+		}
+		s.pods.last = map[apitypes.NamespacedName]PodMetricsPoint{
+			podRef: {Containers: map[string]MetricsPoint{"container1": newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 40*CoreSecond, 4*MiByte)}},
+		}
+
+		checkPodResponseEmpty(s, podRef)
+		err := testutil.CollectAndCompare(negativeWindows, strings.NewReader(`
+		# HELP metrics_server_negative_window_total [ALPHA] Number of reads finding previous metrics point newer than the last one, whose usage was not served.
+		# TYPE metrics_server_negative_window_total counter
+		metrics_server_negative_window_total{type="pod"} 1
+		`), "metrics_server_negative_window_total")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should return empty and meter pod with only prev point", func() {
+		prevWithoutLast.Create(nil)
+		prevWithoutLast.Reset()
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		s.pods.prev = map[apitypes.NamespacedName]PodMetricsPoint{
+			podRef: {Containers: map[string]MetricsPoint{"container1": newMetricsPoint(containerStart, containerStart.Add(20*time.Second), 10*CoreSecond, 4*MiByte)}},
+		}
+
+		checkPodResponseEmpty(s, podRef)
+		err := testutil.CollectAndCompare(prevWithoutLast, strings.NewReader(`
+		# HELP metrics_server_storage_prev_without_last_total [ALPHA] Number of reads finding previous metrics point without the last one, which indicates inconsistent storage state.
+		# TYPE metrics_server_storage_prev_without_last_total counter
+		metrics_server_storage_prev_without_last_total{type="pod"} 1
+		`), "metrics_server_storage_prev_without_last_total")
+		Expect(err).NotTo(HaveOccurred())
+	})
 })
 
 func checkPodResponseEmpty(s *storage, podRef ...apitypes.NamespacedName) {
@@ -0,0 +1,72 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// WarmupPolicy governs when stored points are enough to serve usage of nodes and containers.
+// Usage is served between the last two points, or between the start time and the last point
+// when the policy allows using start time as previous point.
+type WarmupPolicy struct {
+	// MinStartTimeAge is the minimum time between start time and timestamp of a point for its start time to be
+	// used as previous point, as shorter windows can produce inaccurate usage.
+	MinStartTimeAge time.Duration
+	// StartTimeWindows serves containers started within metric resolution with window since their start,
+	// before their second point is scraped.
+	StartTimeWindows bool
+	// RequiredSamples is the number of points scraped before serving nodes and containers seen for the first time,
+	// either 1 or 2. With 1, usage since start time is served for them regardless of their age.
+	RequiredSamples int
+}
+
+// DefaultWarmupPolicy returns the policy serving fresh containers after a single point
+// and other nodes and containers after two points.
+func DefaultWarmupPolicy() WarmupPolicy {
+	return WarmupPolicy{
+		MinStartTimeAge:  10 * time.Second,
+		StartTimeWindows: true,
+		RequiredSamples:  2,
+	}
+}
+
+// Validate returns an error if the policy can't be used by storage.
+func (p WarmupPolicy) Validate() error {
+	if p.MinStartTimeAge < 0 {
+		return fmt.Errorf("min start time age should not be negative, but value %v provided", p.MinStartTimeAge)
+	}
+	if p.RequiredSamples != 1 && p.RequiredSamples != 2 {
+		return fmt.Errorf("required samples should be either 1 or 2, but value %d provided", p.RequiredSamples)
+	}
+	return nil
+}
+
+// startTimeUsable returns true if start time of the point is far enough before its timestamp to be used as previous point.
+func (p WarmupPolicy) startTimeUsable(point MetricsPoint) bool {
+	return point.StartTime.Before(point.Timestamp) && point.Timestamp.Sub(point.StartTime) >= p.MinStartTimeAge
+}
+
+// freshStartTime returns true if the point belongs to a container started within metric resolution,
+// served with window since its start.
+func (p WarmupPolicy) freshStartTime(point MetricsPoint, metricResolution time.Duration) bool {
+	return p.StartTimeWindows && p.startTimeUsable(point) && point.Timestamp.Sub(point.StartTime) < metricResolution
+}
+
+// singleSample returns true if nodes and containers seen for the first time are served after a single point.
+func (p WarmupPolicy) singleSample() bool {
+	return p.RequiredSamples == 1
+}
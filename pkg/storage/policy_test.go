@@ -0,0 +1,111 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+func TestWarmupPolicy(t *testing.T) {
+	singleSample := DefaultWarmupPolicy()
+	singleSample.RequiredSamples = 1
+	noStartTimeWindows := DefaultWarmupPolicy()
+	noStartTimeWindows.StartTimeWindows = false
+	singleSampleNoStartTimeWindows := singleSample
+	singleSampleNoStartTimeWindows.StartTimeWindows = false
+	noMinStartTimeAge := DefaultWarmupPolicy()
+	noMinStartTimeAge.MinStartTimeAge = 0
+
+	tcs := []struct {
+		name   string
+		policy WarmupPolicy
+		// age is the time between start time and timestamp of the first point of the node and container
+		age             time.Duration
+		expectContainer bool
+		expectNode      bool
+	}{
+		{"default, container younger than min start time age", DefaultWarmupPolicy(), 5 * time.Second, false, false},
+		{"default, fresh container", DefaultWarmupPolicy(), 30 * time.Second, true, false},
+		{"default, long running container", DefaultWarmupPolicy(), 120 * time.Second, false, false},
+		{"no start time windows, fresh container", noStartTimeWindows, 30 * time.Second, false, false},
+		{"no start time windows, long running container", noStartTimeWindows, 120 * time.Second, false, false},
+		{"single sample, container younger than min start time age", singleSample, 5 * time.Second, false, false},
+		{"single sample, fresh container", singleSample, 30 * time.Second, true, true},
+		{"single sample, long running container", singleSample, 120 * time.Second, true, true},
+		{"single sample without start time windows, fresh container", singleSampleNoStartTimeWindows, 30 * time.Second, true, true},
+		{"no min start time age, container just started", noMinStartTimeAge, 5 * time.Second, true, false},
+		{"no min start time age, long running container", noMinStartTimeAge, 120 * time.Second, false, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewStorage(60*time.Second, WithWarmupPolicy(tc.policy))
+			start := time.Now()
+			podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+			batch := podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start, start.Add(tc.age), uint64(tc.age.Seconds())*CoreSecond/2, MiByte)}))
+			batch.Nodes = nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(tc.age), uint64(tc.age.Seconds())*CoreSecond/2, MiByte)}).Nodes
+			s.Store(batch)
+
+			pods, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := len(pods) == 1; got != tc.expectContainer {
+				t.Errorf("Container served = %v, expected %v", got, tc.expectContainer)
+			}
+			nodes, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := len(nodes) == 1; got != tc.expectNode {
+				t.Errorf("Node served = %v, expected %v", got, tc.expectNode)
+			}
+		})
+	}
+}
+
+func TestWarmupPolicyValidate(t *testing.T) {
+	withRequiredSamples := func(samples int) WarmupPolicy {
+		policy := DefaultWarmupPolicy()
+		policy.RequiredSamples = samples
+		return policy
+	}
+	negativeMinStartTimeAge := DefaultWarmupPolicy()
+	negativeMinStartTimeAge.MinStartTimeAge = -time.Second
+	tcs := []struct {
+		name        string
+		policy      WarmupPolicy
+		expectError bool
+	}{
+		{"default", DefaultWarmupPolicy(), false},
+		{"single sample", withRequiredSamples(1), false},
+		{"no required samples", withRequiredSamples(0), true},
+		{"three required samples", withRequiredSamples(3), true},
+		{"negative required samples", withRequiredSamples(-1), true},
+		{"negative min start time age", negativeMinStartTimeAge, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.Validate()
+			if got := err != nil; got != tc.expectError {
+				t.Errorf("Validate() = %v, expected error %v", err, tc.expectError)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Sink receives scraped metrics batches, e.g. to forward them outside of metrics-server.
+type Sink interface {
+	Receive(batch *MetricsBatch) error
+}
+
+// MultiSink fans out each batch to all sinks in order, so a failing sink doesn't prevent others from receiving it.
+type MultiSink []Sink
+
+var _ Sink = MultiSink(nil)
+
+// Receive implements Sink interface, returning aggregate of errors returned by sinks.
+func (s MultiSink) Receive(batch *MetricsBatch) error {
+	var errs []error
+	for _, sink := range s {
+		if err := sink.Receive(batch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// StorageSink adapts storage to Sink interface, storing received batches.
+func StorageSink(s Storage) Sink {
+	return storageSink{s}
+}
+
+type storageSink struct {
+	storage Storage
+}
+
+func (s storageSink) Receive(batch *MetricsBatch) error {
+	s.storage.Store(batch)
+	return nil
+}
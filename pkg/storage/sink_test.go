@@ -0,0 +1,65 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multi sink", func() {
+	It("fans out batch to all sinks", func() {
+		first := &fakeSink{}
+		second := &fakeSink{}
+		batch := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(time.Now(), time.Now(), 10*CoreSecond, 2*MiByte)})
+
+		err := MultiSink{first, second}.Receive(batch)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.received).To(ConsistOf(batch))
+		Expect(second.received).To(ConsistOf(batch))
+	})
+	It("keeps fanning out batch after a sink fails", func() {
+		failing := &fakeSink{err: fmt.Errorf("remote unavailable")}
+		other := &fakeSink{}
+		batch := nodeMetricBatch()
+
+		err := MultiSink{failing, other}.Receive(batch)
+		Expect(err).To(MatchError("remote unavailable"))
+		Expect(failing.received).To(ConsistOf(batch))
+		Expect(other.received).To(ConsistOf(batch))
+	})
+	It("stores batches received by storage sink", func() {
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+
+		sink := MultiSink{StorageSink(s), &fakeSink{}}
+		Expect(sink.Receive(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(10*time.Second), 10*CoreSecond, 2*MiByte)}))).To(Succeed())
+		Expect(sink.Receive(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 20*CoreSecond, 2*MiByte)}))).To(Succeed())
+		Expect(s.Ready()).To(BeTrue())
+	})
+})
+
+type fakeSink struct {
+	received []*MetricsBatch
+	err      error
+}
+
+func (s *fakeSink) Receive(batch *MetricsBatch) error {
+	s.received = append(s.received, batch)
+	return s.err
+}
@@ -21,7 +21,10 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
 )
 
 // nodeStorage is a thread save nodeStorage for node and pod metrics.
@@ -29,12 +32,74 @@ type storage struct {
 	mu    sync.RWMutex
 	pods  podStorage
 	nodes nodeStorage
+
+	// generation is incremented each time a batch is stored.
+	generation uint64
+
+	// nodePodSumDiff enables comparing node usage with the sum of usage of pods on the node.
+	nodePodSumDiff bool
+
+	// cpuEWMAAlpha enables serving exponentially weighted moving average of CPU usage, zero disables it.
+	cpuEWMAAlpha     float64
+	nodeCpuEWMA      map[string]cpuEWMA
+	containerCpuEWMA map[containerRef]cpuEWMA
 }
 
 var _ Storage = (*storage)(nil)
+var _ api.GenerationGetter = (*storage)(nil)
+var _ api.ReadinessGetter = (*storage)(nil)
+
+// Option configures optional storage behavior.
+type Option func(*storage)
+
+// WithNodePodSumDiff enables exposing difference between node usage and the sum of its pods usage.
+func WithNodePodSumDiff() Option {
+	return func(s *storage) {
+		s.nodePodSumDiff = true
+	}
+}
+
+// WithDefaultWindow reports the given window for fresh containers with a single
+// metrics point, instead of time since container start. Window is clamped to metric resolution.
+func WithDefaultWindow(window time.Duration) Option {
+	return func(s *storage) {
+		s.pods.defaultWindow = min(window, s.pods.metricResolution)
+	}
+}
 
-func NewStorage(metricResolution time.Duration) *storage {
-	return &storage{pods: podStorage{metricResolution: metricResolution}}
+// WithPodEvictionTTL drops stored points of pods that were not read within the given time,
+// until they are read again, bounding memory used for pods nobody asks about. Nodes are never evicted.
+func WithPodEvictionTTL(ttl time.Duration) Option {
+	return func(s *storage) {
+		s.pods.evictionTTL = ttl
+	}
+}
+
+// WithCPUEWMA serves exponentially weighted moving average of CPU usage with the given
+// alpha in (0, 1], instead of usage between the last two points. Lower alpha smooths more.
+func WithCPUEWMA(alpha float64) Option {
+	return func(s *storage) {
+		s.cpuEWMAAlpha = alpha
+	}
+}
+
+// WithWarmupPolicy replaces the default policy governing when stored points are enough to serve usage.
+func WithWarmupPolicy(policy WarmupPolicy) Option {
+	return func(s *storage) {
+		s.pods.policy = policy
+		s.nodes.policy = policy
+	}
+}
+
+func NewStorage(metricResolution time.Duration, opts ...Option) *storage {
+	s := &storage{
+		pods:  podStorage{metricResolution: metricResolution, policy: DefaultWarmupPolicy()},
+		nodes: nodeStorage{policy: DefaultWarmupPolicy()},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Ready returns true if metrics-server's storage has accumulated enough metric
@@ -42,19 +107,97 @@ func NewStorage(metricResolution time.Duration) *storage {
 func (s *storage) Ready() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return len(s.nodes.prev) != 0 || len(s.pods.prev) != 0
+	if len(s.nodes.prev) != 0 || len(s.pods.prev) != 0 {
+		return true
+	}
+	for _, last := range s.nodes.last {
+		if last.CpuUsage != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *storage) GetNodeMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.nodes.GetMetrics(nodes...)
+	ms, err := s.nodes.GetMetrics(nodes...)
+	if err != nil || s.cpuEWMAAlpha == 0 {
+		return ms, err
+	}
+	for i := range ms {
+		s.applyNodeCpuEWMA(&ms[i])
+	}
+	return ms, nil
 }
 
 func (s *storage) GetPodMetrics(pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.pods.GetMetrics(pods...)
+	ms, err := s.pods.GetMetrics(pods...)
+	if err != nil || s.cpuEWMAAlpha == 0 {
+		return ms, err
+	}
+	for i := range ms {
+		s.applyPodCpuEWMA(&ms[i])
+	}
+	return ms, nil
+}
+
+// Reset drops all stored metrics, making storage not ready until new batches are stored.
+func (s *storage) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes = nodeStorage{policy: s.nodes.policy}
+	s.pods = podStorage{
+		metricResolution: s.pods.metricResolution,
+		defaultWindow:    s.pods.defaultWindow,
+		policy:           s.pods.policy,
+		evictionTTL:      s.pods.evictionTTL,
+		now:              s.pods.now,
+	}
+	s.nodeCpuEWMA = nil
+	s.containerCpuEWMA = nil
+	s.generation++
+	pointsStored.WithLabelValues("node").Set(0)
+	pointsStored.WithLabelValues("container").Set(0)
+	podsWithMetrics.Reset()
+}
+
+// ForgetNode drops stored metrics points of the node, so usage after node reboot
+// is not calculated against points collected before it.
+func (s *storage) ForgetNode(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.nodes.last, name)
+	delete(s.nodes.prev, name)
+	delete(s.nodeCpuEWMA, name)
+	s.generation++
+	pointsStored.WithLabelValues("node").Set(float64(len(s.nodes.prev)))
+}
+
+// LatestBatch returns copy of the latest stored points of nodes and pods, with cumulative values as scraped.
+func (s *storage) LatestBatch() *MetricsBatch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	batch := &MetricsBatch{
+		Nodes: make(map[string]MetricsPoint, len(s.nodes.last)),
+		Pods:  make(map[apitypes.NamespacedName]PodMetricsPoint, len(s.pods.last)),
+	}
+	for name, point := range s.nodes.last {
+		batch.Nodes[name] = point
+	}
+	for ref, pod := range s.pods.last {
+		batch.Pods[ref] = pod
+	}
+	return batch
+}
+
+// Generation implements api.GenerationGetter interface
+func (s *storage) Generation() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generation
 }
 
 func (s *storage) Store(batch *MetricsBatch) {
@@ -62,4 +205,46 @@ func (s *storage) Store(batch *MetricsBatch) {
 	defer s.mu.Unlock()
 	s.nodes.Store(batch)
 	s.pods.Store(batch)
+	s.generation++
+	if s.nodePodSumDiff {
+		s.updateNodePodSumDiff()
+	}
+	if s.cpuEWMAAlpha > 0 {
+		s.updateCpuEWMA()
+	}
+}
+
+// updateNodePodSumDiff compares usage reported for each node with the sum of
+// usage of pods scraped from it, to detect accounting discrepancies in Kubelet.
+func (s *storage) updateNodePodSumDiff() {
+	podCpu := make(map[string]float64, len(s.nodes.last))
+	podMemory := make(map[string]float64, len(s.nodes.last))
+	for podRef, lastPod := range s.pods.last {
+		prevPod := s.pods.prev[podRef]
+		for container, lastContainer := range lastPod.Containers {
+			podMemory[lastPod.Node] += float64(lastContainer.MemoryUsage)
+			prevContainer, found := prevPod.Containers[container]
+			if !found {
+				continue
+			}
+			usage, _, err := resourceUsage(lastContainer, prevContainer)
+			if err != nil {
+				continue
+			}
+			podCpu[lastPod.Node] += usage.Cpu().AsApproximateFloat64()
+		}
+	}
+	nodePodSumDiff.Reset()
+	for nodeName, last := range s.nodes.last {
+		prev, found := s.nodes.prev[nodeName]
+		if !found {
+			continue
+		}
+		usage, _, err := resourceUsage(last, prev)
+		if err != nil {
+			continue
+		}
+		nodePodSumDiff.WithLabelValues(nodeName, "cpu").Set(usage.Cpu().AsApproximateFloat64() - podCpu[nodeName])
+		nodePodSumDiff.WithLabelValues(nodeName, "memory").Set(usage.Memory().AsApproximateFloat64() - podMemory[nodeName])
+	}
 }
@@ -27,6 +27,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
@@ -198,6 +200,40 @@ func benchmarkStorageReadContainer(b *testing.B, g *generator) {
 	}
 }
 
+func BenchmarkStorageListPods(b *testing.B) {
+	for _, s := range scenarios {
+		r := rand.New(rand.NewSource(1))
+		g := newGenerator(r, s)
+		for _, workers := range []int{1, 4} {
+			b.Run(fmt.Sprintf("%s workers %d", s.name, workers), func(b *testing.B) {
+				benchmarkStorageListPods(b, g, workers)
+			})
+		}
+	}
+}
+
+func benchmarkStorageListPods(b *testing.B, g *generator, workers int) {
+	s := NewStorage(60 * time.Second)
+	s.Store(g.NewBatch())
+	s.Store(g.NewBatch())
+	getter := api.NewParallelPodMetricsGetter(s, workers)
+	pods := []*metav1.PartialObjectMetadata{}
+	for _, d := range g.Deployments() {
+		pods = append(pods, g.Pods(d)...)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ms, err := getter.GetPodMetrics(pods...)
+		if err != nil {
+			panic(err)
+		}
+		if len(ms) != len(pods) {
+			panic(fmt.Sprintf("%s: Expect to get all pods, expected: %d, got: %d", b.Name(), len(pods), len(ms)))
+		}
+	}
+}
+
 func BenchmarkStorageReadNode(b *testing.B) {
 	for _, s := range scenarios {
 		r := rand.New(rand.NewSource(1))
@@ -15,7 +15,16 @@
 package storage
 
 import (
+	"strings"
 	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/component-base/metrics/testutil"
 )
 
 const (
@@ -23,6 +32,59 @@ const (
 	CoreSecond = 1000 * 1000 * 1000
 )
 
+var _ = Describe("Storage", func() {
+	It("exposes difference between node usage and sum of its pods usage", func() {
+		nodePodSumDiff.Create(nil)
+		nodePodSumDiff.Reset()
+		s := NewStorage(60*time.Second, WithNodePodSumDiff())
+		start := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing first batch with node1 and pod metrics")
+		s.Store(nodePodMetricsBatch("node1",
+			newMetricsPoint(start, start.Add(10*time.Second), 10*CoreSecond, 3*MiByte),
+			podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start.Add(-time.Hour), start.Add(10*time.Second), 2*CoreSecond, 1*MiByte)}),
+		))
+
+		By("storing second batch with node1 and pod metrics")
+		s.Store(nodePodMetricsBatch("node1",
+			newMetricsPoint(start, start.Add(20*time.Second), 20*CoreSecond, 3*MiByte),
+			podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start.Add(-time.Hour), start.Add(20*time.Second), 6*CoreSecond, 1*MiByte)}),
+		))
+
+		err := testutil.CollectAndCompare(nodePodSumDiff, strings.NewReader(`
+		# HELP metrics_server_node_pod_sum_diff [ALPHA] Difference between node usage and the sum of usage of pods on the node. CPU in cores, memory in bytes.
+		# TYPE metrics_server_node_pod_sum_diff gauge
+		metrics_server_node_pod_sum_diff{node="node1",resource="cpu"} 0.6
+		metrics_server_node_pod_sum_diff{node="node1",resource="memory"} 2.097152e+06
+		`), "metrics_server_node_pod_sum_diff")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("counts repeated metrics points per node", func() {
+		repeatedPoints.Create(nil)
+		repeatedPoints.Reset()
+		s := NewStorage(60 * time.Second)
+		start := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		batch := nodePodMetricsBatch("node1",
+			newMetricsPoint(start, start.Add(10*time.Second), 10*CoreSecond, 3*MiByte),
+			podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start.Add(-time.Hour), start.Add(10*time.Second), 2*CoreSecond, 1*MiByte)}),
+		)
+
+		By("storing the same batch three times")
+		s.Store(batch)
+		s.Store(batch)
+		s.Store(batch)
+
+		err := testutil.CollectAndCompare(repeatedPoints, strings.NewReader(`
+		# HELP metrics_server_repeated_point_total [ALPHA] Number of metrics points with the same timestamp as the stored ones, which can indicate a frozen Kubelet.
+		# TYPE metrics_server_repeated_point_total counter
+		metrics_server_repeated_point_total{node="node1"} 4
+		`), "metrics_server_repeated_point_total")
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
 func newMetricsPoint(st time.Time, ts time.Time, cpu, memory uint64) MetricsPoint {
 	return MetricsPoint{
 		StartTime:         st,
@@ -31,3 +93,60 @@ func newMetricsPoint(st time.Time, ts time.Time, cpu, memory uint64) MetricsPoin
 		MemoryUsage:       memory,
 	}
 }
+
+var _ = Describe("Storage with CPU EWMA", func() {
+	It("serves smoothed CPU usage with effective lookback window", func() {
+		raw := NewStorage(60 * time.Second)
+		smoothed := NewStorage(60*time.Second, WithCPUEWMA(0.5))
+		start := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+		pod := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}}
+
+		// Usage alternates between 1 and 3 cores, EWMA with alpha 0.5 is 1, 2, 1.5 and 2.25 cores.
+		cpu := []uint64{10, 20, 50, 60, 90}
+		expectRaw := []string{"", "1", "3", "1", "3"}
+		expectSmoothed := []string{"", "1", "2", "1500m", "2250m"}
+		expectWindow := []time.Duration{0, 10 * time.Second, 20 * time.Second, 20 * time.Second, 20 * time.Second}
+		for i := range cpu {
+			timestamp := start.Add(time.Duration(i+1) * 10 * time.Second)
+			batch := nodePodMetricsBatch("node1",
+				newMetricsPoint(start, timestamp, cpu[i]*CoreSecond, 3*MiByte),
+				podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start.Add(-time.Hour), timestamp, cpu[i]*CoreSecond, 1*MiByte)}),
+			)
+			raw.Store(batch)
+			smoothed.Store(batch)
+			if i == 0 {
+				continue
+			}
+
+			rawNodes, err := raw.GetNodeMetrics(node)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rawNodes).To(HaveLen(1))
+			Expect(rawNodes[0].Usage.Cpu().String()).To(Equal(expectRaw[i]))
+			Expect(rawNodes[0].Window.Duration).To(Equal(10 * time.Second))
+
+			nodes, err := smoothed.GetNodeMetrics(node)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nodes).To(HaveLen(1))
+			Expect(nodes[0].Usage.Cpu().String()).To(Equal(expectSmoothed[i]))
+			Expect(nodes[0].Window.Duration).To(Equal(expectWindow[i]))
+
+			pods, err := smoothed.GetPodMetrics(pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pods).To(HaveLen(1))
+			Expect(pods[0].Containers[0].Usage.Cpu().String()).To(Equal(expectSmoothed[i]))
+			Expect(pods[0].Window.Duration).To(Equal(expectWindow[i]))
+		}
+	})
+})
+
+func nodePodMetricsBatch(node string, nodePoint MetricsPoint, pods ...podMetricsPoint) *MetricsBatch {
+	batch := podMetricsBatch(pods...)
+	batch.Nodes = map[string]MetricsPoint{node: nodePoint}
+	for podRef, pod := range batch.Pods {
+		pod.Node = node
+		batch.Pods[podRef] = pod
+	}
+	return batch
+}
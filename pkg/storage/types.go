@@ -29,13 +29,58 @@ import (
 
 // MetricsBatch is a single batch of pod, container, and node metrics from some source.
 type MetricsBatch struct {
-	Nodes map[string]MetricsPoint
-	Pods  map[apitypes.NamespacedName]PodMetricsPoint
+	// ClusterName identifies the cluster the batch was scraped from. It is meant
+	// for sinks aggregating batches from multiple clusters and is not exposed via the Metrics API.
+	ClusterName string
+	Nodes       map[string]MetricsPoint
+	Pods        map[apitypes.NamespacedName]PodMetricsPoint
+	// DroppedContainers holds reasons of dropping container metrics while decoding, by pod and container name.
+	// It is meant for debugging missing metrics and is not exposed via the Metrics API.
+	DroppedContainers map[apitypes.NamespacedName]map[string]string
+	// ReusedNodes holds names of nodes whose points were reused from an earlier scrape instead of scraped again,
+	// e.g. with round-robin scraping, so points of these nodes and their pods are expected to repeat.
+	ReusedNodes map[string]struct{}
+}
+
+// AddReusedNode marks points of the node and its pods as reused from an earlier scrape.
+func (b *MetricsBatch) AddReusedNode(node string) {
+	if b.ReusedNodes == nil {
+		b.ReusedNodes = make(map[string]struct{})
+	}
+	b.ReusedNodes[node] = struct{}{}
+}
+
+// Reused returns true if points of the node and its pods were reused from an earlier scrape.
+func (b *MetricsBatch) Reused(node string) bool {
+	_, found := b.ReusedNodes[node]
+	return found
+}
+
+// AddDroppedContainer records the reason of dropping metrics of the container.
+func (b *MetricsBatch) AddDroppedContainer(pod apitypes.NamespacedName, container, reason string) {
+	if b.DroppedContainers == nil {
+		b.DroppedContainers = make(map[apitypes.NamespacedName]map[string]string)
+	}
+	if b.DroppedContainers[pod] == nil {
+		b.DroppedContainers[pod] = make(map[string]string)
+	}
+	b.DroppedContainers[pod][container] = reason
 }
 
 // PodMetricsPoint contains the metrics for some pod's containers.
 type PodMetricsPoint struct {
+	// Node is the name of the node the pod metrics were scraped from.
+	Node       string
 	Containers map[string]MetricsPoint
+	// CumulativeCpuUsed is the pod-level cumulative cpu used reported by Kubelet, only set if
+	// enabled. It includes pod overhead not attributed to containers, served as usage of
+	// PodOverheadContainer. Unit: nano core * seconds.
+	CumulativeCpuUsed uint64
+	// Timestamp is the time when pod-level cpu usage was measured.
+	Timestamp time.Time
+	// MemoryUsage is the pod-level memory working set reported by Kubelet, only set if enabled.
+	// Like pod-level cpu usage, it includes pod overhead served as usage of PodOverheadContainer. Unit: bytes.
+	MemoryUsage uint64
 }
 
 // MetricsPoint represents the a set of specific metrics at some point in time.
@@ -48,17 +93,27 @@ type MetricsPoint struct {
 	CumulativeCpuUsed uint64
 	// MemoryUsage is the working set size. Unit: bytes.
 	MemoryUsage uint64
+	// FilesystemUsage is the filesystem usage of the node, only set when exposed by Kubelet. Unit: bytes.
+	FilesystemUsage uint64
+	// CpuUsage is the instantaneous cpu usage of the node, only set when Kubelet reports it as a gauge
+	// instead of a cumulative counter. Zero means usage is calculated from CumulativeCpuUsed. Unit: nano cores.
+	CpuUsage uint64
+	// MemoryApproximate marks MemoryUsage of a node approximated from memory usage of its pods, as Kubelet didn't report it.
+	MemoryApproximate bool
 }
 
 func resourceUsage(last, prev MetricsPoint) (corev1.ResourceList, api.TimeInfo, error) {
 	if last.StartTime.Before(prev.StartTime) {
 		return corev1.ResourceList{}, api.TimeInfo{}, fmt.Errorf("unexpected decrease in startTime of node/container")
 	}
-	if last.CumulativeCpuUsed < prev.CumulativeCpuUsed {
-		return corev1.ResourceList{}, api.TimeInfo{}, fmt.Errorf("unexpected decrease in cumulative CPU usage value")
-	}
 	window := last.Timestamp.Sub(prev.Timestamp)
-	cpuUsage := float64(last.CumulativeCpuUsed-prev.CumulativeCpuUsed) / window.Seconds()
+	cpuUsage := float64(last.CpuUsage)
+	if last.CpuUsage == 0 {
+		if last.CumulativeCpuUsed < prev.CumulativeCpuUsed {
+			return corev1.ResourceList{}, api.TimeInfo{}, fmt.Errorf("unexpected decrease in cumulative CPU usage value")
+		}
+		cpuUsage = float64(last.CumulativeCpuUsed-prev.CumulativeCpuUsed) / window.Seconds()
+	}
 	return corev1.ResourceList{
 			corev1.ResourceCPU:    uint64Quantity(uint64(cpuUsage), resource.DecimalSI, -9),
 			corev1.ResourceMemory: uint64Quantity(last.MemoryUsage, resource.BinarySI, 0),
@@ -68,6 +123,25 @@ func resourceUsage(last, prev MetricsPoint) (corev1.ResourceList, api.TimeInfo,
 		}, nil
 }
 
+// negativeWindow returns true if the previous point is newer than the last one, e.g. when timestamps arrive out of order.
+// Usage over such window is not served, as cumulative CPU usage of the points doesn't match any real window.
+func negativeWindow(last, prev MetricsPoint, metricType string) bool {
+	if !prev.Timestamp.After(last.Timestamp) {
+		return false
+	}
+	negativeWindows.WithLabelValues(metricType).Inc()
+	return true
+}
+
+// startTimePoint returns point at start time of a node or container, with zero cumulative CPU usage,
+// allowing to calculate usage when the previous point is missing.
+func startTimePoint(last MetricsPoint) MetricsPoint {
+	prev := last
+	prev.Timestamp = last.StartTime
+	prev.CumulativeCpuUsed = 0
+	return prev
+}
+
 // uint64Quantity converts a uint64 into a Quantity, which only has constructors
 // that work with int64 (except for parse, which requires costly round-trips to string).
 // We lose precision until we fit in an int64 if greater than the max int64 value.
@@ -15,7 +15,9 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 )
@@ -74,3 +76,57 @@ func NewPriorityNodeAddressResolver(typePriority []corev1.NodeAddressType) NodeA
 		addrTypePriority: typePriority,
 	}
 }
+
+// HostResolver looks up addresses of a host, e.g. net.Resolver.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+// dnsFallbackNodeAddrResolver resolves hostname of nodes via DNS if no address matches the wrapped resolver.
+type dnsFallbackNodeAddrResolver struct {
+	NodeAddressResolver
+	hostResolver HostResolver
+	timeout      time.Duration
+}
+
+func (r *dnsFallbackNodeAddrResolver) NodeAddress(node *corev1.Node) (string, error) {
+	address, err := r.NodeAddressResolver.NodeAddress(node)
+	if err == nil {
+		return address, nil
+	}
+	var hostname string
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeHostName {
+			hostname = addr.Address
+			break
+		}
+	}
+	if hostname == "" {
+		return "", err
+	}
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	addrs, lookupErr := r.hostResolver.LookupHost(ctx, hostname)
+	if lookupErr != nil {
+		return "", fmt.Errorf("%w, failed resolving hostname %q: %v", err, hostname, lookupErr)
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("%w, hostname %q resolved to no addresses", err, hostname)
+	}
+	return addrs[0], nil
+}
+
+// NewDNSFallbackNodeAddressResolver creates a NodeAddressResolver that falls back to resolving
+// node hostname using the given host resolver, within the timeout, if the given resolver finds no address.
+// Zero timeout means no timeout.
+func NewDNSFallbackNodeAddressResolver(resolver NodeAddressResolver, hostResolver HostResolver, timeout time.Duration) NodeAddressResolver {
+	return &dnsFallbackNodeAddrResolver{
+		NodeAddressResolver: resolver,
+		hostResolver:        hostResolver,
+		timeout:             timeout,
+	}
+}
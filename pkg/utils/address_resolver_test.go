@@ -0,0 +1,82 @@
+// Copyright 2026 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("DNS fallback node address resolver", func() {
+	ipTypes := []corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeExternalIP}
+	hostnameOnly := &corev1.Node{Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "node1.example.com"},
+	}}}
+
+	It("should fail for hostname-only node without fallback", func() {
+		_, err := NewPriorityNodeAddressResolver(ipTypes).NodeAddress(hostnameOnly)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should resolve hostname of hostname-only node", func() {
+		hosts := &fakeHostResolver{addrs: map[string][]string{"node1.example.com": {"10.0.0.1", "10.0.0.2"}}}
+		resolver := NewDNSFallbackNodeAddressResolver(NewPriorityNodeAddressResolver(ipTypes), hosts, time.Second)
+
+		address, err := resolver.NodeAddress(hostnameOnly)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(address).To(Equal("10.0.0.1"))
+		Expect(hosts.hasDeadline).To(BeTrue())
+	})
+	It("should prefer matching address over resolving hostname", func() {
+		hosts := &fakeHostResolver{addrs: map[string][]string{"node1.example.com": {"10.0.0.1"}}}
+		resolver := NewDNSFallbackNodeAddressResolver(NewPriorityNodeAddressResolver(ipTypes), hosts, time.Second)
+		node := &corev1.Node{Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeHostName, Address: "node1.example.com"},
+			{Type: corev1.NodeExternalIP, Address: "192.168.0.1"},
+		}}}
+
+		address, err := resolver.NodeAddress(node)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(address).To(Equal("192.168.0.1"))
+		Expect(hosts.lookups).To(BeZero())
+	})
+	It("should fail if hostname can't be resolved", func() {
+		resolver := NewDNSFallbackNodeAddressResolver(NewPriorityNodeAddressResolver(ipTypes), &fakeHostResolver{}, time.Second)
+
+		_, err := resolver.NodeAddress(hostnameOnly)
+		Expect(err).To(MatchError(ContainSubstring(`failed resolving hostname "node1.example.com"`)))
+	})
+})
+
+type fakeHostResolver struct {
+	addrs       map[string][]string
+	lookups     int
+	hasDeadline bool
+}
+
+func (r *fakeHostResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups++
+	_, r.hasDeadline = ctx.Deadline()
+	addrs, found := r.addrs[host]
+	if !found {
+		return nil, fmt.Errorf("no such host")
+	}
+	return addrs, nil
+}
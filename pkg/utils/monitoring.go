@@ -56,3 +56,38 @@ func BucketsForScrapeDuration(scrapeTimeout time.Duration) []float64 {
 
 	return buckets
 }
+
+// defaultMetricsNamespace is the namespace of metrics exposed by metrics server about itself.
+const defaultMetricsNamespace = "metrics_server"
+
+// MetricsPrefix configures names of metrics exposed by metrics server about itself.
+// Zero value keeps the default namespace and subsystems.
+type MetricsPrefix struct {
+	namespace       string
+	subsystemPrefix string
+}
+
+// NewMetricsPrefix returns prefix replacing the default namespace with non-empty namespace
+// and prepending non-empty subsystemPrefix to subsystems.
+func NewMetricsPrefix(namespace, subsystemPrefix string) MetricsPrefix {
+	return MetricsPrefix{namespace: namespace, subsystemPrefix: subsystemPrefix}
+}
+
+// Namespace returns namespace of metrics.
+func (p MetricsPrefix) Namespace() string {
+	if p.namespace == "" {
+		return defaultMetricsNamespace
+	}
+	return p.namespace
+}
+
+// Subsystem returns subsystem of metrics in the given subsystem, which can be empty.
+func (p MetricsPrefix) Subsystem(subsystem string) string {
+	if p.subsystemPrefix == "" {
+		return subsystem
+	}
+	if subsystem == "" {
+		return p.subsystemPrefix
+	}
+	return p.subsystemPrefix + "_" + subsystem
+}
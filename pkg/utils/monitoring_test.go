@@ -77,3 +77,19 @@ var _ = Describe("Prometheus Bucket Estimator", func() {
 		})
 	})
 })
+
+var _ = Describe("Metrics prefix", func() {
+	It("should keep default namespace and subsystems when empty", func() {
+		prefix := NewMetricsPrefix("", "")
+		Expect(prefix).To(Equal(MetricsPrefix{}))
+		Expect(prefix.Namespace()).To(Equal("metrics_server"))
+		Expect(prefix.Subsystem("storage")).To(Equal("storage"))
+		Expect(prefix.Subsystem("")).To(Equal(""))
+	})
+	It("should replace namespace and prepend subsystem prefix", func() {
+		prefix := NewMetricsPrefix("tenant", "team")
+		Expect(prefix.Namespace()).To(Equal("tenant"))
+		Expect(prefix.Subsystem("storage")).To(Equal("team_storage"))
+		Expect(prefix.Subsystem("")).To(Equal("team"))
+	})
+})